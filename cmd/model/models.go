@@ -9,9 +9,32 @@ const (
 	StatusPending = "pending"
 )
 
+// Failure reasons for FetchResult, set when a failure has a machine-readable cause
+const (
+	FailureBlockedByRobots = "blocked_by_robots"
+	FailureThrottled       = "throttled" // The target host's egress rate limit didn't allow a request in time
+)
+
 // FetchRequest represents the incoming POST request payload
 type FetchRequest struct {
-	URLs []string `json:"urls"`
+	URLs    []string       `json:"urls"`
+	Sitemap *SitemapSource `json:"sitemap,omitempty"` // Alternative to URLs: expand a sitemap into the URL list
+	Cache   string         `json:"cache,omitempty"`   // "bypass", "prefer" or "only"; empty for standard HTTP caching
+}
+
+// SitemapSource describes a sitemap.xml or sitemap index to submit URLs from
+type SitemapSource struct {
+	URL          string   `json:"url"`
+	LastModSince string   `json:"lastmod_since,omitempty"` // W3C datetime; entries modified earlier are skipped
+	Include      []string `json:"include,omitempty"`       // Regexes; URLs must match at least one
+	Exclude      []string `json:"exclude,omitempty"`       // Regexes; matching URLs are skipped
+	MaxURLs      int      `json:"max_urls,omitempty"`      // Cap on submitted URLs; 0 uses the server limit
+}
+
+// LineError reports an invalid line of an NDJSON or CSV upload to POST /fetch
+type LineError struct {
+	Line  int    `json:"line"` // 1-based
+	Error string `json:"error"`
 }
 
 // FetchResult represents the result of fetching a single URL
@@ -20,13 +43,40 @@ type FetchResult struct {
 	Status        string    `json:"status"` // "success", "failed", "pending"
 	Content       string    `json:"content,omitempty"`
 	ContentLength int       `json:"content_length"`
+	ContentType   string    `json:"content_type,omitempty"`
 	StatusCode    int       `json:"status_code,omitempty"`
 	Error         string    `json:"error,omitempty"`
+	FailureReason string    `json:"failure_reason,omitempty"` // One of the Failure* constants
 	FetchedAt     time.Time `json:"fetched_at,omitempty"`
 	CreatedAt     time.Time `json:"created_at"` // When the result was created
 	Duration      string    `json:"duration,omitempty"`
 	RedirectCount int       `json:"redirect_count,omitempty"`
-	FinalURL      string    `json:"final_url,omitempty"` // Final URL after redirects
+	FinalURL      string    `json:"final_url,omitempty"`    // Final URL after redirects
+	JobID         string    `json:"job_id,omitempty"`       // Submission the result belongs to
+	RequestID     string    `json:"request_id,omitempty"`   // X-Request-ID of the submitting request
+	Tenant        string    `json:"-"`                      // Tenant that submitted the URL
+	FromCache     bool      `json:"from_cache,omitempty"`   // Served from the response cache
+	Revalidated   bool      `json:"revalidated,omitempty"`  // Cached copy confirmed by a 304 from the origin
+	Deduplicated  bool      `json:"deduplicated,omitempty"` // Shared an identical in-flight fetch
+	ParentURL     string    `json:"parent_url,omitempty"`   // Crawl page the URL was discovered on
+	Depth         int       `json:"depth,omitempty"`        // Crawl depth, 0 for seeds
+
+	// Time spent waiting for the target hosts' egress rate limits, included in Duration
+	ThrottledFor string `json:"throttled_for,omitempty"`
+
+	// Change detection against the previous fetch of the same URL
+	ContentHash       string       `json:"content_hash,omitempty"`
+	Changed           *bool        `json:"changed,omitempty"` // Unset on the first fetch of a URL
+	PreviousFetchedAt time.Time    `json:"previous_fetched_at,omitzero"`
+	Diff              *DiffSummary `json:"diff,omitempty"`
+}
+
+// DiffSummary describes how content changed since the previous fetch
+type DiffSummary struct {
+	LinesAdded   int    `json:"lines_added"`
+	LinesRemoved int    `json:"lines_removed"`
+	Unified      string `json:"unified"`   // Unified diff of the normalized content
+	Truncated    bool   `json:"truncated"` // Unified diff was cut short
 }
 
 // FetchResponse represents the GET response containing all fetch results
@@ -47,3 +97,139 @@ type CleanupStats struct {
 	ResultsInMemory int       `json:"results_in_memory"`
 }
 
+// ScheduleRequest represents the POST /schedules payload
+type ScheduleRequest struct {
+	URLs     []string             `json:"urls"`
+	Interval string               `json:"interval,omitempty"` // Go duration, e.g. "5m"
+	Cron     string               `json:"cron,omitempty"`     // 5-field cron expression, e.g. "*/15 * * * *"
+	Tenant   string               `json:"-"`                  // Set from the caller's identity
+	Budget   func(urls int) error `json:"-"`                  // Charges each run's URLs to the creator; nil for none
+}
+
+// Schedule represents a recurring fetch of a fixed URL set
+type Schedule struct {
+	ID        string        `json:"id"`
+	Tenant    string        `json:"-"`
+	URLs      []string      `json:"urls"`
+	Interval  string        `json:"interval,omitempty"`
+	Cron      string        `json:"cron,omitempty"`
+	Paused    bool          `json:"paused"`
+	CreatedAt time.Time     `json:"created_at"`
+	LastRun   time.Time     `json:"last_run,omitzero"`
+	NextRun   time.Time     `json:"next_run,omitzero"`
+	RunCount  int           `json:"run_count"`
+	History   []ScheduleRun `json:"history"` // Most recent runs, oldest first
+}
+
+// ScheduleRun records a single execution of a schedule
+type ScheduleRun struct {
+	JobID        string    `json:"job_id,omitempty"`  // Unset for skipped runs
+	Skipped      string    `json:"skipped,omitempty"` // Why the run was skipped, e.g. an exhausted budget
+	StartedAt    time.Time `json:"started_at"`
+	TotalURLs    int       `json:"total_urls"`
+	SuccessCount int       `json:"success_count"`
+	FailedCount  int       `json:"failed_count"`
+	PendingCount int       `json:"pending_count"`
+}
+
+// CrawlRequest represents the POST /crawl payload
+type CrawlRequest struct {
+	Seeds        []string `json:"seeds"`
+	MaxDepth     *int     `json:"max_depth,omitempty"` // Link levels followed from the seeds; 1 when omitted
+	MaxPages     int      `json:"max_pages"`
+	Scope        string   `json:"scope,omitempty"`         // "host" (default), "domain" or "regex"
+	ScopePattern string   `json:"scope_pattern,omitempty"` // Regex a URL must match when scope is "regex"
+	Include      []string `json:"include,omitempty"`       // Regexes; if set, a URL must match at least one
+	Exclude      []string `json:"exclude,omitempty"`       // Regexes; a URL matching any is skipped
+	Tenant       string   `json:"-"`                       // Set from the caller's identity
+	RequestID    string   `json:"-"`                       // X-Request-ID of the starting request
+	Traceparent  string   `json:"-"`                       // W3C trace context of the starting request
+}
+
+// Status constants for background jobs: crawls and link checks
+const (
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobCancelled = "cancelled"
+)
+
+// CrawlJob tracks the progress of a crawl. Pages are stored as regular
+// results sharing the crawl's job ID.
+type CrawlJob struct {
+	JobID           string       `json:"job_id"`
+	Status          string       `json:"status"`
+	Request         CrawlRequest `json:"request"`
+	PagesFetched    int          `json:"pages_fetched"`
+	LinksDiscovered int          `json:"links_discovered"`
+	CurrentDepth    int          `json:"current_depth"`
+	StartedAt       time.Time    `json:"started_at"`
+	FinishedAt      time.Time    `json:"finished_at,omitzero"`
+}
+
+// LinkCheckRequest represents the POST /linkcheck payload
+type LinkCheckRequest struct {
+	Pages       []string `json:"pages"`               // Pages whose links are checked
+	MaxLinks    int      `json:"max_links,omitempty"` // Distinct link targets checked; LINKCHECK_MAX_LINKS when omitted
+	Tenant      string   `json:"-"`                   // Set from the caller's identity
+	RequestID   string   `json:"-"`                   // X-Request-ID of the starting request
+	Traceparent string   `json:"-"`                   // W3C trace context of the starting request
+}
+
+// Link check categories
+const (
+	LinkOK         = "ok"
+	LinkRedirect   = "redirect"
+	Link4xx        = "4xx"
+	Link5xx        = "5xx"
+	LinkTimeout    = "timeout"
+	LinkDNSFailure = "dns_failure"
+	LinkError      = "error" // Any other failure, e.g. connection refused or blocked by robots.txt
+)
+
+// LinkCheckJob tracks a link check and holds its report once completed
+type LinkCheckJob struct {
+	JobID        string                     `json:"job_id"`
+	Status       string                     `json:"status"` // One of the Job* status values
+	Request      LinkCheckRequest           `json:"request"`
+	PagesFetched int                        `json:"pages_fetched"`
+	LinksFound   int                        `json:"links_found"`   // Distinct link targets
+	LinksChecked int                        `json:"links_checked"` // Distinct link targets checked so far
+	Summary      map[string]int             `json:"summary"`       // Link occurrences per category
+	Report       map[string][]LinkCheckItem `json:"report"`        // Link occurrences grouped by category
+	PageErrors   []LinkCheckItem            `json:"page_errors,omitempty"`
+	StartedAt    time.Time                  `json:"started_at"`
+	FinishedAt   time.Time                  `json:"finished_at,omitzero"`
+}
+
+// LinkCheckItem is one link occurrence and the outcome of checking its target
+type LinkCheckItem struct {
+	URL        string `json:"url"`
+	SourcePage string `json:"source_page"`
+	AnchorText string `json:"anchor_text,omitempty"`
+	Tag        string `json:"tag,omitempty"`
+	Category   string `json:"category"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Method     string `json:"method,omitempty"` // HEAD, or GET when HEAD was rejected
+	FinalURL   string `json:"final_url,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ConfigReload is the outcome of re-reading the configuration
+type ConfigReload struct {
+	Applied         []string  `json:"applied"`          // Changed settings now in effect
+	RestartRequired []string  `json:"restart_required"` // Changed settings that take effect after a restart
+	ReloadedAt      time.Time `json:"reloaded_at"`
+}
+
+// EffectiveConfig is the configuration a running instance uses
+type EffectiveConfig struct {
+	Settings   map[string]ConfigSetting `json:"settings"` // By environment variable, "domains" for the per-domain overrides
+	ReloadedAt time.Time                `json:"reloaded_at,omitzero"`
+}
+
+// ConfigSetting is the value of a setting and where it came from
+type ConfigSetting struct {
+	Value      interface{} `json:"value"`      // Secrets are redacted
+	Source     string      `json:"source"`     // "default", "env", "file" or "flag"
+	Reloadable bool        `json:"reloadable"` // Changes apply on reload, without a restart
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fetch/internal/config"
+	"fetch/internal/handler"
+	"fetch/internal/logging"
+	"fetch/internal/ratelimit"
+	"fetch/internal/service"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime"
+	"runtime/debug"
+)
+
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+// usage prints the available commands
+func usage(w io.Writer) {
+	fmt.Fprint(w, `Usage: fetch-service [command] [flags]
+
+Commands:
+  serve          Run the HTTP service (default)
+  fetch URL...   Fetch URLs once and print the results as JSON
+  check-config   Validate the configuration and exit
+  version        Print build information
+
+Run "fetch-service <command> -h" for the flags of a command.
+`)
+}
+
+// newFlagSet creates the flag set of a command, printing its usage to w
+func newFlagSet(command, arguments, description string, w io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(w)
+	flags.Usage = func() {
+		fmt.Fprintf(w, "Usage: fetch-service %s %s\n\n%s\n\nFlags:\n", command, arguments, description)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// settingsFlags defines -config and a flag for every setting
+func settingsFlags(flags *flag.FlagSet) (*string, config.Overrides) {
+	configFile := flags.String("config", "", "JSON config file (default $CONFIG_FILE)")
+	overrides := make(config.Overrides)
+	overrides.RegisterFlags(flags)
+	return configFile, overrides
+}
+
+// flagStatus returns the exit status for a flag parsing error; -h is not
+// a failure
+func flagStatus(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	return 2
+}
+
+// loadConfig loads the configuration of a one-off command, printing any
+// problems to w
+func loadConfig(path string, overrides config.Overrides, w io.Writer) (*config.Config, bool) {
+	cfg, err := config.LoadWithOverrides(path, overrides)
+	var invalid *config.ValidationError
+	if errors.As(err, &invalid) {
+		fmt.Fprintln(w, "Invalid configuration:")
+		for _, problem := range invalid.Problems {
+			fmt.Fprintf(w, "  %s\n", problem)
+		}
+		return nil, false
+	}
+	if err != nil {
+		fmt.Fprintf(w, "Failed to load configuration: %v\n", err)
+		return nil, false
+	}
+	return cfg, true
+}
+
+// fetchCommand fetches URLs with the service's fetch logic and prints the
+// results as JSON. It fails when any URL failed.
+func fetchCommand(args []string, stdout, stderr io.Writer) int {
+	flags := newFlagSet("fetch", "[flags] URL...", "Fetch URLs once and print the results as JSON.", stderr)
+	configFile, overrides := settingsFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return flagStatus(err)
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(stderr, "No URLs given")
+		flags.Usage()
+		return 2
+	}
+
+	cfg, ok := loadConfig(*configFile, overrides, stderr)
+	if !ok {
+		return 1
+	}
+	logger, err := logging.New(stderr, cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		fmt.Fprintf(stderr, "Invalid logging configuration: %v\n", err)
+		return 1
+	}
+	slog.SetDefault(logger)
+
+	tenantQuotas, err := service.ParseTenantQuotas(cfg.TenantQuotas)
+	if err != nil {
+		fmt.Fprintf(stderr, "Invalid TENANT_QUOTAS: %v\n", err)
+		return 1
+	}
+	egress, err := newEgressLimiter(cfg)
+	if err != nil {
+		fmt.Fprintf(stderr, "Invalid egress rate limit configuration: %v\n", err)
+		return 1
+	}
+	serviceConfig := newServiceConfig(cfg, tenantQuotas)
+	serviceConfig.Egress = egress
+
+	// Requests to this process are not rate limited, so the limiter is local
+	fetchService := service.NewFetchService(serviceConfig,
+		ratelimit.NewRateLimiter(cfg.RateLimitRequests, cfg.RateLimitBurst, cfg.RateLimitWindow))
+	defer fetchService.Stop()
+
+	response := fetchService.FetchURLs(flags.Args(), service.FetchOptions{})
+
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(response); err != nil {
+		fmt.Fprintf(stderr, "Failed to write results: %v\n", err)
+		return 1
+	}
+	if response.FailedCount > 0 {
+		return 1
+	}
+	return 0
+}
+
+// checkConfigCommand validates the configuration, including the settings
+// only parsed when the service starts
+func checkConfigCommand(args []string, stdout, stderr io.Writer) int {
+	flags := newFlagSet("check-config", "[flags]", "Validate the configuration and exit.", stderr)
+	configFile, overrides := settingsFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return flagStatus(err)
+	}
+
+	cfg, ok := loadConfig(*configFile, overrides, stderr)
+	if !ok {
+		return 1
+	}
+
+	var problems []string
+	if _, err := service.ParseTenantQuotas(cfg.TenantQuotas); err != nil {
+		problems = append(problems, fmt.Sprintf("TENANT_QUOTAS: %v", err))
+	}
+	if _, err := newEgressLimiter(cfg); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if _, err := handlers.ParseTrustedProxies(cfg.TrustedProxies, cfg.IPv6Prefix, cfg.TrustedProxyHeader); err != nil {
+		problems = append(problems, fmt.Sprintf("TRUSTED_PROXIES: %v", err))
+	}
+	if _, err := newAuthenticator(cfg); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if len(problems) > 0 {
+		fmt.Fprintln(stderr, "Invalid configuration:")
+		for _, problem := range problems {
+			fmt.Fprintf(stderr, "  %s\n", problem)
+		}
+		return 1
+	}
+
+	if cfg.ConfigFile != "" {
+		fmt.Fprintf(stdout, "Configuration is valid (config file %s)\n", cfg.ConfigFile)
+	} else {
+		fmt.Fprintln(stdout, "Configuration is valid")
+	}
+	return 0
+}
+
+// versionCommand prints the version and the build information embedded by
+// the Go toolchain
+func versionCommand(stdout io.Writer) int {
+	fmt.Fprintf(stdout, "fetch-service %s\n", version)
+	fmt.Fprintf(stdout, "  go:       %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return 0
+	}
+	var revision, modified, buildTime string
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			if setting.Value == "true" {
+				modified = " (modified)"
+			}
+		case "vcs.time":
+			buildTime = setting.Value
+		}
+	}
+	if revision != "" {
+		fmt.Fprintf(stdout, "  revision: %s%s\n", revision, modified)
+	}
+	if buildTime != "" {
+		fmt.Fprintf(stdout, "  time:     %s\n", buildTime)
+	}
+	return 0
+}
@@ -1,101 +1,310 @@
 package config
 
 import (
-	"log"
+	"log/slog"
 	"os"
-	"strconv"
 	"time"
 )
 
-// Config holds all application configuration
+// Config holds all application configuration. The env tag of a field names
+// its environment variable; reload:"live" marks settings that can change
+// without a restart (see Reload) and secret:"true" those redacted by
+// Settings.
 type Config struct {
 	// Server settings
-	ServerAddress string
-	
+	ServerAddress string `env:"SERVER_ADDRESS"`
+
+	// Logging settings
+	LogLevel  string `env:"LOG_LEVEL" reload:"live"` // "debug", "info", "warn" or "error"
+	LogFormat string `env:"LOG_FORMAT"`              // "json" or "text"
+
 	// Fetch settings
-	FetchTimeout       time.Duration
-	MaxRedirects       int
-	MaxContentSize     int64
-	
+	FetchTimeout     time.Duration `env:"FETCH_TIMEOUT" reload:"live"`
+	MaxRedirects     int           `env:"MAX_REDIRECTS" reload:"live"`
+	MaxContentSize   int64         `env:"MAX_CONTENT_SIZE" reload:"live"`
+	FetchConcurrency int           `env:"FETCH_CONCURRENCY" reload:"live"` // URLs fetched in parallel per job
+
+	// Upload settings
+	UploadMaxBytes int64 `env:"UPLOAD_MAX_BYTES"` // Largest NDJSON or CSV body of POST /fetch
+	UploadMaxURLs  int   `env:"UPLOAD_MAX_URLS"`  // Most URLs in one upload, JSON list or schedule
+
 	// Rate limiting settings
-	RateLimitRequests int
-	RateLimitWindow   time.Duration
-	RateLimitBurst    int
-	
+	RateLimitRequests  int           `env:"RATE_LIMIT_REQUESTS" reload:"live"`
+	RateLimitWindow    time.Duration `env:"RATE_LIMIT_WINDOW" reload:"live"`
+	RateLimitBurst     int           `env:"RATE_LIMIT_BURST" reload:"live"`
+	RateLimitAlgorithm string        `env:"RATE_LIMIT_ALGORITHM" reload:"live"`
+
+	// Shared rate limit state
+	RateLimitBackend      string        `env:"RATE_LIMIT_BACKEND"` // "memory" or "redis"
+	RateLimitRedisURL     string        `env:"RATE_LIMIT_REDIS_URL" secret:"true"`
+	RateLimitRedisTimeout time.Duration `env:"RATE_LIMIT_REDIS_TIMEOUT"`
+
+	// Client IP settings
+	TrustedProxies     []string `env:"TRUSTED_PROXIES"`        // CIDRs or IPs whose forwarding headers are believed
+	TrustedProxyHeader string   `env:"TRUSTED_PROXY_HEADER"`   // The one forwarding header the trusted proxies set
+	IPv6Prefix         int      `env:"RATE_LIMIT_IPV6_PREFIX"` // IPv6 clients are rate limited per prefix of this length
+
 	// Cleanup/TTL settings
-	ResultTTL          time.Duration
-	CleanupInterval    time.Duration
-	MaxResultsInMemory int
-}
+	ResultTTL          time.Duration `env:"RESULT_TTL" reload:"live"`
+	CleanupInterval    time.Duration `env:"CLEANUP_INTERVAL" reload:"live"`
+	MaxResultsInMemory int           `env:"MAX_RESULTS_IN_MEMORY" reload:"live"`
 
-// Load loads configuration from environment variables with defaults
-func Load() *Config {
-	return &Config{
-		ServerAddress:      getEnv("SERVER_ADDRESS", ":8080"),
-		FetchTimeout:       getDurationEnv("FETCH_TIMEOUT", 30*time.Second),
-		MaxRedirects:       getIntEnv("MAX_REDIRECTS", 10),
-		MaxContentSize:     getInt64Env("MAX_CONTENT_SIZE", 10*1024*1024), // 10MB
-		RateLimitRequests:  getIntEnv("RATE_LIMIT_REQUESTS", 100),
-		RateLimitWindow:    getDurationEnv("RATE_LIMIT_WINDOW", 1*time.Minute),
-		RateLimitBurst:     getIntEnv("RATE_LIMIT_BURST", 20),
-		ResultTTL:          getDurationEnv("RESULT_TTL", 1*time.Hour),
-		CleanupInterval:    getDurationEnv("CLEANUP_INTERVAL", 10*time.Minute),
-		MaxResultsInMemory: getIntEnv("MAX_RESULTS_IN_MEMORY", 10000),
-	}
-}
+	// Schedule settings
+	ScheduleHistorySize int           `env:"SCHEDULE_HISTORY_SIZE" reload:"live"`
+	MinScheduleInterval time.Duration `env:"MIN_SCHEDULE_INTERVAL" reload:"live"`
 
-// LogConfig logs the current configuration
-func (c *Config) LogConfig() {
-	log.Println("Configuration:")
-	log.Printf("  Server Address: %s", c.ServerAddress)
-	log.Printf("  Fetch Timeout: %v", c.FetchTimeout)
-	log.Printf("  Max Redirects: %d", c.MaxRedirects)
-	log.Printf("  Max Content Size: %d bytes (%.2f MB)", c.MaxContentSize, float64(c.MaxContentSize)/1024/1024)
-	log.Printf("  Rate Limit: %d requests per %v (burst: %d)", c.RateLimitRequests, c.RateLimitWindow, c.RateLimitBurst)
-	log.Printf("  Result TTL: %v", c.ResultTTL)
-	log.Printf("  Cleanup Interval: %v", c.CleanupInterval)
-	log.Printf("  Max Results in Memory: %d", c.MaxResultsInMemory)
+	// Change detection settings
+	ChangeDetection           bool     `env:"CHANGE_DETECTION" reload:"live"`
+	ChangeIgnorePatterns      []string `env:"CHANGE_IGNORE_PATTERNS"`
+	ChangeNormalizeWhitespace bool     `env:"CHANGE_NORMALIZE_WHITESPACE" reload:"live"`
+
+	// HTTP response cache settings
+	CacheEnabled    bool `env:"HTTP_CACHE_ENABLED"`
+	CacheMaxEntries int  `env:"HTTP_CACHE_MAX_ENTRIES"`
+
+	// Deduplication settings
+	DedupEnabled   bool `env:"DEDUP_ENABLED" reload:"live"`
+	DedupSortQuery bool `env:"DEDUP_SORT_QUERY" reload:"live"`
+
+	// Crawl settings
+	CrawlMaxDepth    int `env:"CRAWL_MAX_DEPTH" reload:"live"`
+	CrawlMaxPages    int `env:"CRAWL_MAX_PAGES" reload:"live"`
+	CrawlConcurrency int `env:"CRAWL_CONCURRENCY" reload:"live"`
+
+	// robots.txt settings
+	UserAgent      string        `env:"USER_AGENT"`
+	RobotsEnabled  bool          `env:"ROBOTS_ENABLED"`
+	RobotsCacheTTL time.Duration `env:"ROBOTS_CACHE_TTL"`
+
+	// Sitemap settings
+	SitemapMaxURLs int `env:"SITEMAP_MAX_URLS" reload:"live"`
+
+	// Link check settings
+	LinkCheckMaxLinks    int `env:"LINKCHECK_MAX_LINKS" reload:"live"`
+	LinkCheckConcurrency int `env:"LINKCHECK_CONCURRENCY" reload:"live"`
+
+	// Authentication settings
+	APIKeys     []string `env:"API_KEYS" secret:"true"` // "name:key:scope|scope" entries
+	APIKeysFile string   `env:"API_KEYS_FILE"`          // JSON file with additional keys
+
+	// Submission budgets
+	URLRateLimit      int `env:"URL_RATE_LIMIT" reload:"live"` // URLs per RATE_LIMIT_WINDOW; 0 disables
+	DailyRequestQuota int `env:"DAILY_REQUEST_QUOTA"`          // Submissions per day; 0 disables
+	DailyURLQuota     int `env:"DAILY_URL_QUOTA"`              // URLs submitted per day; 0 disables
+
+	// Tenant settings
+	TenantQuotas []string `env:"TENANT_QUOTAS" reload:"live"` // "tenant:max_results:ttl" entries
+
+	// Outbound rate limits per target host
+	EgressRateLimit  int           `env:"EGRESS_RATE_LIMIT"` // Requests per EGRESS_RATE_WINDOW to each host; 0 disables
+	EgressRateWindow time.Duration `env:"EGRESS_RATE_WINDOW"`
+	EgressBurst      int           `env:"EGRESS_BURST"`
+	EgressHostLimits []string      `env:"EGRESS_HOST_LIMITS"` // "domain:rate:window:burst" overrides
+	EgressMaxWait    time.Duration `env:"EGRESS_MAX_WAIT"`
+
+	// Tracing settings
+	TracingEnabled           bool   `env:"TRACING_ENABLED"`
+	TracingEndpoint          string `env:"OTEL_EXPORTER_OTLP_ENDPOINT"` // OTLP/HTTP collector base URL
+	TracingServiceName       string `env:"OTEL_SERVICE_NAME"`
+	TracingPropagateOutbound bool   `env:"TRACING_PROPAGATE_OUTBOUND"` // Send traceparent with outbound requests
+
+	// Config file settings
+	ConfigFile string                  `env:"CONFIG_FILE"`                         // JSON file the settings were read from, "" if none
+	Domains    map[string]DomainConfig `env:"domains" reload:"live" secret:"true"` // Per-domain overrides, only settable in the file
+
+	sources map[string]string // Source of each setting not left at its default, by key
 }
 
-// getEnv gets a string environment variable or returns default
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
+// Load loads configuration from environment variables and the JSON config
+// file at path, or at CONFIG_FILE when path is empty. Environment variables
+// take precedence over the file, which takes precedence over defaults. All
+// invalid or unknown settings are reported together in a *ValidationError.
+func Load(path string) (*Config, error) {
+	return LoadWithOverrides(path, nil)
 }
 
-// getIntEnv gets an integer environment variable or returns default
-func getIntEnv(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
-		}
-		log.Printf("Warning: Invalid integer value for %s: %s, using default: %d", key, value, defaultValue)
+// LoadWithOverrides is Load with overrides, such as command-line flags,
+// taking precedence over the environment
+func LoadWithOverrides(path string, overrides Overrides) (*Config, error) {
+	pathSource := SourceFlag
+	if path == "" {
+		path, pathSource = os.Getenv("CONFIG_FILE"), SourceEnv
 	}
-	return defaultValue
-}
+	l, err := newLoader(path, overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Config{
+		ServerAddress:      l.str("SERVER_ADDRESS", ":8080"),
+		FetchTimeout:       l.duration("FETCH_TIMEOUT", 30*time.Second),
+		MaxRedirects:       l.int("MAX_REDIRECTS", 10),
+		MaxContentSize:     l.int64("MAX_CONTENT_SIZE", 10*1024*1024), // 10MB
+		FetchConcurrency:   l.int("FETCH_CONCURRENCY", 50),
+		UploadMaxBytes:     l.int64("UPLOAD_MAX_BYTES", 10*1024*1024), // 10MB
+		UploadMaxURLs:      l.int("UPLOAD_MAX_URLS", 10000),
+		RateLimitRequests:  l.int("RATE_LIMIT_REQUESTS", 100),
+		RateLimitWindow:    l.duration("RATE_LIMIT_WINDOW", 1*time.Minute),
+		RateLimitBurst:     l.int("RATE_LIMIT_BURST", 20),
+		RateLimitAlgorithm: l.str("RATE_LIMIT_ALGORITHM", "fixed_window"),
+		TrustedProxies:     l.list("TRUSTED_PROXIES", nil),
+		TrustedProxyHeader: l.str("TRUSTED_PROXY_HEADER", "X-Forwarded-For"),
+		IPv6Prefix:         l.int("RATE_LIMIT_IPV6_PREFIX", 64),
+		ResultTTL:          l.duration("RESULT_TTL", 1*time.Hour),
+		CleanupInterval:    l.duration("CLEANUP_INTERVAL", 10*time.Minute),
+		MaxResultsInMemory: l.int("MAX_RESULTS_IN_MEMORY", 10000),
+
+		LogLevel:  l.str("LOG_LEVEL", "info"),
+		LogFormat: l.str("LOG_FORMAT", "json"),
+
+		RateLimitBackend:      l.str("RATE_LIMIT_BACKEND", "memory"),
+		RateLimitRedisURL:     l.str("RATE_LIMIT_REDIS_URL", "redis://localhost:6379/0"),
+		RateLimitRedisTimeout: l.duration("RATE_LIMIT_REDIS_TIMEOUT", 200*time.Millisecond),
+
+		ScheduleHistorySize: l.int("SCHEDULE_HISTORY_SIZE", 20),
+		MinScheduleInterval: l.duration("MIN_SCHEDULE_INTERVAL", 1*time.Minute),
+
+		ChangeDetection:           l.bool("CHANGE_DETECTION", false),
+		ChangeIgnorePatterns:      l.list("CHANGE_IGNORE_PATTERNS", nil),
+		ChangeNormalizeWhitespace: l.bool("CHANGE_NORMALIZE_WHITESPACE", true),
+
+		CacheEnabled:    l.bool("HTTP_CACHE_ENABLED", false),
+		CacheMaxEntries: l.int("HTTP_CACHE_MAX_ENTRIES", 1000),
+
+		DedupEnabled:   l.bool("DEDUP_ENABLED", true),
+		DedupSortQuery: l.bool("DEDUP_SORT_QUERY", false),
+
+		CrawlMaxDepth:    l.int("CRAWL_MAX_DEPTH", 5),
+		CrawlMaxPages:    l.int("CRAWL_MAX_PAGES", 1000),
+		CrawlConcurrency: l.int("CRAWL_CONCURRENCY", 5),
+
+		UserAgent:      l.str("USER_AGENT", "URL-Fetch-Service/1.0"),
+		RobotsEnabled:  l.bool("ROBOTS_ENABLED", false),
+		RobotsCacheTTL: l.duration("ROBOTS_CACHE_TTL", 1*time.Hour),
 
-// getInt64Env gets an int64 environment variable or returns default
-func getInt64Env(key string, defaultValue int64) int64 {
-	if value := os.Getenv(key); value != "" {
-		if int64Value, err := strconv.ParseInt(value, 10, 64); err == nil {
-			return int64Value
-		}
-		log.Printf("Warning: Invalid int64 value for %s: %s, using default: %d", key, value, defaultValue)
+		SitemapMaxURLs: l.int("SITEMAP_MAX_URLS", 50000),
+
+		LinkCheckMaxLinks:    l.int("LINKCHECK_MAX_LINKS", 1000),
+		LinkCheckConcurrency: l.int("LINKCHECK_CONCURRENCY", 10),
+
+		APIKeys:     l.list("API_KEYS", nil),
+		APIKeysFile: l.str("API_KEYS_FILE", ""),
+
+		URLRateLimit:      l.int("URL_RATE_LIMIT", 0),
+		DailyRequestQuota: l.int("DAILY_REQUEST_QUOTA", 0),
+		DailyURLQuota:     l.int("DAILY_URL_QUOTA", 0),
+
+		TenantQuotas: l.list("TENANT_QUOTAS", nil),
+
+		EgressRateLimit:  l.int("EGRESS_RATE_LIMIT", 0),
+		EgressRateWindow: l.duration("EGRESS_RATE_WINDOW", 1*time.Second),
+		EgressBurst:      l.int("EGRESS_BURST", 1),
+		EgressHostLimits: l.list("EGRESS_HOST_LIMITS", nil),
+		EgressMaxWait:    l.duration("EGRESS_MAX_WAIT", 1*time.Minute),
+
+		TracingEnabled:           l.bool("TRACING_ENABLED", false),
+		TracingEndpoint:          l.str("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318"),
+		TracingServiceName:       l.str("OTEL_SERVICE_NAME", "fetch"),
+		TracingPropagateOutbound: l.bool("TRACING_PROPAGATE_OUTBOUND", false),
 	}
-	return defaultValue
-}
+	c.ConfigFile = path
+	if path != "" {
+		l.sources["CONFIG_FILE"] = pathSource
+	}
+	c.Domains = l.domains()
+	c.sources = l.sources
+	l.unknownKeys()
 
-// getDurationEnv gets a duration environment variable or returns default
-func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
-	if value := os.Getenv(key); value != "" {
-		if duration, err := time.ParseDuration(value); err == nil {
-			return duration
-		}
-		log.Printf("Warning: Invalid duration value for %s: %s, using default: %v", key, value, defaultValue)
+	problems := append(l.problems, c.problems()...)
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
 	}
-	return defaultValue
+	return c, nil
 }
 
-
+// LogConfig logs the current configuration
+func (c *Config) LogConfig() {
+	slog.Info("Configuration",
+		"server_address", c.ServerAddress,
+		"config_file", c.ConfigFile,
+		"log_level", c.LogLevel,
+		"log_format", c.LogFormat,
+		"fetch_timeout", c.FetchTimeout,
+		"max_redirects", c.MaxRedirects,
+		"max_content_size", c.MaxContentSize,
+		"fetch_concurrency", c.FetchConcurrency,
+		slog.Group("upload",
+			"max_bytes", c.UploadMaxBytes,
+			"max_urls", c.UploadMaxURLs,
+		),
+		slog.Group("rate_limit",
+			"requests", c.RateLimitRequests,
+			"window", c.RateLimitWindow,
+			"burst", c.RateLimitBurst,
+			"algorithm", c.RateLimitAlgorithm,
+			"backend", c.RateLimitBackend,
+			"trusted_proxies", c.TrustedProxies,
+			"trusted_proxy_header", c.TrustedProxyHeader,
+			"ipv6_prefix", c.IPv6Prefix,
+			"url_limit", c.URLRateLimit,
+			"daily_requests", c.DailyRequestQuota,
+			"daily_urls", c.DailyURLQuota,
+		),
+		slog.Group("cleanup",
+			"result_ttl", c.ResultTTL,
+			"interval", c.CleanupInterval,
+			"max_results", c.MaxResultsInMemory,
+			"tenant_quotas", c.TenantQuotas,
+		),
+		slog.Group("schedules",
+			"history_size", c.ScheduleHistorySize,
+			"min_interval", c.MinScheduleInterval,
+		),
+		slog.Group("change_detection",
+			"enabled", c.ChangeDetection,
+			"ignore_patterns", len(c.ChangeIgnorePatterns),
+			"normalize_whitespace", c.ChangeNormalizeWhitespace,
+		),
+		slog.Group("cache",
+			"enabled", c.CacheEnabled,
+			"max_entries", c.CacheMaxEntries,
+		),
+		slog.Group("dedup",
+			"enabled", c.DedupEnabled,
+			"sort_query", c.DedupSortQuery,
+		),
+		"user_agent", c.UserAgent,
+		slog.Group("robots",
+			"enabled", c.RobotsEnabled,
+			"cache_ttl", c.RobotsCacheTTL,
+		),
+		slog.Group("crawl",
+			"max_depth", c.CrawlMaxDepth,
+			"max_pages", c.CrawlMaxPages,
+			"concurrency", c.CrawlConcurrency,
+		),
+		"sitemap_max_urls", c.SitemapMaxURLs,
+		slog.Group("linkcheck",
+			"max_links", c.LinkCheckMaxLinks,
+			"concurrency", c.LinkCheckConcurrency,
+		),
+		slog.Group("auth",
+			"api_keys", len(c.APIKeys),
+			"api_keys_file", c.APIKeysFile,
+		),
+		slog.Group("egress",
+			"rate_limit", c.EgressRateLimit,
+			"window", c.EgressRateWindow,
+			"burst", c.EgressBurst,
+			"host_limits", c.EgressHostLimits,
+			"max_wait", c.EgressMaxWait,
+		),
+		slog.Group("tracing",
+			"enabled", c.TracingEnabled,
+			"endpoint", c.TracingEndpoint,
+			"service_name", c.TracingServiceName,
+			"propagate_outbound", c.TracingPropagateOutbound,
+		),
+		"domains", len(c.Domains),
+	)
+}
@@ -0,0 +1,262 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes a config file into a temporary directory and
+// returns its path
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.FetchTimeout != 30*time.Second || cfg.RateLimitRequests != 100 || cfg.ConfigFile != "" {
+		t.Errorf("unexpected defaults %+v", cfg)
+	}
+}
+
+func TestLoadMergesFileAndEnvironment(t *testing.T) {
+	path := writeConfigFile(t, `{
+		"fetch_timeout": "45s",
+		"rate_limit_requests": 200,
+		"change_detection": true,
+		"change_ignore_patterns": ["a,b", "c"],
+		"result_ttl": "2h",
+		"domains": {
+			"API.Example.com": {
+				"fetch_timeout": "2m",
+				"max_redirects": 0,
+				"headers": {"Authorization": "Bearer token"},
+				"rate_limit": 10,
+				"rate_window": "1m"
+			}
+		}
+	}`)
+	t.Setenv("RESULT_TTL", "30m")
+	t.Setenv("CONFIG_FILE", path)
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.ConfigFile != path {
+		t.Errorf("expected CONFIG_FILE to be used, got %q", cfg.ConfigFile)
+	}
+	if cfg.FetchTimeout != 45*time.Second || cfg.RateLimitRequests != 200 || !cfg.ChangeDetection {
+		t.Errorf("file settings not applied: %+v", cfg)
+	}
+	if !slices.Equal(cfg.ChangeIgnorePatterns, []string{"a,b", "c"}) {
+		t.Errorf("expected list items from the file to be kept whole, got %q", cfg.ChangeIgnorePatterns)
+	}
+	if cfg.ResultTTL != 30*time.Minute {
+		t.Errorf("expected the environment to take precedence, got RESULT_TTL %v", cfg.ResultTTL)
+	}
+	if cfg.MaxRedirects != 10 {
+		t.Errorf("expected unset settings to keep their defaults, got MAX_REDIRECTS %d", cfg.MaxRedirects)
+	}
+
+	d, ok := cfg.Domains["api.example.com"]
+	if !ok {
+		t.Fatalf("expected lowercase domain overrides, got %+v", cfg.Domains)
+	}
+	if d.FetchTimeout != 2*time.Minute || d.MaxRedirects == nil || *d.MaxRedirects != 0 ||
+		d.Headers["Authorization"] != "Bearer token" || *d.RateLimit != 10 || d.RateWindow != time.Minute {
+		t.Errorf("unexpected domain overrides %+v", d)
+	}
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	path := writeConfigFile(t, `{
+		"fetch_timeout": "0s",
+		"max_redirects": "ten",
+		"rate_limit_burst": 500,
+		"max_results_in_memory": 0,
+		"fetch_timout": "10s",
+		"domains": {
+			"example.com": {"fetch_timeout": "soon", "rate_limit": 1, "burst": 5},
+			"bad.com": {"retries": 3}
+		}
+	}`)
+	t.Setenv("CLEANUP_INTERVAL", "often")
+
+	_, err := Load(path)
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+
+	want := []string{
+		`max_redirects in config file: expected an integer, got "ten"`,
+		`CLEANUP_INTERVAL: invalid duration "often"`,
+		`domains.bad.com in config file: json: unknown field "retries"`,
+		`domains.example.com.fetch_timeout in config file: invalid duration "soon"`,
+		`fetch_timout in config file: unknown setting`,
+		`FETCH_TIMEOUT must be positive, got 0s`,
+		`RATE_LIMIT_BURST (500) must not exceed RATE_LIMIT_REQUESTS (100)`,
+		`MAX_RESULTS_IN_MEMORY must be positive, got 0`,
+		`domains.example.com.burst (5) must not exceed rate_limit (1)`,
+	}
+	if !slices.Equal(invalid.Problems, want) {
+		t.Errorf("unexpected problems:\n got %q\nwant %q", invalid.Problems, want)
+	}
+}
+
+func TestLoadRejectsUnsupportedRedisAlgorithm(t *testing.T) {
+	t.Setenv("RATE_LIMIT_BACKEND", "redis")
+
+	_, err := Load("")
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected a ValidationError for the default fixed_window algorithm, got %v", err)
+	}
+	want := []string{`RATE_LIMIT_BACKEND redis supports RATE_LIMIT_ALGORITHM gcra or sliding_window, got "fixed_window"`}
+	if !slices.Equal(invalid.Problems, want) {
+		t.Errorf("unexpected problems:\n got %q\nwant %q", invalid.Problems, want)
+	}
+
+	t.Setenv("RATE_LIMIT_ALGORITHM", "gcra")
+	if _, err := Load(""); err != nil {
+		t.Errorf("expected redis with gcra to load, got %v", err)
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Errorf("expected an error for a missing config file")
+	}
+	if _, err := Load(writeConfigFile(t, `fetch_timeout: 30s`)); err == nil {
+		t.Errorf("expected an error for a config file that isn't JSON")
+	}
+}
+
+func TestReload(t *testing.T) {
+	limit := 5
+	cur, err := Load("")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	cur.URLRateLimit = 1000
+	next := *cur
+	next.ResultTTL = time.Minute
+	next.LogFormat = "text"
+	next.URLRateLimit = 0 // Disabling the URL limiter needs a restart
+	next.Domains = map[string]DomainConfig{"example.com": {RateLimit: &limit}}
+
+	reloaded, applied, restart := cur.Reload(&next)
+	if !slices.Equal(applied, []string{"RESULT_TTL"}) {
+		t.Errorf("unexpected applied settings %q", applied)
+	}
+	if want := []string{"LOG_FORMAT", "URL_RATE_LIMIT", "domains"}; !slices.Equal(restart, want) {
+		t.Errorf("expected restart-only settings %q, got %q", want, restart)
+	}
+	if reloaded.ResultTTL != time.Minute || reloaded.LogFormat != "json" || reloaded.URLRateLimit != 1000 || reloaded.Domains != nil {
+		t.Errorf("expected only live settings to change, got %+v", reloaded)
+	}
+	if cur.ResultTTL != time.Hour {
+		t.Errorf("expected the current configuration to be left alone, got RESULT_TTL %v", cur.ResultTTL)
+	}
+
+	// Domain overrides other than rate limits apply live
+	next.Domains = map[string]DomainConfig{"example.com": {UserAgent: "custom"}}
+	if _, applied, _ := cur.Reload(&next); !slices.Contains(applied, "domains") {
+		t.Errorf("expected domain fetch settings to apply live, got %q", applied)
+	}
+}
+
+func TestSettings(t *testing.T) {
+	path := writeConfigFile(t, `{
+		"fetch_timeout": "45s",
+		"api_keys": ["ops:s3cret:admin|read"],
+		"domains": {"example.com": {"headers": {"Authorization": "Bearer token"}, "rate_limit": 5}}
+	}`)
+	t.Setenv("RATE_LIMIT_REDIS_URL", "redis://:hunter2@cache:6379/0")
+	t.Setenv("CONFIG_FILE", path)
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	settings := cfg.Settings()
+
+	for key, want := range map[string]Setting{
+		"FETCH_TIMEOUT":        {Value: "45s", Source: SourceFile, Reloadable: true},
+		"MAX_REDIRECTS":        {Value: 10, Source: SourceDefault, Reloadable: true},
+		"SERVER_ADDRESS":       {Value: ":8080", Source: SourceDefault},
+		"RATE_LIMIT_REDIS_URL": {Value: "redis://:xxxxx@cache:6379/0", Source: SourceEnv},
+		"CONFIG_FILE":          {Value: path, Source: SourceEnv},
+	} {
+		if got := settings[key]; got != want {
+			t.Errorf("%s: expected %+v, got %+v", key, want, got)
+		}
+	}
+	if got := settings["API_KEYS"].Value; !slices.Equal(got.([]string), []string{"ops:[REDACTED]:admin|read"}) {
+		t.Errorf("expected the API key to be redacted, got %q", got)
+	}
+	domain := settings["domains"].Value.(map[string]fileDomain)["example.com"]
+	if domain.Headers["Authorization"] != "[REDACTED]" || *domain.RateLimit != 5 {
+		t.Errorf("expected domain headers to be redacted, got %+v", domain)
+	}
+	if len(settings) < 50 {
+		t.Errorf("expected every setting to be reported, got %d", len(settings))
+	}
+
+	// Reloaded settings report their new source
+	next := *cfg
+	next.sources = map[string]string{}
+	next.FetchTimeout = time.Minute
+	reloaded, _, _ := cfg.Reload(&next)
+	if source := reloaded.Source("FETCH_TIMEOUT"); source != SourceDefault {
+		t.Errorf("expected the reloaded source, got %s", source)
+	}
+	if source := cfg.Source("FETCH_TIMEOUT"); source != SourceFile {
+		t.Errorf("expected the current sources to be left alone, got %s", source)
+	}
+}
+
+func TestLoadWithFlags(t *testing.T) {
+	path := writeConfigFile(t, `{"fetch_timeout": "45s", "robots_enabled": false}`)
+	t.Setenv("FETCH_TIMEOUT", "1m")
+
+	overrides := Overrides{}
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	overrides.RegisterFlags(fs)
+	if err := fs.Parse([]string{"-fetch-timeout", "2m", "-robots-enabled", "-trusted-proxies=10.0.0.0/8,192.168.0.1"}); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	cfg, err := LoadWithOverrides(path, overrides)
+	if err != nil {
+		t.Fatalf("LoadWithOverrides failed: %v", err)
+	}
+	if cfg.FetchTimeout != 2*time.Minute || !cfg.RobotsEnabled || len(cfg.TrustedProxies) != 2 {
+		t.Errorf("expected flags to take precedence, got %+v", cfg)
+	}
+	if source := cfg.Source("FETCH_TIMEOUT"); source != SourceFlag {
+		t.Errorf("expected the flag source, got %s", source)
+	}
+	if fs.Lookup("config-file") != nil || fs.Lookup("domains") != nil || fs.Lookup("max-results-in-memory") == nil {
+		t.Error("expected a flag for every environment variable but CONFIG_FILE")
+	}
+
+	_, err = LoadWithOverrides("", Overrides{"MAX_REDIRECTS": "many"})
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) || !slices.Equal(invalid.Problems, []string{`-max-redirects: invalid integer "many"`}) {
+		t.Errorf("expected the flag to be named in problems, got %v", err)
+	}
+}
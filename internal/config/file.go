@@ -0,0 +1,277 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// domainsKey is the config file section holding per-domain overrides
+const domainsKey = "domains"
+
+// DomainConfig overrides settings for requests to a domain and its
+// subdomains. Unset fields keep the global settings.
+type DomainConfig struct {
+	FetchTimeout   time.Duration     // Replaces FETCH_TIMEOUT
+	MaxRedirects   *int              // Replaces MAX_REDIRECTS
+	MaxContentSize int64             // Replaces MAX_CONTENT_SIZE
+	UserAgent      string            // Replaces USER_AGENT
+	Headers        map[string]string // Extra request headers
+	RateLimit      *int              // Egress requests per window; 0 leaves the domain unlimited
+	RateWindow     time.Duration     // Replaces EGRESS_RATE_WINDOW
+	Burst          int               // Replaces EGRESS_BURST
+}
+
+// fileDomain is a DomainConfig as written in the config file
+type fileDomain struct {
+	FetchTimeout   string            `json:"fetch_timeout,omitempty"`
+	MaxRedirects   *int              `json:"max_redirects,omitempty"`
+	MaxContentSize int64             `json:"max_content_size,omitempty"`
+	UserAgent      string            `json:"user_agent,omitempty"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	RateLimit      *int              `json:"rate_limit,omitempty"`
+	RateWindow     string            `json:"rate_window,omitempty"`
+	Burst          int               `json:"burst,omitempty"`
+}
+
+// loader reads settings from overrides, the environment and the config
+// file. Invalid values are collected as problems rather than replaced by
+// defaults.
+type loader struct {
+	overrides Overrides                  // Values taking precedence over the environment
+	file      map[string]json.RawMessage // Config file settings by file key
+	used      map[string]bool            // Keys of the settings read so far
+	sources   map[string]string          // Source of each setting not left at its default
+	problems  []string
+}
+
+// newLoader creates a loader reading the JSON config file at path, if any
+func newLoader(path string, overrides Overrides) (*loader, error) {
+	l := &loader{overrides: overrides, used: make(map[string]bool), sources: make(map[string]string)}
+	if path == "" {
+		return l, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	if err := json.Unmarshal(data, &l.file); err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// fileKey returns the config file key of an environment variable, e.g.
+// "fetch_timeout" for FETCH_TIMEOUT
+func fileKey(key string) string {
+	return strings.ToLower(key)
+}
+
+// fromFile decodes the config file's value of key into v and reports
+// whether it was set. A value of the wrong type is a problem.
+func (l *loader) fromFile(key string, v interface{}, expected string) bool {
+	fk := fileKey(key)
+	raw, ok := l.file[fk]
+	if !ok {
+		return false
+	}
+	l.used[fk] = true
+	if string(raw) == "null" {
+		return false
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		l.problem("%s in config file: expected %s, got %s", fk, expected, raw)
+		return false
+	}
+	l.sources[key] = SourceFile
+	return true
+}
+
+// lookup returns the value of key given as an override or in the
+// environment, and where it was given for problem reports. It marks the
+// setting's file key as known.
+func (l *loader) lookup(key string) (value, where string) {
+	l.used[fileKey(key)] = true
+	if value, ok := l.overrides[key]; ok {
+		l.sources[key] = SourceFlag
+		return value, "-" + flagName(key)
+	}
+	value = os.Getenv(key)
+	if value != "" {
+		l.sources[key] = SourceEnv
+	}
+	return value, key
+}
+
+func (l *loader) problem(format string, args ...interface{}) {
+	l.problems = append(l.problems, fmt.Sprintf(format, args...))
+}
+
+// str returns a string setting
+func (l *loader) str(key, defaultValue string) string {
+	if value, _ := l.lookup(key); value != "" {
+		return value
+	}
+	var value string
+	if l.fromFile(key, &value, "a string") {
+		return value
+	}
+	return defaultValue
+}
+
+// int returns an integer setting
+func (l *loader) int(key string, defaultValue int) int {
+	if value, where := l.lookup(key); value != "" {
+		intValue, err := strconv.Atoi(value)
+		if err != nil {
+			l.problem("%s: invalid integer %q", where, value)
+			return defaultValue
+		}
+		return intValue
+	}
+	var value int
+	if l.fromFile(key, &value, "an integer") {
+		return value
+	}
+	return defaultValue
+}
+
+// int64 returns a 64-bit integer setting
+func (l *loader) int64(key string, defaultValue int64) int64 {
+	if value, where := l.lookup(key); value != "" {
+		int64Value, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			l.problem("%s: invalid integer %q", where, value)
+			return defaultValue
+		}
+		return int64Value
+	}
+	var value int64
+	if l.fromFile(key, &value, "an integer") {
+		return value
+	}
+	return defaultValue
+}
+
+// bool returns a boolean setting
+func (l *loader) bool(key string, defaultValue bool) bool {
+	if value, where := l.lookup(key); value != "" {
+		boolValue, err := strconv.ParseBool(value)
+		if err != nil {
+			l.problem("%s: invalid boolean %q", where, value)
+			return defaultValue
+		}
+		return boolValue
+	}
+	var value bool
+	if l.fromFile(key, &value, "a boolean") {
+		return value
+	}
+	return defaultValue
+}
+
+// list returns a list setting: comma-separated in the environment, an array
+// of strings in the file. Empty items are dropped and surrounding whitespace
+// is trimmed.
+func (l *loader) list(key string, defaultValue []string) []string {
+	var items []string
+	if value, _ := l.lookup(key); value != "" {
+		items = strings.Split(value, ",")
+	} else if !l.fromFile(key, &items, "an array of strings") {
+		return defaultValue
+	}
+
+	var trimmed []string
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			trimmed = append(trimmed, item)
+		}
+	}
+	return trimmed
+}
+
+// duration returns a duration setting, written like "30s" or "1h30m"
+func (l *loader) duration(key string, defaultValue time.Duration) time.Duration {
+	value, where := l.lookup(key)
+	if value == "" {
+		if !l.fromFile(key, &value, "a duration string") {
+			return defaultValue
+		}
+		where = fileKey(key) + " in config file"
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		l.problem("%s: invalid duration %q", where, value)
+		return defaultValue
+	}
+	return duration
+}
+
+// domains returns the per-domain overrides of the config file, keyed by
+// lowercase domain
+func (l *loader) domains() map[string]DomainConfig {
+	raw, ok := l.file[domainsKey]
+	if !ok {
+		return nil
+	}
+	l.used[domainsKey] = true
+	l.sources[domainsKey] = SourceFile
+
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		l.problem("%s in config file: expected an object keyed by domain", domainsKey)
+		return nil
+	}
+
+	domains := make(map[string]DomainConfig, len(entries))
+	for _, name := range slices.Sorted(maps.Keys(entries)) {
+		var f fileDomain
+		dec := json.NewDecoder(bytes.NewReader(entries[name]))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&f); err != nil {
+			l.problem("%s.%s in config file: %v", domainsKey, name, err)
+			continue
+		}
+
+		d := DomainConfig{
+			MaxRedirects:   f.MaxRedirects,
+			MaxContentSize: f.MaxContentSize,
+			UserAgent:      f.UserAgent,
+			Headers:        f.Headers,
+			RateLimit:      f.RateLimit,
+			Burst:          f.Burst,
+		}
+		d.FetchTimeout = l.domainDuration(name, "fetch_timeout", f.FetchTimeout)
+		d.RateWindow = l.domainDuration(name, "rate_window", f.RateWindow)
+		domains[strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")] = d
+	}
+	return domains
+}
+
+// domainDuration parses a duration of a domain's overrides, 0 when unset
+func (l *loader) domainDuration(domain, key, value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		l.problem("%s.%s.%s in config file: invalid duration %q", domainsKey, domain, key, value)
+	}
+	return d
+}
+
+// unknownKeys reports config file keys that aren't settings, such as typos
+func (l *loader) unknownKeys() {
+	for _, key := range slices.Sorted(maps.Keys(l.file)) {
+		if !l.used[key] {
+			l.problem("%s in config file: unknown setting", key)
+		}
+	}
+}
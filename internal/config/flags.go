@@ -0,0 +1,56 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Overrides are setting values by key, written as in the environment, that
+// take precedence over the environment and the config file
+type Overrides map[string]string
+
+// flagName returns the command-line flag of a setting, e.g. "fetch-timeout"
+// for FETCH_TIMEOUT
+func flagName(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), "_", "-")
+}
+
+// RegisterFlags defines a flag on fs for every setting that has an
+// environment variable, except CONFIG_FILE, named like the variable in
+// lowercase with dashes: -fetch-timeout for FETCH_TIMEOUT. Flags take the
+// same values as the variables, and boolean flags may omit theirs. The
+// values of flags given on the command line are added to o.
+func (o Overrides) RegisterFlags(fs *flag.FlagSet) {
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := field.Tag.Get("env")
+		if key == "" || key == "CONFIG_FILE" || key == domainsKey {
+			continue
+		}
+		fs.Var(overrideFlag{overrides: o, key: key, isBool: field.Type.Kind() == reflect.Bool},
+			flagName(key), fmt.Sprintf("overrides $%s", key))
+	}
+}
+
+// overrideFlag records a flag's value as an override of its setting
+type overrideFlag struct {
+	overrides Overrides
+	key       string
+	isBool    bool
+}
+
+func (f overrideFlag) String() string {
+	return f.overrides[f.key]
+}
+
+func (f overrideFlag) Set(value string) error {
+	f.overrides[f.key] = value
+	return nil
+}
+
+func (f overrideFlag) IsBoolFlag() bool {
+	return f.isBool
+}
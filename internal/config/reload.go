@@ -0,0 +1,60 @@
+package config
+
+import (
+	"maps"
+	"reflect"
+)
+
+// Reload returns c with the live settings of next applied, along with the
+// keys of the changed settings that were applied and of those that only
+// take effect after a restart. Restart-only settings keep c's values, so
+// they are reported again by later reloads until the service restarts.
+func (c *Config) Reload(next *Config) (reloaded *Config, applied, restart []string) {
+	reloaded = new(Config)
+	*reloaded = *c
+	reloaded.sources = make(map[string]string)
+	maps.Copy(reloaded.sources, c.sources)
+
+	cur, nxt, out := reflect.ValueOf(c).Elem(), reflect.ValueOf(next).Elem(), reflect.ValueOf(reloaded).Elem()
+	for i := 0; i < cur.NumField(); i++ {
+		field := cur.Type().Field(i)
+		key := field.Tag.Get("env")
+		if key == "" || reflect.DeepEqual(cur.Field(i).Interface(), nxt.Field(i).Interface()) {
+			continue
+		}
+		if field.Tag.Get("reload") != "live" || !c.liveChange(key, next) {
+			restart = append(restart, key)
+			continue
+		}
+		out.Field(i).Set(nxt.Field(i))
+		reloaded.setSource(key, next.Source(key))
+		applied = append(applied, key)
+	}
+	return reloaded, applied, restart
+}
+
+// liveChange reports whether a change of the live setting key to next's
+// value can be applied without a restart
+func (c *Config) liveChange(key string, next *Config) bool {
+	switch key {
+	case "URL_RATE_LIMIT":
+		// The URL limiter is only created when enabled at startup
+		return (c.URLRateLimit > 0) == (next.URLRateLimit > 0)
+	case domainsKey:
+		// Outbound rate limits are fixed at startup, other overrides apply
+		// to new fetches
+		return reflect.DeepEqual(domainEgress(c.Domains), domainEgress(next.Domains))
+	}
+	return true
+}
+
+// domainEgress returns the outbound rate limit overrides of domains
+func domainEgress(domains map[string]DomainConfig) map[string]DomainConfig {
+	egress := make(map[string]DomainConfig)
+	for domain, d := range domains {
+		if d.RateLimit != nil {
+			egress[domain] = DomainConfig{RateLimit: d.RateLimit, RateWindow: d.RateWindow, Burst: d.Burst}
+		}
+	}
+	return egress
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Sources of setting values
+const (
+	SourceDefault = "default"
+	SourceEnv     = "env"
+	SourceFile    = "file"
+	SourceFlag    = "flag" // Command-line flag
+)
+
+// redactedValue replaces secrets in reported settings
+const redactedValue = "[REDACTED]"
+
+// Setting is the effective value of a setting
+type Setting struct {
+	Value      interface{} // Durations as strings, secrets redacted
+	Source     string      // One of the Source* constants
+	Reloadable bool        // Changes apply without a restart
+}
+
+// Source returns where the value of the setting key came from
+func (c *Config) Source(key string) string {
+	if source, ok := c.sources[key]; ok {
+		return source
+	}
+	return SourceDefault
+}
+
+// setSource records where the value of the setting key came from
+func (c *Config) setSource(key, source string) {
+	if source == SourceDefault {
+		delete(c.sources, key)
+		return
+	}
+	c.sources[key] = source
+}
+
+// Settings returns every setting by key, with secrets such as API keys,
+// passwords and domain headers redacted
+func (c *Config) Settings() map[string]Setting {
+	settings := make(map[string]Setting)
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		key := field.Tag.Get("env")
+		if key == "" {
+			continue
+		}
+		value := v.Field(i).Interface()
+		if field.Tag.Get("secret") == "true" {
+			value = redact(value)
+		}
+		if d, ok := value.(time.Duration); ok {
+			value = d.String()
+		}
+		settings[key] = Setting{
+			Value:      value,
+			Source:     c.Source(key),
+			Reloadable: field.Tag.Get("reload") == "live",
+		}
+	}
+	return settings
+}
+
+// redact returns a setting value with its secrets replaced: the password of
+// URLs, the key of "name:key:scopes" API key entries and the values of
+// domain headers
+func redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if u, err := url.Parse(v); err == nil && u.User != nil {
+			return u.Redacted()
+		}
+		return v
+	case []string:
+		redacted := make([]string, len(v))
+		for i, entry := range v {
+			parts := strings.Split(entry, ":")
+			if len(parts) > 1 {
+				parts[1] = redactedValue
+			}
+			redacted[i] = strings.Join(parts, ":")
+		}
+		return redacted
+	case map[string]DomainConfig:
+		domains := make(map[string]fileDomain, len(v))
+		for name, d := range v {
+			f := fileDomain{
+				MaxRedirects:   d.MaxRedirects,
+				MaxContentSize: d.MaxContentSize,
+				UserAgent:      d.UserAgent,
+				RateLimit:      d.RateLimit,
+				Burst:          d.Burst,
+			}
+			if d.FetchTimeout > 0 {
+				f.FetchTimeout = d.FetchTimeout.String()
+			}
+			if d.RateWindow > 0 {
+				f.RateWindow = d.RateWindow.String()
+			}
+			if len(d.Headers) > 0 {
+				f.Headers = make(map[string]string, len(d.Headers))
+				for header := range d.Headers {
+					f.Headers[header] = redactedValue
+				}
+			}
+			domains[name] = f
+		}
+		return domains
+	}
+	return value
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fetch/internal/ratelimit"
+	"fmt"
+	"log/slog"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ValidationError lists every invalid setting of a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid configuration: %s", strings.Join(e.Problems, "; "))
+}
+
+// Validate checks that settings are in range and consistent with each
+// other, returning a *ValidationError listing every problem
+func (c *Config) Validate() error {
+	if problems := c.problems(); len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// problems returns a description of each invalid setting
+func (c *Config) problems() []string {
+	var p []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			p = append(p, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.ServerAddress != "", "SERVER_ADDRESS must not be empty")
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.LogLevel)) == nil,
+		"LOG_LEVEL must be debug, info, warn or error, got %q", c.LogLevel)
+	check(strings.EqualFold(c.LogFormat, "json") || strings.EqualFold(c.LogFormat, "text"),
+		"LOG_FORMAT must be json or text, got %q", c.LogFormat)
+
+	check(c.FetchTimeout > 0, "FETCH_TIMEOUT must be positive, got %v", c.FetchTimeout)
+	check(c.MaxRedirects >= 0, "MAX_REDIRECTS must not be negative, got %d", c.MaxRedirects)
+	check(c.MaxContentSize > 0, "MAX_CONTENT_SIZE must be positive, got %d", c.MaxContentSize)
+	check(c.FetchConcurrency > 0, "FETCH_CONCURRENCY must be positive, got %d", c.FetchConcurrency)
+	check(c.UploadMaxBytes > 0, "UPLOAD_MAX_BYTES must be positive, got %d", c.UploadMaxBytes)
+	check(c.UploadMaxURLs > 0, "UPLOAD_MAX_URLS must be positive, got %d", c.UploadMaxURLs)
+
+	check(c.RateLimitRequests > 0, "RATE_LIMIT_REQUESTS must be positive, got %d", c.RateLimitRequests)
+	check(c.RateLimitWindow > 0, "RATE_LIMIT_WINDOW must be positive, got %v", c.RateLimitWindow)
+	check(c.RateLimitBurst > 0, "RATE_LIMIT_BURST must be positive, got %d", c.RateLimitBurst)
+	check(c.RateLimitBurst <= c.RateLimitRequests,
+		"RATE_LIMIT_BURST (%d) must not exceed RATE_LIMIT_REQUESTS (%d)", c.RateLimitBurst, c.RateLimitRequests)
+	switch c.RateLimitAlgorithm {
+	case ratelimit.AlgorithmFixedWindow, ratelimit.AlgorithmTokenBucket, ratelimit.AlgorithmSlidingLog,
+		ratelimit.AlgorithmSlidingWindow, ratelimit.AlgorithmGCRA:
+	default:
+		p = append(p, fmt.Sprintf("RATE_LIMIT_ALGORITHM must be one of %s, %s, %s, %s or %s, got %q",
+			ratelimit.AlgorithmFixedWindow, ratelimit.AlgorithmTokenBucket, ratelimit.AlgorithmSlidingLog,
+			ratelimit.AlgorithmSlidingWindow, ratelimit.AlgorithmGCRA, c.RateLimitAlgorithm))
+	}
+	check(c.RateLimitBackend == "memory" || c.RateLimitBackend == "redis",
+		"RATE_LIMIT_BACKEND must be memory or redis, got %q", c.RateLimitBackend)
+	check(c.RateLimitBackend != "redis" || c.RateLimitAlgorithm == ratelimit.AlgorithmGCRA ||
+		c.RateLimitAlgorithm == ratelimit.AlgorithmSlidingWindow,
+		"RATE_LIMIT_BACKEND redis supports RATE_LIMIT_ALGORITHM %s or %s, got %q",
+		ratelimit.AlgorithmGCRA, ratelimit.AlgorithmSlidingWindow, c.RateLimitAlgorithm)
+	check(c.RateLimitBackend != "redis" || c.RateLimitRedisTimeout > 0,
+		"RATE_LIMIT_REDIS_TIMEOUT must be positive, got %v", c.RateLimitRedisTimeout)
+	check(slices.Contains([]string{"x-forwarded-for", "forwarded", "x-real-ip"}, strings.ToLower(c.TrustedProxyHeader)),
+		"TRUSTED_PROXY_HEADER must be X-Forwarded-For, Forwarded or X-Real-IP, got %q", c.TrustedProxyHeader)
+	check(c.IPv6Prefix >= 0 && c.IPv6Prefix <= 128,
+		"RATE_LIMIT_IPV6_PREFIX must be between 0 and 128, got %d", c.IPv6Prefix)
+	check(c.URLRateLimit >= 0, "URL_RATE_LIMIT must not be negative, got %d", c.URLRateLimit)
+	check(c.DailyRequestQuota >= 0, "DAILY_REQUEST_QUOTA must not be negative, got %d", c.DailyRequestQuota)
+	check(c.DailyURLQuota >= 0, "DAILY_URL_QUOTA must not be negative, got %d", c.DailyURLQuota)
+
+	check(c.ResultTTL > 0, "RESULT_TTL must be positive, got %v", c.ResultTTL)
+	check(c.CleanupInterval > 0, "CLEANUP_INTERVAL must be positive, got %v", c.CleanupInterval)
+	check(c.MaxResultsInMemory > 0, "MAX_RESULTS_IN_MEMORY must be positive, got %d", c.MaxResultsInMemory)
+
+	check(c.ScheduleHistorySize > 0, "SCHEDULE_HISTORY_SIZE must be positive, got %d", c.ScheduleHistorySize)
+	check(c.MinScheduleInterval >= 0, "MIN_SCHEDULE_INTERVAL must not be negative, got %v", c.MinScheduleInterval)
+	for _, pattern := range c.ChangeIgnorePatterns {
+		_, err := regexp.Compile(pattern)
+		check(err == nil, "CHANGE_IGNORE_PATTERNS contains an invalid regex %q: %v", pattern, err)
+	}
+	check(c.CacheMaxEntries >= 0, "HTTP_CACHE_MAX_ENTRIES must not be negative, got %d", c.CacheMaxEntries)
+
+	check(c.CrawlMaxDepth >= 0, "CRAWL_MAX_DEPTH must not be negative, got %d", c.CrawlMaxDepth)
+	check(c.CrawlMaxPages > 0, "CRAWL_MAX_PAGES must be positive, got %d", c.CrawlMaxPages)
+	check(c.CrawlConcurrency > 0, "CRAWL_CONCURRENCY must be positive, got %d", c.CrawlConcurrency)
+	check(!c.RobotsEnabled || c.RobotsCacheTTL > 0, "ROBOTS_CACHE_TTL must be positive, got %v", c.RobotsCacheTTL)
+	check(c.SitemapMaxURLs > 0, "SITEMAP_MAX_URLS must be positive, got %d", c.SitemapMaxURLs)
+	check(c.LinkCheckMaxLinks > 0, "LINKCHECK_MAX_LINKS must be positive, got %d", c.LinkCheckMaxLinks)
+	check(c.LinkCheckConcurrency > 0, "LINKCHECK_CONCURRENCY must be positive, got %d", c.LinkCheckConcurrency)
+
+	check(c.EgressRateLimit >= 0, "EGRESS_RATE_LIMIT must not be negative, got %d", c.EgressRateLimit)
+	check(c.EgressRateWindow > 0, "EGRESS_RATE_WINDOW must be positive, got %v", c.EgressRateWindow)
+	check(c.EgressBurst > 0, "EGRESS_BURST must be positive, got %d", c.EgressBurst)
+	check(c.EgressRateLimit == 0 || c.EgressBurst <= c.EgressRateLimit,
+		"EGRESS_BURST (%d) must not exceed EGRESS_RATE_LIMIT (%d)", c.EgressBurst, c.EgressRateLimit)
+	check(c.EgressMaxWait >= 0, "EGRESS_MAX_WAIT must not be negative, got %v", c.EgressMaxWait)
+
+	check(!c.TracingEnabled || strings.HasPrefix(c.TracingEndpoint, "http://") || strings.HasPrefix(c.TracingEndpoint, "https://"),
+		"OTEL_EXPORTER_OTLP_ENDPOINT must be an http or https URL, got %q", c.TracingEndpoint)
+
+	for _, domain := range slices.Sorted(maps.Keys(c.Domains)) {
+		p = append(p, c.Domains[domain].problems(domain, c)...)
+	}
+	return p
+}
+
+// problems returns a description of each invalid override of domain
+func (d DomainConfig) problems(domain string, c *Config) []string {
+	var p []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			p = append(p, fmt.Sprintf("domains.%s.", domain)+fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(domain != "" && !strings.ContainsAny(domain, ":/ "), "domain must be a host name")
+	check(d.FetchTimeout >= 0, "fetch_timeout must be positive, got %v", d.FetchTimeout)
+	check(d.MaxRedirects == nil || *d.MaxRedirects >= 0, "max_redirects must not be negative")
+	check(d.MaxContentSize >= 0, "max_content_size must be positive, got %d", d.MaxContentSize)
+	check(d.RateWindow >= 0, "rate_window must be positive, got %v", d.RateWindow)
+	check(d.Burst >= 0, "burst must be positive, got %d", d.Burst)
+	if d.RateLimit != nil {
+		check(*d.RateLimit >= 0, "rate_limit must not be negative, got %d", *d.RateLimit)
+		burst := d.Burst
+		if burst == 0 {
+			burst = c.EgressBurst
+		}
+		check(*d.RateLimit == 0 || burst <= *d.RateLimit, "burst (%d) must not exceed rate_limit (%d)", burst, *d.RateLimit)
+	}
+	return p
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// API key scopes
+const (
+	ScopeSubmit = "submit" // Submit fetches, schedules, crawls and link checks
+	ScopeRead   = "read"   // Read results, jobs and statistics
+	ScopeAdmin  = "admin"  // Use /admin/* endpoints
+)
+
+// APIKey is a client credential and the scopes granted to it
+type APIKey struct {
+	Name   string   `json:"name"`
+	Key    string   `json:"key"`
+	Scopes []string `json:"scopes"`
+	Tenant string   `json:"tenant,omitempty"` // Defaults to the key name
+
+	DailyRequests int `json:"daily_requests,omitempty"` // Overrides DAILY_REQUEST_QUOTA
+	DailyURLs     int `json:"daily_urls,omitempty"`     // Overrides DAILY_URL_QUOTA
+}
+
+// Identity is the authenticated caller of a request
+type Identity struct {
+	Name   string
+	Tenant string // Results, jobs and stats are scoped to the tenant
+	Scopes map[string]bool
+
+	DailyRequests int // Daily quota overrides, 0 for the defaults
+	DailyURLs     int
+}
+
+// HasScope reports whether the identity was granted scope
+func (id *Identity) HasScope(scope string) bool {
+	return id.Scopes[scope]
+}
+
+type identityKey struct{}
+
+// IdentityFromContext returns the caller authenticated by the Authenticator,
+// or nil when authentication is disabled
+func IdentityFromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(identityKey{}).(*Identity)
+	return id
+}
+
+// tenantFromRequest returns the tenant of the authenticated caller, or the
+// default tenant "" when authentication is disabled
+func tenantFromRequest(r *http.Request) string {
+	if id := IdentityFromContext(r.Context()); id != nil {
+		return id.Tenant
+	}
+	return ""
+}
+
+// Authenticator checks API keys and enforces their scopes
+type Authenticator struct {
+	keys map[[sha256.Size]byte]*Identity // Keyed by hash so lookups don't compare secrets byte by byte
+}
+
+// NewAuthenticator validates keys and builds an authenticator. With no keys
+// authentication is disabled and every request is allowed.
+func NewAuthenticator(keys []APIKey) (*Authenticator, error) {
+	a := &Authenticator{keys: make(map[[sha256.Size]byte]*Identity)}
+	names := make(map[string]bool)
+
+	for _, k := range keys {
+		if k.Name == "" || k.Key == "" {
+			return nil, fmt.Errorf("API key requires a name and a key")
+		}
+		if names[k.Name] {
+			return nil, fmt.Errorf("duplicate API key name %q", k.Name)
+		}
+		names[k.Name] = true
+
+		hash := sha256.Sum256([]byte(k.Key))
+		if _, dup := a.keys[hash]; dup {
+			return nil, fmt.Errorf("API key %q duplicates another key", k.Name)
+		}
+
+		if k.DailyRequests < 0 || k.DailyURLs < 0 {
+			return nil, fmt.Errorf("API key %q has a negative daily quota", k.Name)
+		}
+
+		id := &Identity{
+			Name:          k.Name,
+			Tenant:        k.Tenant,
+			Scopes:        make(map[string]bool),
+			DailyRequests: k.DailyRequests,
+			DailyURLs:     k.DailyURLs,
+		}
+		if id.Tenant == "" {
+			id.Tenant = k.Name
+		}
+		for _, scope := range k.Scopes {
+			switch scope {
+			case ScopeSubmit, ScopeRead, ScopeAdmin:
+				id.Scopes[scope] = true
+			default:
+				return nil, fmt.Errorf("API key %q has unknown scope %q (expected submit, read or admin)", k.Name, scope)
+			}
+		}
+		if len(id.Scopes) == 0 {
+			return nil, fmt.Errorf("API key %q has no scopes", k.Name)
+		}
+		a.keys[hash] = id
+	}
+
+	return a, nil
+}
+
+// ParseAPIKeys parses "name:key:scope|scope" entries, as used by the API_KEYS
+// environment variable
+func ParseAPIKeys(entries []string) ([]APIKey, error) {
+	keys := make([]APIKey, 0, len(entries))
+	for i, entry := range entries {
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 {
+			// The entry itself is not included, as it may contain a secret
+			return nil, fmt.Errorf("invalid API key entry #%d (expected name:key:scopes)", i+1)
+		}
+		keys = append(keys, APIKey{
+			Name:   strings.TrimSpace(parts[0]),
+			Key:    strings.TrimSpace(parts[1]),
+			Scopes: strings.Split(strings.TrimSpace(parts[2]), "|"),
+		})
+	}
+	return keys, nil
+}
+
+// LoadAPIKeyFile reads a JSON array of API keys
+func LoadAPIKeyFile(path string) ([]APIKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API key file: %w", err)
+	}
+	var keys []APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse API key file %s: %w", path, err)
+	}
+	return keys, nil
+}
+
+// Enabled reports whether any API keys are configured
+func (a *Authenticator) Enabled() bool {
+	return len(a.keys) > 0
+}
+
+// Middleware authenticates requests and enforces the scope each one needs.
+// Rejected requests get 401 without a valid key and 403 without the scope.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope := requiredScope(r)
+		if !a.Enabled() || scope == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := requestAPIKey(r)
+		if key == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="fetch"`)
+			writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+				"error": "API key required",
+			})
+			return
+		}
+
+		id, ok := a.keys[sha256.Sum256([]byte(key))]
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="fetch", error="invalid_token"`)
+			writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+				"error": "Invalid API key",
+			})
+			return
+		}
+
+		if !id.HasScope(scope) {
+			slog.InfoContext(r.Context(), "API key lacks scope",
+				"key", id.Name, "method", r.Method, "path", r.URL.Path, "scope", scope)
+			writeJSON(w, http.StatusForbidden, map[string]interface{}{
+				"error": fmt.Sprintf("API key lacks the %s scope", scope),
+			})
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, id)))
+	})
+}
+
+// requiredScope returns the scope a request needs, or "" for public endpoints
+func requiredScope(r *http.Request) string {
+	switch {
+	case r.URL.Path == "/health":
+		return ""
+	case strings.HasPrefix(r.URL.Path, "/admin/"):
+		return ScopeAdmin
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return ScopeRead
+	default:
+		return ScopeSubmit
+	}
+}
+
+// requestAPIKey extracts the key from "Authorization: Bearer" or X-API-Key
+func requestAPIKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		scheme, token, ok := strings.Cut(auth, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fetch/cmd/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthMiddlewareScopes(t *testing.T) {
+	keys, err := ParseAPIKeys([]string{"reader:read-key:read", "ops:ops-key:read|submit|admin"})
+	if err != nil {
+		t.Fatalf("ParseAPIKeys failed: %v", err)
+	}
+	auth, err := NewAuthenticator(keys)
+	if err != nil {
+		t.Fatalf("NewAuthenticator failed: %v", err)
+	}
+
+	var identity *Identity
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity = IdentityFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+	server := auth.Middleware(next)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		header   string
+		value    string
+		expected int
+	}{
+		{"health is public", "GET", "/health", "", "", http.StatusOK},
+		{"missing key", "GET", "/fetch", "", "", http.StatusUnauthorized},
+		{"unknown key", "GET", "/fetch", "X-API-Key", "nope", http.StatusUnauthorized},
+		{"read with bearer", "GET", "/fetch", "Authorization", "Bearer read-key", http.StatusOK},
+		{"read with header", "GET", "/stats", "X-API-Key", "read-key", http.StatusOK},
+		{"submit without scope", "POST", "/fetch", "X-API-Key", "read-key", http.StatusForbidden},
+		{"admin without scope", "POST", "/admin/clear", "X-API-Key", "read-key", http.StatusForbidden},
+		{"admin with scope", "POST", "/admin/clear", "Authorization", "bearer ops-key", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.header != "" {
+			req.Header.Set(tt.header, tt.value)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.expected, w.Code)
+		}
+		if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: expected WWW-Authenticate header on 401", tt.name)
+		}
+	}
+
+	if identity == nil || identity.Name != "ops" {
+		t.Errorf("expected the last request to carry the ops identity, got %+v", identity)
+	}
+}
+
+func TestAuthDisabledWithoutKeys(t *testing.T) {
+	auth, err := NewAuthenticator(nil)
+	if err != nil {
+		t.Fatalf("NewAuthenticator failed: %v", err)
+	}
+
+	server := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("POST", "/admin/clear", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected open access without keys, got status %d", w.Code)
+	}
+}
+
+func TestAuthInvalidKeys(t *testing.T) {
+	if _, err := ParseAPIKeys([]string{"missing-scopes"}); err == nil {
+		t.Error("expected error for malformed API_KEYS entry")
+	}
+
+	for _, keys := range [][]APIKey{
+		{{Name: "a", Key: "k", Scopes: []string{"write"}}},
+		{{Name: "a", Key: "k"}},
+		{{Name: "a", Key: "k", Scopes: []string{"read"}}, {Name: "b", Key: "k", Scopes: []string{"read"}}},
+	} {
+		if _, err := NewAuthenticator(keys); err == nil {
+			t.Errorf("expected error for keys %+v", keys)
+		}
+	}
+}
+
+func TestTenantIsolationThroughAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("page"))
+	}))
+	defer server.Close()
+
+	svc := createTestService()
+	defer svc.Stop()
+
+	keys, _ := ParseAPIKeys([]string{"team-a:key-a:read|submit|admin", "team-b:key-b:read|submit|admin"})
+	auth, err := NewAuthenticator(keys)
+	if err != nil {
+		t.Fatalf("NewAuthenticator failed: %v", err)
+	}
+	handler := NewHandler(svc, 100, "1m")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fetch", handler.HandleFetch)
+	mux.HandleFunc("/admin/clear", handler.HandleAdminClear)
+	app := auth.Middleware(mux)
+
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("POST", "/fetch", "key-a", `{"urls": ["`+server.URL+`"]}`); w.Code != http.StatusAccepted {
+		t.Fatalf("expected submit to succeed, got %d", w.Code)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	var results models.FetchResponse
+	json.NewDecoder(do("GET", "/fetch", "key-b", "").Body).Decode(&results)
+	if results.TotalURLs != 0 {
+		t.Errorf("expected team-b to see no results, got %d", results.TotalURLs)
+	}
+
+	// team-b clearing must not affect team-a
+	do("POST", "/admin/clear", "key-b", "")
+	json.NewDecoder(do("GET", "/fetch", "key-a", "").Body).Decode(&results)
+	if results.TotalURLs != 1 {
+		t.Errorf("expected team-a to still see its result, got %d", results.TotalURLs)
+	}
+}
@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fetch/internal/metrics"
+	"fetch/internal/ratelimit"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Budgets are per-caller limits on fetch submissions, on top of the
+// request rate limit. Nil fields disable the corresponding limit.
+type Budgets struct {
+	URLLimiter    *ratelimit.RateLimiter // URLs submitted per rate limit window
+	URLLimit      int                    // URLLimiter's per-window limit, for error messages
+	DailyRequests *ratelimit.DailyQuota  // Submissions per UTC day
+	DailyURLs     *ratelimit.DailyQuota  // URLs submitted per UTC day
+}
+
+// SetBudgets enables URL and daily budgets for fetch submissions
+func (h *Handler) SetBudgets(b Budgets) {
+	h.budgets = b
+	if b.URLLimiter != nil {
+		h.service.Metrics().NewGaugeFunc("fetch_rate_limit_active_keys", "Callers tracked by a rate limiter.",
+			metrics.Labels{"limiter": "urls"},
+			func() float64 { return float64(b.URLLimiter.Len()) })
+	}
+}
+
+// rateLimitKey identifies the caller for rate limiting: the API key when
+// authenticated, the client IP (IPv6 clients by network prefix) otherwise
+func (h *Handler) rateLimitKey(r *http.Request) string {
+	if id := IdentityFromContext(r.Context()); id != nil {
+		return "key:" + id.Name
+	}
+	return "ip:" + h.proxies.RateLimitBucket(h.getIPFromRequest(r))
+}
+
+// dailyLimits returns the caller's daily quota overrides, 0 for the defaults
+func dailyLimits(r *http.Request) (requests, urls int) {
+	if id := IdentityFromContext(r.Context()); id != nil {
+		return id.DailyRequests, id.DailyURLs
+	}
+	return 0, 0
+}
+
+// useSubmissionBudgets charges a request that starts fetching up to n URLs
+// against the caller's request rate limit, daily request quota and URL
+// budgets, writing the rejection when one of them is exhausted. Call it
+// only once the request is known to be valid, so that invalid requests
+// use up nothing.
+func (h *Handler) useSubmissionBudgets(w http.ResponseWriter, r *http.Request, n int) bool {
+	key := h.rateLimitKey(r)
+	return h.useRequestLimit(w, r, key) && h.useDailyRequest(w, r, key) && h.useURLBudget(w, r, key, n)
+}
+
+// useRequestLimit counts a request against the caller's request rate
+// limit, writing a 429 response when it is exhausted
+func (h *Handler) useRequestLimit(w http.ResponseWriter, r *http.Request, key string) bool {
+	rateLimiter := h.service.GetRateLimiter()
+	decision := rateLimiter.Take(key, 1)
+	setRateLimitHeaders(w, decision, rateLimiter.Window())
+	if decision.Allowed {
+		return true
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(decision.RetryAfter)))
+	w.Header().Set("Content-Type", "application/json")
+	requests, _, window := h.rateLimits()
+	w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", requests))
+	w.Header().Set("X-RateLimit-Window", window)
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":   "Rate limit exceeded",
+		"message": fmt.Sprintf("Maximum %d requests per %s allowed", requests, window),
+	})
+	slog.InfoContext(r.Context(), "Rate limit exceeded", "caller", key)
+	h.rejections.Inc("requests")
+	return false
+}
+
+// useDailyRequest counts a submission against the caller's daily request
+// quota, writing a 429 response when it is exhausted
+func (h *Handler) useDailyRequest(w http.ResponseWriter, r *http.Request, key string) bool {
+	if h.budgets.DailyRequests == nil {
+		return true
+	}
+	limit, _ := dailyLimits(r)
+	remaining, ok := h.budgets.DailyRequests.Use(key, 1, limit)
+	setQuotaHeader(w, "X-Quota-Requests-Remaining", remaining, h.budgets.DailyRequests.Reset())
+	if !ok {
+		slog.InfoContext(r.Context(), "Daily request quota exceeded", "caller", key)
+		h.rejections.Inc("daily_requests")
+		w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(time.Until(h.budgets.DailyRequests.Reset()))))
+		writeJSON(w, http.StatusTooManyRequests, map[string]interface{}{
+			"error":   "Daily request quota exceeded",
+			"message": "The daily request quota resets at midnight UTC",
+		})
+	}
+	return ok
+}
+
+// urlBudgetError is a rejection by the per-window or daily URL budget
+type urlBudgetError struct {
+	status     int           // 413 when no retry can succeed, 429 otherwise
+	title      string        // "error" of the response
+	message    string        // "message" of the response
+	retryAfter time.Duration // Retry-After of a 429
+	remaining  int           // Remaining daily URL quota, -1 when not reported
+	reset      time.Time     // When the daily URL quota resets
+}
+
+// Error describes the rejection, as recorded for skipped schedule runs
+func (e *urlBudgetError) Error() string {
+	return e.title + ": " + e.message
+}
+
+// useURLBudget counts n submitted URLs against the caller's per-window and
+// daily URL budgets, writing a 429 response when either is exhausted and a
+// 413 response when n exceeds what either allows at all
+func (h *Handler) useURLBudget(w http.ResponseWriter, r *http.Request, key string, n int) bool {
+	_, dailyLimit := dailyLimits(r)
+	remaining, rejected := h.takeURLs(r.Context(), key, dailyLimit, n)
+	if rejected != nil {
+		writeURLBudgetError(w, rejected)
+		return false
+	}
+	if h.budgets.DailyURLs != nil {
+		setQuotaHeader(w, "X-Quota-URLs-Remaining", remaining, h.budgets.DailyURLs.Reset())
+	}
+	return true
+}
+
+// urlBudget returns a function charging n URLs to the caller of r, for
+// fetches started after the request, such as schedule runs
+func (h *Handler) urlBudget(r *http.Request) func(n int) error {
+	key := h.rateLimitKey(r)
+	_, dailyLimit := dailyLimits(r)
+	return func(n int) error {
+		if _, rejected := h.takeURLs(context.Background(), key, dailyLimit, n); rejected != nil {
+			return rejected
+		}
+		return nil
+	}
+}
+
+// takeURLs counts n URLs against key's per-window and daily URL budgets and
+// returns the remaining daily quota, -1 if unlimited
+func (h *Handler) takeURLs(ctx context.Context, key string, dailyLimit, n int) (int, *urlBudgetError) {
+	if rejected := h.oversized(ctx, key, dailyLimit, n); rejected != nil {
+		return -1, rejected
+	}
+
+	// Check the daily quota before taking from the window, so a submission
+	// it rejects doesn't use up the window's budget
+	if h.budgets.DailyURLs != nil {
+		if remaining := h.budgets.DailyURLs.Remaining(key, dailyLimit); remaining >= 0 && n > remaining {
+			return remaining, h.dailyURLsExceeded(ctx, key, n, remaining)
+		}
+	}
+
+	if h.budgets.URLLimiter != nil && n > 0 {
+		if d := h.budgets.URLLimiter.Take(key, n); !d.Allowed {
+			return -1, h.urlRateLimited(ctx, key, n, d.RetryAfter)
+		}
+	}
+
+	if h.budgets.DailyURLs == nil {
+		return -1, nil
+	}
+	remaining, ok := h.budgets.DailyURLs.Use(key, n, dailyLimit)
+	if !ok {
+		return remaining, h.dailyURLsExceeded(ctx, key, n, remaining)
+	}
+	return remaining, nil
+}
+
+// checkURLBudget rejects n URLs that key's per-window or daily URL budgets
+// can't cover right now, without taking any of them
+func (h *Handler) checkURLBudget(ctx context.Context, key string, dailyLimit, n int) *urlBudgetError {
+	if rejected := h.oversized(ctx, key, dailyLimit, n); rejected != nil {
+		return rejected
+	}
+	if h.budgets.DailyURLs != nil {
+		if remaining := h.budgets.DailyURLs.Remaining(key, dailyLimit); remaining >= 0 && n > remaining {
+			return h.dailyURLsExceeded(ctx, key, n, remaining)
+		}
+	}
+	if h.budgets.URLLimiter != nil {
+		if d := h.budgets.URLLimiter.Peek(key); n > d.Remaining {
+			return h.urlRateLimited(ctx, key, n, d.Reset)
+		}
+	}
+	return nil
+}
+
+// oversized rejects n URLs with a 413 when they exceed a whole per-window
+// or daily URL budget, since retrying them can never succeed
+func (h *Handler) oversized(ctx context.Context, key string, dailyLimit, n int) *urlBudgetError {
+	capacity, per := 0, ""
+	if h.budgets.URLLimiter != nil && n > h.budgets.URLLimiter.Limit() {
+		_, _, window := h.rateLimits()
+		capacity, per = h.budgets.URLLimiter.Limit(), window
+	} else if h.budgets.DailyURLs != nil {
+		if limit := h.budgets.DailyURLs.Limit(dailyLimit); limit > 0 && n > limit {
+			capacity, per = limit, "day"
+		}
+	}
+	if capacity == 0 {
+		return nil
+	}
+	slog.InfoContext(ctx, "Submission exceeds URL budget", "caller", key, "urls", n, "limit", capacity)
+	h.rejections.Inc("urls")
+	return &urlBudgetError{
+		status:    http.StatusRequestEntityTooLarge,
+		title:     "Too many URLs",
+		message:   fmt.Sprintf("At most %d URLs can be submitted per %s; split the submission", capacity, per),
+		remaining: -1,
+	}
+}
+
+// urlRateLimited is the rejection of n URLs that exceed the caller's
+// remaining per-window URL budget
+func (h *Handler) urlRateLimited(ctx context.Context, key string, n int, retryAfter time.Duration) *urlBudgetError {
+	_, urls, window := h.rateLimits()
+	slog.InfoContext(ctx, "URL rate limit exceeded", "caller", key, "urls", n)
+	h.rejections.Inc("urls")
+	return &urlBudgetError{
+		status:     http.StatusTooManyRequests,
+		title:      "URL rate limit exceeded",
+		message:    fmt.Sprintf("Maximum %d URLs per %s allowed", urls, window),
+		retryAfter: retryAfter,
+		remaining:  -1,
+	}
+}
+
+// dailyURLsExceeded is the rejection of n URLs that don't fit into the
+// caller's remaining daily URL quota
+func (h *Handler) dailyURLsExceeded(ctx context.Context, key string, n, remaining int) *urlBudgetError {
+	slog.InfoContext(ctx, "Daily URL quota exceeded", "caller", key, "urls", n, "remaining", remaining)
+	h.rejections.Inc("daily_urls")
+	reset := h.budgets.DailyURLs.Reset()
+	return &urlBudgetError{
+		status:     http.StatusTooManyRequests,
+		title:      "Daily URL quota exceeded",
+		message:    fmt.Sprintf("%d URLs remaining today; the quota resets at midnight UTC", remaining),
+		retryAfter: time.Until(reset),
+		remaining:  remaining,
+		reset:      reset,
+	}
+}
+
+// writeURLBudgetError writes the response rejecting a submission
+func writeURLBudgetError(w http.ResponseWriter, e *urlBudgetError) {
+	if e.status == http.StatusTooManyRequests {
+		w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(e.retryAfter)))
+	}
+	setQuotaHeader(w, "X-Quota-URLs-Remaining", e.remaining, e.reset)
+	writeJSON(w, e.status, map[string]interface{}{
+		"error":   e.title,
+		"message": e.message,
+	})
+}
+
+// setQuotaHeader reports a remaining daily budget and the seconds until it
+// resets. Unlimited budgets (remaining < 0) are not reported.
+func setQuotaHeader(w http.ResponseWriter, name string, remaining int, reset time.Time) {
+	if remaining < 0 {
+		return
+	}
+	w.Header().Set(name, strconv.Itoa(remaining))
+	w.Header().Set("X-Quota-Reset", strconv.Itoa(ceilSeconds(time.Until(reset))))
+}
+
+// RateLimitHeaders adds the caller's current request budget to every
+// response. Handlers that consume budget overwrite the headers afterwards.
+func (h *Handler) RateLimitHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rateLimiter := h.service.GetRateLimiter()
+		setRateLimitHeaders(w, rateLimiter.Peek(h.rateLimitKey(r)), rateLimiter.Window())
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setRateLimitHeaders writes the RateLimit-* headers of the IETF
+// draft-ietf-httpapi-ratelimit-headers format
+func setRateLimitHeaders(w http.ResponseWriter, d ratelimit.Decision, window time.Duration) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(d.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(d.Reset)))
+	w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", d.Limit, ceilSeconds(window)))
+}
+
+// ceilSeconds rounds a duration up to whole seconds, as header values
+// must not promise a budget earlier than it becomes available
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"fetch/internal/ratelimit"
+	"fetch/internal/service"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHandlePostFetchSitemapBudget(t *testing.T) {
+	var hits atomic.Int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.URL.Path == "/sitemap.xml" {
+			w.Write([]byte(`<urlset><url><loc>` + server.URL + `/a</loc></url></urlset>`))
+			return
+		}
+		w.Write([]byte("page"))
+	}))
+	defer server.Close()
+
+	handler := createTestHandler()
+	handler.SetBudgets(Budgets{URLLimiter: ratelimit.NewRateLimiter(10, 10, time.Minute), URLLimit: 10})
+
+	submit := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/fetch", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.HandlePostFetch(w, req)
+		return w
+	}
+
+	// Without max_urls the sitemap may expand past the budget; it is
+	// rejected before anything is fetched
+	w := submit(`{"sitemap": {"url": "` + server.URL + `/sitemap.xml"}}`)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusRequestEntityTooLarge, w.Code, w.Body.String())
+	}
+	if n := hits.Load(); n != 0 {
+		t.Errorf("expected no requests to the site, got %d", n)
+	}
+
+	// max_urls must fit the budget, but only the URLs found are charged
+	body := `{"sitemap": {"url": "` + server.URL + `/sitemap.xml", "max_urls": 8}}`
+	for i := range 3 {
+		if w := submit(body); w.Code != http.StatusAccepted {
+			t.Fatalf("submission %d: expected status %d, got %d: %s", i+1, http.StatusAccepted, w.Code, w.Body.String())
+		}
+	}
+	if w := submit(body); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d once max_urls no longer fits, got %d", http.StatusTooManyRequests, w.Code)
+	}
+
+	// A sitemap that fails to load costs no URLs
+	if w := submit(`{"sitemap": {"url": "` + server.URL + `/missing.xml", "max_urls": 7}}`); w.Code != http.StatusBadGateway {
+		t.Errorf("expected status %d for a missing sitemap, got %d", http.StatusBadGateway, w.Code)
+	}
+	if w := submit(`{"sitemap": {"url": "` + server.URL + `/sitemap.xml", "max_urls": 7}}`); w.Code != http.StatusAccepted {
+		t.Errorf("expected the failed sitemap not to use the budget, got %d", w.Code)
+	}
+}
+
+func TestHandlePostFetchURLBudgets(t *testing.T) {
+	handler := createTestHandler()
+	handler.SetBudgets(Budgets{
+		URLLimiter: ratelimit.NewRateLimiter(3, 3, time.Minute),
+		URLLimit:   3,
+		DailyURLs:  ratelimit.NewDailyQuota(100),
+	})
+
+	submit := func(urls string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/fetch", strings.NewReader(`{"urls": [`+urls+`]}`))
+		w := httptest.NewRecorder()
+		handler.HandlePostFetch(w, req)
+		return w
+	}
+
+	w := submit(`"https://example.com/1", "https://example.com/2"`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d", http.StatusAccepted, w.Code)
+	}
+	if remaining := w.Header().Get("X-Quota-URLs-Remaining"); remaining != "98" {
+		t.Errorf("expected 98 URLs remaining today, got %q", remaining)
+	}
+	if w.Header().Get("X-Quota-Reset") == "" {
+		t.Error("expected X-Quota-Reset header")
+	}
+
+	// Only one URL is left in the current window
+	w = submit(`"https://example.com/3", "https://example.com/4"`)
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d once the URL budget is spent, got %d", http.StatusTooManyRequests, w.Code)
+	}
+}
+
+func TestHandlePostFetchOversizedBatch(t *testing.T) {
+	urlLimiter := ratelimit.NewRateLimiter(10, 10, time.Minute)
+	handler := createTestHandler()
+	handler.SetBudgets(Budgets{
+		URLLimiter: urlLimiter,
+		URLLimit:   10,
+		DailyURLs:  ratelimit.NewDailyQuota(3),
+	})
+
+	submit := func(n int) *httptest.ResponseRecorder {
+		urls := make([]string, n)
+		for i := range urls {
+			urls[i] = fmt.Sprintf(`"http://127.0.0.1:1/%d"`, i)
+		}
+		req := httptest.NewRequest("POST", "/fetch", strings.NewReader(`{"urls": [`+strings.Join(urls, ",")+`]}`))
+		w := httptest.NewRecorder()
+		handler.HandlePostFetch(w, req)
+		return w
+	}
+
+	// More URLs than the daily quota allows can never be accepted
+	w := submit(11)
+	if w.Code != http.StatusRequestEntityTooLarge || w.Header().Get("Retry-After") != "" {
+		t.Errorf("expected 413 without Retry-After, got %d (Retry-After %q)", w.Code, w.Header().Get("Retry-After"))
+	}
+	w = submit(4)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for a batch above the daily quota, got %d", w.Code)
+	}
+
+	if w = submit(2); w.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d", http.StatusAccepted, w.Code)
+	}
+	// A submission rejected by the daily quota leaves the window's budget alone
+	if w = submit(2); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 once the daily quota is spent, got %d", w.Code)
+	}
+	if remaining := urlLimiter.Peek("ip:192.0.2.1").Remaining; remaining != 8 {
+		t.Errorf("expected 8 URLs left in the window, got %d", remaining)
+	}
+}
+
+func TestHandlePostFetchDailyRequestQuota(t *testing.T) {
+	handler := createTestHandler()
+	handler.SetBudgets(Budgets{
+		DailyRequests: ratelimit.NewDailyQuota(1),
+	})
+
+	for i, expected := range []int{http.StatusAccepted, http.StatusTooManyRequests} {
+		req := httptest.NewRequest("POST", "/fetch", strings.NewReader(`{"urls": ["https://example.com"]}`))
+		w := httptest.NewRecorder()
+		handler.HandlePostFetch(w, req)
+
+		if w.Code != expected {
+			t.Errorf("request %d: expected status %d, got %d", i+1, expected, w.Code)
+		}
+		if remaining := w.Header().Get("X-Quota-Requests-Remaining"); remaining != "0" {
+			t.Errorf("request %d: expected 0 requests remaining, got %q", i+1, remaining)
+		}
+	}
+}
+
+func TestJobEndpointsUseURLBudgets(t *testing.T) {
+	handler := createTestHandler()
+	handler.SetBudgets(Budgets{
+		URLLimiter: ratelimit.NewRateLimiter(5, 5, time.Minute),
+		URLLimit:   5,
+		DailyURLs:  ratelimit.NewDailyQuota(100),
+	})
+
+	post := func(endpoint http.HandlerFunc, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		endpoint(w, req)
+		return w
+	}
+
+	// A crawl is charged its max_pages, a link check its pages and link targets
+	if w := post(handler.HandleCrawl, "/crawl", `{"seeds": ["http://127.0.0.1:1/"], "max_pages": 10}`); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for a crawl larger than the URL budget, got %d", w.Code)
+	}
+	if w := post(handler.HandleCrawl, "/crawl", `{"seeds": ["http://127.0.0.1:1/"], "max_pages": 3}`); w.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d", http.StatusAccepted, w.Code)
+	}
+	if w := post(handler.HandleLinkCheck, "/linkcheck", `{"pages": ["http://127.0.0.1:1/"], "max_links": 1}`); w.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d", http.StatusAccepted, w.Code)
+	}
+	w := post(handler.HandleLinkCheck, "/linkcheck", `{"pages": ["http://127.0.0.1:1/"], "max_links": 1}`)
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 once the URL budget is spent, got %d", w.Code)
+	}
+
+	// Schedules that can never fit the budget are rejected up front
+	urls := make([]string, 6)
+	for i := range urls {
+		urls[i] = fmt.Sprintf(`"http://127.0.0.1:1/%d"`, i)
+	}
+	w = post(handler.HandleSchedules, "/schedules", `{"urls": [`+strings.Join(urls, ",")+`], "interval": "1h"}`)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for a schedule larger than the URL budget, got %d", w.Code)
+	}
+}
+
+func TestRejectedBodyKeepsDailyQuota(t *testing.T) {
+	handler := createTestHandler()
+	handler.SetBudgets(Budgets{
+		DailyRequests: ratelimit.NewDailyQuota(1),
+	})
+
+	for _, body := range []string{"invalid json", `{"urls": []}`} {
+		req := httptest.NewRequest("POST", "/fetch", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.HandlePostFetch(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status %d for %q, got %d", http.StatusBadRequest, body, w.Code)
+		}
+	}
+	req := httptest.NewRequest("POST", "/crawl", strings.NewReader(`{"seeds": []}`))
+	w := httptest.NewRecorder()
+	handler.HandleCrawl(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d for a crawl without seeds, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/fetch", strings.NewReader(`{"urls": ["http://127.0.0.1:1/"]}`))
+	w = httptest.NewRecorder()
+	handler.HandlePostFetch(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Errorf("expected the quota to survive rejected bodies, got %d", w.Code)
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	cfg := service.Config{
+		FetchTimeout:       5 * time.Second,
+		ResultTTL:          1 * time.Hour,
+		CleanupInterval:    10 * time.Minute,
+		MaxResultsInMemory: 100,
+	}
+	svc := service.NewFetchService(cfg, ratelimit.NewRateLimiter(1, 1, time.Minute))
+	handler := NewHandler(svc, 1, "1m")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fetch", handler.HandleFetch)
+	server := handler.RateLimitHeaders(mux)
+
+	req := httptest.NewRequest("GET", "/fetch", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Header().Get("RateLimit-Limit") != "1" || w.Header().Get("RateLimit-Remaining") != "1" {
+		t.Errorf("expected full budget on a GET, got limit %q remaining %q",
+			w.Header().Get("RateLimit-Limit"), w.Header().Get("RateLimit-Remaining"))
+	}
+	if policy := w.Header().Get("RateLimit-Policy"); policy != "1;w=60" {
+		t.Errorf("expected policy 1;w=60, got %q", policy)
+	}
+
+	for i, expected := range []int{http.StatusAccepted, http.StatusTooManyRequests} {
+		req := httptest.NewRequest("POST", "/fetch", strings.NewReader(`{"urls": ["https://example.com"]}`))
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		if w.Code != expected {
+			t.Fatalf("request %d: expected status %d, got %d", i+1, expected, w.Code)
+		}
+		if remaining := w.Header().Get("RateLimit-Remaining"); remaining != "0" {
+			t.Errorf("request %d: expected 0 remaining, got %q", i+1, remaining)
+		}
+		if reset := w.Header().Get("RateLimit-Reset"); reset == "" || reset == "0" {
+			t.Errorf("request %d: expected a reset time, got %q", i+1, reset)
+		}
+	}
+
+	if retry := w.Header().Get("Retry-After"); retry != "" {
+		t.Errorf("expected no Retry-After on allowed requests, got %q", retry)
+	}
+	req = httptest.NewRequest("POST", "/fetch", strings.NewReader(`{"urls": ["https://example.com"]}`))
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if retry := w.Header().Get("Retry-After"); retry == "" || retry == "0" {
+		t.Errorf("expected Retry-After on 429, got %q", retry)
+	}
+}
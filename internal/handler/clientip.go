@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// defaultIPv6Prefix is the prefix length IPv6 clients are bucketed by for
+// rate limiting, as a single host usually controls a whole /64
+const defaultIPv6Prefix = 64
+
+// TrustedProxies resolves the client IP of requests that pass through
+// reverse proxies. Forwarding headers are only believed when they were
+// added by a trusted proxy; a nil or empty TrustedProxies ignores them.
+type TrustedProxies struct {
+	prefixes   []netip.Prefix
+	header     string // Canonical name of the forwarding header the proxies set
+	ipv6Prefix int    // Rate limit bucket size for IPv6 clients
+}
+
+// ParseTrustedProxies parses CIDRs or single IPs, as used by the
+// TRUSTED_PROXIES environment variable. Only header, which the proxies set
+// (X-Forwarded-For, Forwarded or X-Real-IP; "" for X-Forwarded-For), is
+// read. IPv6 clients are bucketed by ipv6Prefix bits for rate limiting (0
+// for the default /64).
+func ParseTrustedProxies(entries []string, ipv6Prefix int, header string) (*TrustedProxies, error) {
+	if ipv6Prefix == 0 {
+		ipv6Prefix = defaultIPv6Prefix
+	}
+	if ipv6Prefix < 1 || ipv6Prefix > 128 {
+		return nil, fmt.Errorf("invalid IPv6 prefix length %d (expected 1-128)", ipv6Prefix)
+	}
+	if header == "" {
+		header = "X-Forwarded-For"
+	}
+	header = http.CanonicalHeaderKey(header)
+	if header != "X-Forwarded-For" && header != "Forwarded" && header != "X-Real-Ip" {
+		return nil, fmt.Errorf("invalid forwarding header %q (expected X-Forwarded-For, Forwarded or X-Real-IP)", header)
+	}
+
+	tp := &TrustedProxies{header: header, ipv6Prefix: ipv6Prefix}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+			}
+			addr = addr.Unmap()
+			tp.prefixes = append(tp.prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		if prefix.Addr().Is4In6() {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), max(prefix.Bits()-96, 0))
+		}
+		tp.prefixes = append(tp.prefixes, prefix.Masked())
+	}
+	return tp, nil
+}
+
+// Len returns the number of trusted proxy ranges
+func (tp *TrustedProxies) Len() int {
+	if tp == nil {
+		return 0
+	}
+	return len(tp.prefixes)
+}
+
+// trusts reports whether addr belongs to a trusted proxy
+func (tp *TrustedProxies) trusts(addr netip.Addr) bool {
+	if tp == nil {
+		return false
+	}
+	for _, prefix := range tp.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the IP of the client that sent r. The connection's peer
+// is the client unless it is a trusted proxy, in which case the proxies'
+// forwarding header is walked right to left, the order proxies append to
+// it, until the first hop that is not a trusted proxy. Everything left of
+// that hop was supplied by the client and is ignored.
+//
+// Other forwarding headers are ignored: a proxy that only appends to
+// X-Forwarded-For passes a Forwarded header sent by the client unchanged.
+func (tp *TrustedProxies) ClientIP(r *http.Request) string {
+	peer, ok := parseHop(r.RemoteAddr)
+	if !ok {
+		return r.RemoteAddr
+	}
+	if !tp.trusts(peer) {
+		return peer.String()
+	}
+
+	var hops []string
+	if tp.header == "Forwarded" {
+		hops = forwardedFor(r.Header.Values("Forwarded"))
+	} else {
+		hops = splitHeader(r.Header.Values(tp.header))
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, ok := parseHop(hops[i])
+		if !ok {
+			// Obfuscated or malformed hops can't be verified; the last
+			// trusted proxy is the best identification we have
+			break
+		}
+		client = hop
+		if !tp.trusts(hop) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// RateLimitBucket returns the rate limit key part for a client IP. IPv6
+// clients are grouped by their network prefix, so a host can't escape the
+// limit by rotating through the addresses of its subnet.
+func (tp *TrustedProxies) RateLimitBucket(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || addr.Is4() {
+		return ip
+	}
+	bits := defaultIPv6Prefix
+	if tp != nil {
+		bits = tp.ipv6Prefix
+	}
+	prefix, err := addr.WithZone("").Prefix(bits)
+	if err != nil {
+		return ip
+	}
+	return prefix.String()
+}
+
+// parseHop parses an address as found in RemoteAddr and forwarding headers:
+// a bare IP, or an IP with a port, brackets or quotes around it
+func parseHop(s string) (netip.Addr, bool) {
+	s = strings.Trim(strings.TrimSpace(s), `"`)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// splitHeader splits comma-separated header values into their elements
+func splitHeader(values []string) []string {
+	var elements []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			if element = strings.TrimSpace(element); element != "" {
+				elements = append(elements, element)
+			}
+		}
+	}
+	return elements
+}
+
+// forwardedFor returns the for= node of each element of RFC 7239 Forwarded
+// headers, in order. Elements without one are kept as "unknown" so they
+// still stop the walk over the chain.
+func forwardedFor(values []string) []string {
+	var nodes []string
+	for _, element := range splitHeader(values) {
+		node := "unknown"
+		for _, pair := range strings.Split(element, ";") {
+			name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(strings.TrimSpace(name), "for") {
+				node = strings.TrimSpace(value)
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
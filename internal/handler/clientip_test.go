@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"fetch/internal/ratelimit"
+	"fetch/internal/service"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrustedProxiesClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string // TRUSTED_PROXY_HEADER
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{"untrusted peer ignores headers", "", "203.0.113.9:1234", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "203.0.113.9"},
+		{"trusted peer without headers", "", "10.0.0.1:1234", nil, "10.0.0.1"},
+		{"single hop", "", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.7"}, "198.51.100.7"},
+		{"spoofed entries left of the client", "", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.7, 10.0.0.2"}, "198.51.100.7"},
+		{"all hops trusted", "", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"malformed hop", "", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "1.2.3.4, garbage"}, "10.0.0.1"},
+		{"client Forwarded ignored", "", "10.0.0.1:1234", map[string]string{"Forwarded": "for=1.2.3.4", "X-Forwarded-For": "198.51.100.7"}, "198.51.100.7"},
+		{"client Forwarded ignored without X-Forwarded-For", "", "10.0.0.1:1234", map[string]string{"Forwarded": "for=1.2.3.4"}, "10.0.0.1"},
+		{"X-Real-IP", "X-Real-IP", "10.0.0.1:1234", map[string]string{"X-Real-IP": "198.51.100.7", "X-Forwarded-For": "1.2.3.4"}, "198.51.100.7"},
+		{"Forwarded", "forwarded", "10.0.0.1:1234", map[string]string{"Forwarded": `for=1.2.3.4, for="[2001:db8::7]:4711";proto=https, for=10.0.0.2`}, "2001:db8::7"},
+		{"client X-Forwarded-For ignored", "Forwarded", "10.0.0.1:1234", map[string]string{"Forwarded": "for=198.51.100.7", "X-Forwarded-For": "1.2.3.4"}, "198.51.100.7"},
+		{"Forwarded obfuscated hop", "Forwarded", "10.0.0.1:1234", map[string]string{"Forwarded": "for=_hidden, for=10.0.0.2"}, "10.0.0.2"},
+		{"trusted IPv6 proxy", "", "[2001:db8:ffff::1]:443", map[string]string{"X-Forwarded-For": "198.51.100.7"}, "198.51.100.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "2001:db8:ffff::1"}, 0, tt.header)
+			if err != nil {
+				t.Fatalf("ParseTrustedProxies failed: %v", err)
+			}
+			req := httptest.NewRequest("GET", "/fetch", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			if got := proxies.ClientIP(req); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+
+	for _, entry := range []string{"10.0.0.0/33", "proxy.local"} {
+		if _, err := ParseTrustedProxies([]string{entry}, 0, ""); err == nil {
+			t.Errorf("expected error for %q", entry)
+		}
+	}
+	if _, err := ParseTrustedProxies(nil, 0, "X-Client-IP"); err == nil {
+		t.Error("expected error for an unsupported forwarding header")
+	}
+}
+
+func TestRateLimitBucketGroupsIPv6(t *testing.T) {
+	proxies, _ := ParseTrustedProxies(nil, 0, "")
+
+	if got := proxies.RateLimitBucket("198.51.100.7"); got != "198.51.100.7" {
+		t.Errorf("expected IPv4 clients to be limited per address, got %s", got)
+	}
+	a := proxies.RateLimitBucket("2001:db8:1:2::1")
+	b := proxies.RateLimitBucket("2001:db8:1:2:ffff::9")
+	if a != "2001:db8:1:2::/64" || a != b {
+		t.Errorf("expected addresses of one /64 to share a bucket, got %s and %s", a, b)
+	}
+	if c := proxies.RateLimitBucket("2001:db8:1:3::1"); c == a {
+		t.Errorf("expected other /64s to get their own bucket, got %s", c)
+	}
+}
+
+func TestSpoofedForwardedForDoesNotEscapeRateLimit(t *testing.T) {
+	cfg := service.Config{
+		FetchTimeout:       5 * time.Second,
+		ResultTTL:          1 * time.Hour,
+		CleanupInterval:    10 * time.Minute,
+		MaxResultsInMemory: 100,
+	}
+	svc := service.NewFetchService(cfg, ratelimit.NewRateLimiter(1, 1, time.Minute))
+	handler := NewHandler(svc, 1, "1m")
+
+	for i, expected := range []int{http.StatusAccepted, http.StatusTooManyRequests} {
+		req := httptest.NewRequest("POST", "/fetch", strings.NewReader(`{"urls": ["https://example.com"]}`))
+		req.RemoteAddr = "203.0.113.9:1234"
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("192.0.2.%d", i+1))
+		w := httptest.NewRecorder()
+		handler.HandlePostFetch(w, req)
+
+		if w.Code != expected {
+			t.Errorf("request %d: expected status %d, got %d", i+1, expected, w.Code)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fetch/cmd/model"
+	"fetch/internal/config"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ConfigReloader re-reads the configuration and applies the settings that
+// can change while the service runs
+type ConfigReloader func(ctx context.Context) (models.ConfigReload, error)
+
+// ConfigSource returns the configuration in effect and when it was last
+// reloaded, the zero time if it never was
+type ConfigSource func() (*config.Config, time.Time)
+
+// SetConfigSource enables GET /admin/config
+func (h *Handler) SetConfigSource(source ConfigSource) {
+	h.configSource = source
+}
+
+// SetConfigReloader enables POST /admin/config/reload
+func (h *Handler) SetConfigReloader(reload ConfigReloader) {
+	h.reloadConfig = reload
+}
+
+// SetRateLimits updates the limits quoted in rate limit responses after the
+// request and URL rate limiters are reconfigured
+func (h *Handler) SetRateLimits(requests, urls int, window string) {
+	h.limitsMu.Lock()
+	defer h.limitsMu.Unlock()
+	h.rateLimitReqs = requests
+	h.budgets.URLLimit = urls
+	h.rateLimitWindow = window
+}
+
+// rateLimits returns the limits quoted in rate limit responses
+func (h *Handler) rateLimits() (requests, urls int, window string) {
+	h.limitsMu.RLock()
+	defer h.limitsMu.RUnlock()
+	return h.rateLimitReqs, h.budgets.URLLimit, h.rateLimitWindow
+}
+
+// HandleAdminConfig handles GET /admin/config - the effective value and
+// source of every setting, with secrets redacted
+func (h *Handler) HandleAdminConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.configSource == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	cfg, reloadedAt := h.configSource()
+	response := models.EffectiveConfig{
+		Settings:   make(map[string]models.ConfigSetting),
+		ReloadedAt: reloadedAt,
+	}
+	for key, s := range cfg.Settings() {
+		response.Settings[key] = models.ConfigSetting{Value: s.Value, Source: s.Source, Reloadable: s.Reloadable}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// HandleAdminConfigReload handles POST /admin/config/reload - re-read the
+// configuration file and environment. An invalid configuration is rejected
+// as a whole and the running one is kept.
+func (h *Handler) HandleAdminConfigReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.reloadConfig == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	reload, err := h.reloadConfig(r.Context())
+	var invalid *config.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error":    "Invalid configuration, keeping the current one",
+			"problems": invalid.Problems,
+		})
+	case err != nil:
+		slog.ErrorContext(r.Context(), "Failed to reload configuration", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": err.Error(),
+		})
+	default:
+		writeJSON(w, http.StatusOK, reload)
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fetch/cmd/model"
+	"fetch/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestHandleAdminConfig(t *testing.T) {
+	handler := createTestHandler()
+
+	w := httptest.NewRecorder()
+	handler.HandleAdminConfig(w, httptest.NewRequest("GET", "/admin/config", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d without a config source, got %d", http.StatusNotFound, w.Code)
+	}
+
+	t.Setenv("RATE_LIMIT_REDIS_URL", "redis://:hunter2@cache:6379/0")
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	reloadedAt := time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)
+	handler.SetConfigSource(func() (*config.Config, time.Time) { return cfg, reloadedAt })
+
+	w = httptest.NewRecorder()
+	handler.HandleAdminConfig(w, httptest.NewRequest("GET", "/admin/config", nil))
+	var effective models.EffectiveConfig
+	if err := json.NewDecoder(w.Body).Decode(&effective); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	for key, want := range map[string]models.ConfigSetting{
+		"RATE_LIMIT_REQUESTS":  {Value: float64(100), Source: "default", Reloadable: true},
+		"RATE_LIMIT_REDIS_URL": {Value: "redis://:xxxxx@cache:6379/0", Source: "env"},
+	} {
+		if got := effective.Settings[key]; got != want {
+			t.Errorf("%s: expected %+v, got %+v", key, want, got)
+		}
+	}
+	if !effective.ReloadedAt.Equal(reloadedAt) {
+		t.Errorf("expected the last reload time %v, got %v", reloadedAt, effective.ReloadedAt)
+	}
+
+	w = httptest.NewRecorder()
+	handler.HandleAdminConfig(w, httptest.NewRequest("POST", "/admin/config", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d for POST, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
+
+func TestHandleAdminConfigReload(t *testing.T) {
+	handler := createTestHandler()
+	post := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.HandleAdminConfigReload(w, httptest.NewRequest("POST", "/admin/config/reload", nil))
+		return w
+	}
+
+	if w := post(); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d without a reloader, got %d", http.StatusNotFound, w.Code)
+	}
+
+	var reloadErr error
+	handler.SetConfigReloader(func(ctx context.Context) (models.ConfigReload, error) {
+		return models.ConfigReload{Applied: []string{"RESULT_TTL"}}, reloadErr
+	})
+	w := post()
+	var reload models.ConfigReload
+	if err := json.NewDecoder(w.Body).Decode(&reload); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if w.Code != http.StatusOK || !slices.Equal(reload.Applied, []string{"RESULT_TTL"}) {
+		t.Errorf("expected the applied settings, got %d %+v", w.Code, reload)
+	}
+
+	reloadErr = &config.ValidationError{Problems: []string{"RESULT_TTL must be positive, got 0s"}}
+	w = post()
+	var rejected struct {
+		Problems []string `json:"problems"`
+	}
+	json.NewDecoder(w.Body).Decode(&rejected)
+	if w.Code != http.StatusBadRequest || !slices.Equal(rejected.Problems, []string{"RESULT_TTL must be positive, got 0s"}) {
+		t.Errorf("expected the problems to be reported, got %d %+v", w.Code, rejected)
+	}
+
+	reloadErr = errors.New("reading config file: permission denied")
+	if w := post(); w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d when the reload fails, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
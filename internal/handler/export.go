@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fetch/cmd/model"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// resultColumn is a CSV column of fetch results, named like the JSON field
+type resultColumn struct {
+	name  string
+	value func(models.FetchResult) string
+}
+
+// resultColumns lists the columns selectable with ?columns=
+var resultColumns = []resultColumn{
+	{"url", func(r models.FetchResult) string { return r.URL }},
+	{"status", func(r models.FetchResult) string { return r.Status }},
+	{"status_code", func(r models.FetchResult) string { return formatInt(r.StatusCode) }},
+	{"content_type", func(r models.FetchResult) string { return r.ContentType }},
+	{"content_length", func(r models.FetchResult) string { return strconv.Itoa(r.ContentLength) }},
+	{"duration", func(r models.FetchResult) string { return r.Duration }},
+	{"error", func(r models.FetchResult) string { return r.Error }},
+	{"failure_reason", func(r models.FetchResult) string { return r.FailureReason }},
+	{"fetched_at", func(r models.FetchResult) string { return formatTime(r.FetchedAt) }},
+	{"final_url", func(r models.FetchResult) string { return r.FinalURL }},
+	{"job_id", func(r models.FetchResult) string { return r.JobID }},
+	{"created_at", func(r models.FetchResult) string { return formatTime(r.CreatedAt) }},
+	{"redirect_count", func(r models.FetchResult) string { return strconv.Itoa(r.RedirectCount) }},
+	{"request_id", func(r models.FetchResult) string { return r.RequestID }},
+	{"from_cache", func(r models.FetchResult) string { return strconv.FormatBool(r.FromCache) }},
+	{"revalidated", func(r models.FetchResult) string { return strconv.FormatBool(r.Revalidated) }},
+	{"deduplicated", func(r models.FetchResult) string { return strconv.FormatBool(r.Deduplicated) }},
+	{"parent_url", func(r models.FetchResult) string { return r.ParentURL }},
+	{"depth", func(r models.FetchResult) string { return strconv.Itoa(r.Depth) }},
+	{"throttled_for", func(r models.FetchResult) string { return r.ThrottledFor }},
+	{"content_hash", func(r models.FetchResult) string { return r.ContentHash }},
+	{"changed", func(r models.FetchResult) string {
+		if r.Changed == nil {
+			return ""
+		}
+		return strconv.FormatBool(*r.Changed)
+	}},
+	{"previous_fetched_at", func(r models.FetchResult) string { return formatTime(r.PreviousFetchedAt) }},
+	{"content", func(r models.FetchResult) string { return r.Content }},
+}
+
+// defaultColumns are the leading resultColumns, written without ?columns=
+const defaultColumns = 11
+
+// formatInt formats a number that is unset when 0
+func formatInt(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// formatTime formats a time as RFC 3339, "" when unset
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// selectColumns parses a comma-separated ?columns= list
+func selectColumns(list string) ([]resultColumn, error) {
+	if strings.TrimSpace(list) == "" {
+		return resultColumns[:defaultColumns], nil
+	}
+
+	var columns []resultColumn
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		i := columnIndex(name)
+		if i < 0 {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		columns = append(columns, resultColumns[i])
+	}
+	return columns, nil
+}
+
+// columnIndex returns the index of a column in resultColumns, -1 if unknown
+func columnIndex(name string) int {
+	for i, column := range resultColumns {
+		if column.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// columnNames lists the selectable columns
+func columnNames() []string {
+	names := make([]string, len(resultColumns))
+	for i, column := range resultColumns {
+		names[i] = column.name
+	}
+	return names
+}
+
+// acceptedFormat returns the first of NDJSON and CSV named by the Accept
+// header, "" when neither is, for the default JSON response. Quality values
+// are ignored; clients list the format they want first.
+func acceptedFormat(r *http.Request) string {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case ndjsonContentType, csvContentType:
+			return mediaType
+		case "application/json", "*/*":
+			return ""
+		}
+	}
+	return ""
+}
+
+// exportResults writes results as NDJSON or CSV when the Accept header asks
+// for it, one row at a time rather than encoding a whole FetchResponse. It
+// returns false, writing nothing, for the default JSON response.
+func exportResults(w http.ResponseWriter, r *http.Request, results []models.FetchResult) bool {
+	w.Header().Add("Vary", "Accept")
+
+	switch acceptedFormat(r) {
+	case ndjsonContentType:
+		w.Header().Set("Content-Type", ndjsonContentType)
+		w.WriteHeader(http.StatusOK)
+		encoder := json.NewEncoder(w)
+		for _, result := range results {
+			if err := encoder.Encode(result); err != nil {
+				slog.WarnContext(r.Context(), "Failed to write results", "error", err)
+				break
+			}
+		}
+		return true
+
+	case csvContentType:
+		columns, err := selectColumns(r.URL.Query().Get("columns"))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error":   err.Error(),
+				"columns": columnNames(),
+			})
+			return true
+		}
+
+		w.Header().Set("Content-Type", csvContentType+"; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		writer := csv.NewWriter(w)
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			row[i] = column.name
+		}
+		writer.Write(row)
+		for _, result := range results {
+			for i, column := range columns {
+				row[i] = column.value(result)
+			}
+			if err := writer.Write(row); err != nil {
+				break
+			}
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			slog.WarnContext(r.Context(), "Failed to write results", "error", err)
+		}
+		return true
+	}
+	return false
+}
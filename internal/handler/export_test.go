@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fetch/cmd/model"
+	"fetch/internal/service"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetFetchExport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, "a,\"quoted\"\nline")
+	}))
+	defer server.Close()
+
+	svc := createTestService()
+	handler := NewHandler(svc, 100, "1m")
+	fetched := svc.FetchURLs([]string{server.URL + "/a", server.URL + "/b"}, service.FetchOptions{})
+	jobID := fetched.Results[0].JobID
+
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		if strings.HasPrefix(path, "/jobs/") {
+			handler.HandleJobByID(w, req)
+		} else {
+			handler.HandleGetFetch(w, req)
+		}
+		return w
+	}
+
+	w := get("/fetch", "application/x-ndjson")
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Expected NDJSON content type, got %q", ct)
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 NDJSON lines, got %d: %s", len(lines), w.Body.String())
+	}
+	var result models.FetchResult
+	if err := json.Unmarshal([]byte(lines[0]), &result); err != nil || result.Status != "success" {
+		t.Errorf("Unexpected NDJSON line %q: %v", lines[0], err)
+	}
+
+	w = get("/jobs/"+jobID+"?columns=url,status_code,content", "text/csv, application/json;q=0.5")
+	if ct := w.Header().Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+		t.Errorf("Expected CSV content type, got %q", ct)
+	}
+	want := "url,status_code,content\n" +
+		server.URL + "/a,200,\"a,\"\"quoted\"\"\nline\"\n" +
+		server.URL + "/b,200,\"a,\"\"quoted\"\"\nline\"\n"
+	if w.Body.String() != want {
+		t.Errorf("Unexpected CSV:\n%s\nwant:\n%s", w.Body.String(), want)
+	}
+
+	w = get("/fetch", "text/csv")
+	if header, _, _ := strings.Cut(w.Body.String(), "\n"); !strings.HasPrefix(header, "url,status,status_code,") {
+		t.Errorf("Unexpected default CSV header %q", header)
+	}
+
+	w = get("/fetch?columns=url,bogus", "text/csv")
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "bogus") {
+		t.Errorf("Expected 400 for an unknown column, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = get("/fetch", "application/json")
+	var response models.FetchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.TotalURLs != 2 {
+		t.Errorf("Expected the JSON response by default, got %s", w.Body.String())
+	}
+}
@@ -2,19 +2,29 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fetch/cmd/model"
+	"fetch/internal/metrics"
 	"fetch/internal/service"
 	"fmt"
-	"log"
-	"net"
+	"log/slog"
 	"net/http"
+	"sync"
 )
 
 // Handler holds the dependencies for HTTP handlers
 type Handler struct {
 	service         *service.FetchService
+	limitsMu        sync.RWMutex // Guards the limits changed by SetRateLimits
 	rateLimitReqs   int
 	rateLimitWindow string
+	budgets         Budgets
+	uploadMaxBytes  int64 // Largest NDJSON or CSV body
+	uploadMaxURLs   int   // Most URLs per upload, JSON URL list or schedule
+	proxies         *TrustedProxies
+	rejections      *metrics.Counter // Rate limit rejections by limit
+	reloadConfig    ConfigReloader   // nil when reloading is unavailable
+	configSource    ConfigSource     // nil when the configuration isn't reported
 }
 
 // NewHandler creates a new HTTP handler
@@ -23,30 +33,22 @@ func NewHandler(svc *service.FetchService, rateLimitReqs int, rateLimitWindow st
 		service:         svc,
 		rateLimitReqs:   rateLimitReqs,
 		rateLimitWindow: rateLimitWindow,
+		uploadMaxBytes:  defaultUploadMaxBytes,
+		uploadMaxURLs:   defaultUploadMaxURLs,
+		rejections: svc.Metrics().NewCounter("fetch_rate_limit_rejections_total",
+			"Requests rejected by a rate limit or quota, by limit.", "limit"),
 	}
 }
 
-// getIPFromRequest extracts the IP address from the request
-func getIPFromRequest(r *http.Request) string {
-	// Check X-Forwarded-For header first (for proxies)
-	forwarded := r.Header.Get("X-Forwarded-For")
-	if forwarded != "" {
-		// Take the first IP if multiple are present
-		return forwarded
-	}
-
-	// Check X-Real-IP header
-	realIP := r.Header.Get("X-Real-IP")
-	if realIP != "" {
-		return realIP
-	}
+// SetTrustedProxies sets the proxies whose forwarding headers identify
+// clients. Without trusted proxies the connection's peer is the client.
+func (h *Handler) SetTrustedProxies(tp *TrustedProxies) {
+	h.proxies = tp
+}
 
-	// Fall back to RemoteAddr
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return r.RemoteAddr
-	}
-	return ip
+// getIPFromRequest extracts the client IP address from the request
+func (h *Handler) getIPFromRequest(r *http.Request) string {
+	return h.proxies.ClientIP(r)
 }
 
 // HandlePostFetch handles POST /fetch - submit URLs for fetching
@@ -56,46 +58,141 @@ func (h *Handler) HandlePostFetch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check rate limit
-	ip := getIPFromRequest(r)
-	rateLimiter := h.service.GetRateLimiter()
-	if !rateLimiter.Allow(ip) {
-		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", h.rateLimitReqs))
-		w.Header().Set("X-RateLimit-Window", h.rateLimitWindow)
-		w.WriteHeader(http.StatusTooManyRequests)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"error":   "Rate limit exceeded",
-			"message": fmt.Sprintf("Maximum %d requests per %s allowed", h.rateLimitReqs, h.rateLimitWindow),
-		})
-		log.Printf("Rate limit exceeded for IP: %s", ip)
-		return
+	var req models.FetchRequest
+	var upload *urlUpload // Set for NDJSON and CSV bodies
+	switch mediaType := requestMediaType(r); mediaType {
+	case ndjsonContentType, csvContentType:
+		body := http.MaxBytesReader(w, r.Body, h.uploadMaxBytes)
+		var err error
+		upload, err = readURLUpload(body, mediaType, h.uploadMaxURLs)
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			writeJSON(w, http.StatusRequestEntityTooLarge, map[string]interface{}{
+				"error":   "Upload too large",
+				"message": fmt.Sprintf("Uploads are limited to %d bytes; split the file", h.uploadMaxBytes),
+			})
+			return
+		case errors.Is(err, errTooManyURLs):
+			writeJSON(w, http.StatusRequestEntityTooLarge, map[string]interface{}{
+				"error":   "Too many URLs",
+				"message": fmt.Sprintf("Uploads are limited to %d URLs; split the file", h.uploadMaxURLs),
+			})
+			return
+		case err != nil:
+			http.Error(w, fmt.Sprintf("Invalid upload: %v", err), http.StatusBadRequest)
+			return
+		}
+		if len(upload.URLs) == 0 && upload.InvalidLines > 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error":         "No valid URLs in upload",
+				"invalid_lines": upload.InvalidLines,
+				"line_errors":   upload.LineErrors,
+			})
+			return
+		}
+		req.URLs = upload.URLs
+		req.Cache = r.URL.Query().Get("cache")
+	default:
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid JSON payload: %v", err), http.StatusBadRequest)
+			return
+		}
+		if !h.allowURLCount(w, len(req.URLs)) {
+			return
+		}
 	}
 
-	var req models.FetchRequest
-	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&req); err != nil {
-		http.Error(w, fmt.Sprintf("Invalid JSON payload: %v", err), http.StatusBadRequest)
+	if req.Sitemap != nil && len(req.URLs) > 0 {
+		http.Error(w, "Provide either urls or sitemap, not both", http.StatusBadRequest)
 		return
 	}
 
-	if len(req.URLs) == 0 {
+	if req.Sitemap == nil && len(req.URLs) == 0 {
 		http.Error(w, "No URLs provided", http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("Received request to fetch %d URLs from IP: %s", len(req.URLs), ip)
+	if !service.ValidCacheMode(req.Cache) {
+		http.Error(w, fmt.Sprintf("Invalid cache mode %q (expected bypass, prefer or only)", req.Cache), http.StatusBadRequest)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "URLs submitted for fetching",
+		"status":  "processing",
+	}
+
+	if req.Sitemap == nil && !h.useSubmissionBudgets(w, r, len(req.URLs)) {
+		return
+	}
+
+	// Expand the sitemap into the URL list. The caller must be able to
+	// afford the most URLs it can expand to before anything is fetched, but
+	// only the URLs it did expand to are charged.
+	if req.Sitemap != nil {
+		if !h.useSubmissionBudgets(w, r, 0) {
+			return
+		}
+		key := h.rateLimitKey(r)
+		_, dailyLimit := dailyLimits(r)
+		if rejected := h.checkURLBudget(r.Context(), key, dailyLimit, h.service.SitemapURLLimit(*req.Sitemap)); rejected != nil {
+			writeURLBudgetError(w, rejected)
+			return
+		}
+
+		expansion, err := h.service.ExpandSitemap(r.Context(), *req.Sitemap)
+		if err != nil {
+			writeSitemapError(w, err)
+			return
+		}
+		if len(expansion.URLs) == 0 {
+			http.Error(w, "Sitemap contains no URLs matching the filters", http.StatusBadRequest)
+			return
+		}
+		if !h.useURLBudget(w, r, key, len(expansion.URLs)) {
+			return
+		}
+		req.URLs = expansion.URLs
+		response["sitemaps_fetched"] = expansion.SitemapsFetched
+		response["truncated"] = expansion.Truncated
+	}
+
+	if upload != nil && upload.InvalidLines > 0 {
+		response["invalid_lines"] = upload.InvalidLines
+		response["line_errors"] = upload.LineErrors
+	}
+
+	slog.InfoContext(r.Context(), "Received fetch request", "urls", len(req.URLs), "client_ip", h.getIPFromRequest(r))
 
 	// Submit URLs for fetching
-	h.service.SubmitURLs(req.URLs)
+	jobID := h.service.SubmitURLsWithOptions(req.URLs, service.FetchOptions{
+		Cache:       req.Cache,
+		Tenant:      tenantFromRequest(r),
+		RequestID:   requestID(r),
+		Traceparent: traceparent(r),
+	})
 
 	// Return success response
+	response["total_urls"] = len(req.URLs)
+	response["job_id"] = jobID
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message":    "URLs submitted for fetching",
-		"total_urls": len(req.URLs),
-		"status":     "processing",
+	json.NewEncoder(w).Encode(response)
+}
+
+// writeSitemapError maps sitemap expansion errors to HTTP status codes
+func writeSitemapError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrInvalidSitemap):
+		status = http.StatusBadRequest
+	case errors.Is(err, service.ErrSitemapFetch):
+		status = http.StatusBadGateway
+	}
+	writeJSON(w, status, map[string]interface{}{
+		"error": err.Error(),
 	})
 }
 
@@ -106,7 +203,10 @@ func (h *Handler) HandleGetFetch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	results := h.service.GetResults()
+	results := h.service.GetTenantResults(tenantFromRequest(r))
+	if exportResults(w, r, results.Results) {
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -134,17 +234,25 @@ func (h *Handler) HandleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK"))
 }
 
-// HandleStats handles GET /stats - service statistics
-func (h *Handler) HandleStats(w http.ResponseWriter, r *http.Request, resultTTL, cleanupInterval string, maxResults int) {
+// HandleStats handles GET /stats - statistics of the caller. Service-wide
+// figures, which reveal other tenants' activity, are in GET /admin/stats.
+func (h *Handler) HandleStats(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	// The limiter's settings and the caller's own budget, without the
+	// number of callers it tracks
 	rateLimiter := h.service.GetRateLimiter()
 	stats := rateLimiter.GetStats()
-	results := h.service.GetResults()
-	cleanupStats := h.service.GetCleanupStats()
+	delete(stats, "active_ips")
+	stats["remaining"] = rateLimiter.Peek(h.rateLimitKey(r)).Remaining
+
+	tenant := tenantFromRequest(r)
+	results := h.service.GetTenantResults(tenant)
+	quota := h.service.TenantQuotaFor(tenant)
+	cfg := h.service.Config()
 
 	response := map[string]interface{}{
 		"rate_limiter": stats,
@@ -155,13 +263,15 @@ func (h *Handler) HandleStats(w http.ResponseWriter, r *http.Request, resultTTL,
 			"pending_count": results.PendingCount,
 		},
 		"cleanup": map[string]interface{}{
-			"last_cleanup":      cleanupStats.LastCleanup,
-			"total_cleaned":     cleanupStats.TotalCleaned,
-			"cleanup_count":     cleanupStats.CleanupCount,
-			"results_in_memory": cleanupStats.ResultsInMemory,
-			"ttl":               resultTTL,
-			"max_results":       maxResults,
-			"cleanup_interval":  cleanupInterval,
+			"results_in_memory": results.TotalURLs,
+			"ttl":               cfg.ResultTTL.String(),
+			"max_results":       cfg.MaxResultsInMemory,
+			"cleanup_interval":  cfg.CleanupInterval.String(),
+		},
+		"tenant": map[string]interface{}{
+			"name":        tenant,
+			"max_results": quota.MaxResults,
+			"result_ttl":  quota.ResultTTL.String(),
 		},
 	}
 
@@ -169,6 +279,38 @@ func (h *Handler) HandleStats(w http.ResponseWriter, r *http.Request, resultTTL,
 	json.NewEncoder(w).Encode(response)
 }
 
+// HandleAdminStats handles GET /admin/stats - service-wide statistics
+// across all tenants
+func (h *Handler) HandleAdminStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cleanupStats := h.service.GetCleanupStats()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"rate_limiter": h.service.GetRateLimiter().GetStats(),
+		"cleanup":      cleanupStats,
+		"cache": map[string]interface{}{
+			"entries": h.service.GetCacheSize(),
+		},
+	})
+}
+
+// HandleMetrics handles GET /metrics - service-wide metrics in the
+// Prometheus text exposition format
+func (h *Handler) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", metrics.ContentType)
+	if err := h.service.Metrics().WriteText(w); err != nil {
+		slog.WarnContext(r.Context(), "Failed to write metrics", "error", err)
+	}
+}
+
 // HandleAdminClear handles POST /admin/clear - clear all results
 func (h *Handler) HandleAdminClear(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -176,7 +318,7 @@ func (h *Handler) HandleAdminClear(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	count := h.service.ClearAllResults()
+	count := h.service.ClearTenantResults(tenantFromRequest(r))
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"message":         "All results cleared",
@@ -0,0 +1,418 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fetch/cmd/model"
+	"fetch/internal/ratelimit"
+	"fetch/internal/service"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Helper function to create a test service
+func createTestService() *service.FetchService {
+	cfg := service.Config{
+		FetchTimeout:       5 * time.Second,
+		MaxRedirects:       10,
+		MaxContentSize:     10 * 1024 * 1024,
+		ResultTTL:          1 * time.Hour,
+		CleanupInterval:    10 * time.Minute,
+		MaxResultsInMemory: 10000,
+	}
+	rateLimiter := ratelimit.NewRateLimiter(100, 20, 1*time.Minute)
+	return service.NewFetchService(cfg, rateLimiter)
+}
+
+// Helper function to create test handler
+func createTestHandler() *Handler {
+	svc := createTestService()
+	return NewHandler(svc, 100, "1m")
+}
+
+func TestHandlePostFetchSuccess(t *testing.T) {
+	handler := createTestHandler()
+
+	reqBody := `{"urls": ["https://example.com", "https://google.com"]}`
+	req := httptest.NewRequest("POST", "/fetch", strings.NewReader(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.HandlePostFetch(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Errorf("expected status %d, got %d", http.StatusAccepted, w.Code)
+	}
+
+	var response map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if response["total_urls"].(float64) != 2 {
+		t.Errorf("expected 2 URLs, got %v", response["total_urls"])
+	}
+
+	if response["status"] != "processing" {
+		t.Errorf("expected status 'processing', got '%v'", response["status"])
+	}
+}
+
+func TestHandlePostFetchInvalidJSON(t *testing.T) {
+	handler := createTestHandler()
+
+	req := httptest.NewRequest("POST", "/fetch", strings.NewReader("invalid json"))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.HandlePostFetch(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestHandlePostFetchEmptyURLs(t *testing.T) {
+	handler := createTestHandler()
+
+	reqBody := `{"urls": []}`
+	req := httptest.NewRequest("POST", "/fetch", strings.NewReader(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.HandlePostFetch(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestHandleGetFetchSuccess(t *testing.T) {
+	svc := createTestService()
+	defer svc.Stop()
+
+	handler := NewHandler(svc, 100, "1m")
+
+	// Add some mock results
+	svc.SubmitURLs([]string{"https://example.com"})
+	time.Sleep(100 * time.Millisecond)
+
+	req := httptest.NewRequest("GET", "/fetch", nil)
+	w := httptest.NewRecorder()
+
+	handler.HandleGetFetch(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response models.FetchResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if response.TotalURLs != 1 {
+		t.Errorf("expected 1 total URL, got %d", response.TotalURLs)
+	}
+}
+
+func TestHandleFetchRouting(t *testing.T) {
+	handler := createTestHandler()
+
+	tests := []struct {
+		name           string
+		method         string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "POST with valid body",
+			method:         "POST",
+			body:           `{"urls": ["https://example.com"]}`,
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:           "GET request",
+			method:         "GET",
+			body:           "",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "PUT request (not allowed)",
+			method:         "PUT",
+			body:           "",
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:           "DELETE request (not allowed)",
+			method:         "DELETE",
+			body:           "",
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/fetch", strings.NewReader(tt.body))
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			w := httptest.NewRecorder()
+
+			handler.HandleFetch(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestHandleHealth(t *testing.T) {
+	handler := createTestHandler()
+
+	req := httptest.NewRequest("GET", "/health", nil)
+	w := httptest.NewRecorder()
+
+	handler.HandleHealth(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	if w.Body.String() != "OK" {
+		t.Errorf("expected body 'OK', got '%s'", w.Body.String())
+	}
+}
+
+func TestIntegrationFullWorkflow(t *testing.T) {
+	// Create mock server for successful requests
+	successServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Success response"))
+	}))
+	defer successServer.Close()
+
+	svc := createTestService()
+	defer svc.Stop()
+
+	handler := NewHandler(svc, 100, "1m")
+
+	// Step 1: Submit URLs via POST
+	reqBody := `{"urls": ["` + successServer.URL + `"]}`
+	postReq := httptest.NewRequest("POST", "/fetch", strings.NewReader(reqBody))
+	postReq.Header.Set("Content-Type", "application/json")
+	postWriter := httptest.NewRecorder()
+
+	handler.HandleFetch(postWriter, postReq)
+
+	if postWriter.Code != http.StatusAccepted {
+		t.Fatalf("POST request failed with status %d", postWriter.Code)
+	}
+
+	// Wait for fetches to complete
+	time.Sleep(500 * time.Millisecond)
+
+	// Step 2: Retrieve results via GET
+	getReq := httptest.NewRequest("GET", "/fetch", nil)
+	getWriter := httptest.NewRecorder()
+
+	handler.HandleFetch(getWriter, getReq)
+
+	if getWriter.Code != http.StatusOK {
+		t.Fatalf("GET request failed with status %d", getWriter.Code)
+	}
+
+	// Step 3: Validate results
+	var response models.FetchResponse
+	if err := json.NewDecoder(getWriter.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if response.TotalURLs != 1 {
+		t.Errorf("expected 1 total URL, got %d", response.TotalURLs)
+	}
+
+	if response.SuccessCount != 1 {
+		t.Errorf("expected 1 success, got %d", response.SuccessCount)
+	}
+
+	// Verify individual results
+	for _, result := range response.Results {
+		if result.Status != models.StatusSuccess {
+			t.Errorf("expected success for %s, got %s", result.URL, result.Status)
+		}
+
+		if result.StatusCode == 0 {
+			t.Errorf("status code not set for %s", result.URL)
+		}
+
+		if result.ContentLength == 0 {
+			t.Errorf("content length not set for %s", result.URL)
+		}
+	}
+}
+
+func TestHandleAdminClear(t *testing.T) {
+	svc := createTestService()
+	defer svc.Stop()
+
+	handler := NewHandler(svc, 100, "1m")
+
+	// Add some results
+	svc.SubmitURLs([]string{"https://example.com", "https://google.com"})
+	time.Sleep(100 * time.Millisecond)
+
+	// Clear results
+	req := httptest.NewRequest("POST", "/admin/clear", nil)
+	w := httptest.NewRecorder()
+
+	handler.HandleAdminClear(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if response["results_cleared"].(float64) != 2 {
+		t.Errorf("expected 2 results cleared, got %v", response["results_cleared"])
+	}
+
+	// Verify results are cleared
+	results := svc.GetResults()
+	if results.TotalURLs != 0 {
+		t.Errorf("expected 0 results after clear, got %d", results.TotalURLs)
+	}
+}
+
+func TestHandlePostFetchSitemap(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sitemap.xml" {
+			w.Write([]byte(`<urlset><url><loc>` + server.URL + `/a</loc></url><url><loc>` + server.URL + `/b</loc></url></urlset>`))
+			return
+		}
+		w.Write([]byte("page"))
+	}))
+	defer server.Close()
+
+	handler := createTestHandler()
+
+	body := `{"sitemap": {"url": "` + server.URL + `/sitemap.xml"}}`
+	req := httptest.NewRequest("POST", "/fetch", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.HandlePostFetch(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+
+	var response map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&response)
+	if response["total_urls"] != float64(2) {
+		t.Errorf("expected 2 URLs submitted, got %v", response["total_urls"])
+	}
+
+	// urls and sitemap are mutually exclusive
+	body = `{"urls": ["https://example.com"], "sitemap": {"url": "` + server.URL + `/sitemap.xml"}}`
+	req = httptest.NewRequest("POST", "/fetch", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	handler.HandlePostFetch(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestHandleMetrics(t *testing.T) {
+	svc := service.NewFetchService(service.Config{
+		FetchTimeout:       5 * time.Second,
+		ResultTTL:          1 * time.Hour,
+		CleanupInterval:    10 * time.Minute,
+		MaxResultsInMemory: 100,
+	}, ratelimit.NewRateLimiter(1, 1, time.Minute))
+	handler := NewHandler(svc, 1, "1m")
+	handler.SetBudgets(Budgets{URLLimiter: ratelimit.NewRateLimiter(10, 10, time.Minute), URLLimit: 10})
+
+	for range 2 {
+		req := httptest.NewRequest("POST", "/fetch", strings.NewReader(`{"urls": ["https://example.com"]}`))
+		handler.HandlePostFetch(httptest.NewRecorder(), req)
+	}
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	handler.HandleMetrics(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("expected the Prometheus text format, got %q", ct)
+	}
+	body := w.Body.String()
+	for _, line := range []string{
+		"# TYPE fetch_fetches_total counter",
+		"# TYPE fetch_duration_seconds histogram",
+		"# TYPE fetch_queue_depth gauge",
+		`fetch_rate_limit_rejections_total{limit="requests"} 1`,
+		`fetch_rate_limit_active_keys{limiter="requests"} 1`,
+		`fetch_rate_limit_active_keys{limiter="urls"} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected %q in metrics:\n%s", line, body)
+		}
+	}
+
+	req = httptest.NewRequest("POST", "/metrics", nil)
+	w = httptest.NewRecorder()
+	handler.HandleMetrics(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d for POST, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
+
+func TestStatsAreScopedToCaller(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "page")
+	}))
+	defer server.Close()
+
+	svc := createTestService()
+	handler := NewHandler(svc, 100, "1m")
+	svc.FetchURLs([]string{server.URL + "/a", server.URL + "/b"}, service.FetchOptions{Tenant: "other"})
+	svc.GetRateLimiter().Take("ip:192.0.2.1", 1)
+
+	w := httptest.NewRecorder()
+	handler.HandleStats(w, httptest.NewRequest("GET", "/stats", nil))
+	var stats struct {
+		RateLimiter map[string]interface{} `json:"rate_limiter"`
+		Cleanup     map[string]interface{} `json:"cleanup"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := stats.RateLimiter["active_ips"]; ok {
+		t.Error("Expected /stats not to report the callers tracked by the rate limiter")
+	}
+	if _, ok := stats.RateLimiter["remaining"].(float64); !ok {
+		t.Errorf("Expected the caller's remaining requests, got %v", stats.RateLimiter)
+	}
+	if stats.Cleanup["results_in_memory"] != float64(0) || stats.Cleanup["total_cleaned"] != nil {
+		t.Errorf("Expected cleanup stats of the caller only, got %v", stats.Cleanup)
+	}
+
+	w = httptest.NewRecorder()
+	handler.HandleAdminStats(w, httptest.NewRequest("GET", "/admin/stats", nil))
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.RateLimiter["active_ips"] != float64(1) || stats.Cleanup["results_in_memory"] != float64(2) {
+		t.Errorf("Expected service-wide stats, got %v %v", stats.RateLimiter, stats.Cleanup)
+	}
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fetch/cmd/model"
+	"fetch/internal/service"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// HandleJobByID handles GET /jobs/{id} - results of a single job
+func (h *Handler) HandleJobByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	results := h.service.GetTenantJobResults(tenantFromRequest(r), id)
+	if results.TotalURLs == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"error": "job not found",
+		})
+		return
+	}
+	if exportResults(w, r, results.Results) {
+		return
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+// HandleCrawl handles POST /crawl - start a crawl
+func (h *Handler) HandleCrawl(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.CrawlRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON payload: %v", err), http.StatusBadRequest)
+		return
+	}
+	if !h.allowURLCount(w, len(req.Seeds)) {
+		return
+	}
+	req.Tenant = tenantFromRequest(r)
+	req.RequestID = requestID(r)
+	req.Traceparent = traceparent(r)
+
+	// Every page the crawl may fetch counts against the URL budget
+	req, err := h.service.ValidateCrawl(req)
+	if err != nil {
+		writeCrawlError(w, err)
+		return
+	}
+	if !h.useSubmissionBudgets(w, r, req.MaxPages) {
+		return
+	}
+
+	job, err := h.service.StartCrawl(req)
+	if err != nil {
+		writeCrawlError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// HandleCrawlByID handles GET /crawl/{id} - crawl progress
+func (h *Handler) HandleCrawlByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/crawl/"), "/")
+	job, err := h.service.GetCrawl(id)
+	if err == nil && job.Request.Tenant != tenantFromRequest(r) {
+		err = service.ErrCrawlNotFound
+	}
+	if err != nil {
+		writeCrawlError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// writeCrawlError maps crawl errors to HTTP status codes
+func writeCrawlError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrCrawlNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidCrawl):
+		status = http.StatusBadRequest
+	}
+	writeJSON(w, status, map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+// HandleLinkCheck handles POST /linkcheck - start a link check
+func (h *Handler) HandleLinkCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.LinkCheckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON payload: %v", err), http.StatusBadRequest)
+		return
+	}
+	req.Tenant = tenantFromRequest(r)
+	req.RequestID = requestID(r)
+	req.Traceparent = traceparent(r)
+
+	// The pages and every link target that may be checked count against the
+	// URL budget
+	req, err := h.service.ValidateLinkCheck(req)
+	if err != nil {
+		writeLinkCheckError(w, err)
+		return
+	}
+	if !h.useSubmissionBudgets(w, r, len(req.Pages)+req.MaxLinks) {
+		return
+	}
+
+	job, err := h.service.StartLinkCheck(req)
+	if err != nil {
+		writeLinkCheckError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// HandleLinkCheckByID handles GET /linkcheck/{id} - link check progress and report
+func (h *Handler) HandleLinkCheckByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/linkcheck/"), "/")
+	job, err := h.service.GetLinkCheck(id)
+	if err == nil && job.Request.Tenant != tenantFromRequest(r) {
+		err = service.ErrLinkCheckNotFound
+	}
+	if err != nil {
+		writeLinkCheckError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// writeLinkCheckError maps link check errors to HTTP status codes
+func writeLinkCheckError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrLinkCheckNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidLinkCheck):
+		status = http.StatusBadRequest
+	}
+	writeJSON(w, status, map[string]interface{}{
+		"error": err.Error(),
+	})
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fetch/internal/logging"
+	"net/http"
+)
+
+// RequestIDHeader carries the ID correlating a request with its log lines
+// and fetch results
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds propagated request IDs
+const maxRequestIDLength = 128
+
+// RequestID assigns every request an ID, propagating a valid X-Request-ID
+// from the client or an upstream proxy and generating one otherwise. The ID
+// is echoed in the response and carried by the request's context.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID reports whether id is safe to propagate into logs and
+// results: non-empty, bounded, and limited to URL-safe characters
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID generates a random 128-bit request ID
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestID returns the ID assigned to r by RequestID, "" outside it
+func requestID(r *http.Request) string {
+	return logging.RequestID(r.Context())
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestIDPropagation(t *testing.T) {
+	svc := createTestService()
+	handler := NewHandler(svc, 100, "1m")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fetch", handler.HandleFetch)
+	server := RequestID(mux)
+
+	submit := func(requestID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/fetch", strings.NewReader(`{"urls": [""]}`))
+		if requestID != "" {
+			req.Header.Set("X-Request-ID", requestID)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("expected status %d, got %d", http.StatusAccepted, w.Code)
+		}
+		return w
+	}
+
+	w := submit("upstream-id.42")
+	if id := w.Header().Get("X-Request-ID"); id != "upstream-id.42" {
+		t.Errorf("expected the client's request ID to be propagated, got %q", id)
+	}
+	var submitted map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&submitted)
+
+	// Generated when missing or unsafe to log
+	for _, id := range []string{"", "bad id\n", strings.Repeat("a", 129)} {
+		w := submit(id)
+		if got := w.Header().Get("X-Request-ID"); got == "" || got == id {
+			t.Errorf("expected a generated request ID for %q, got %q", id, got)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for svc.GetJobResults(submitted["job_id"].(string)).PendingCount > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	results := svc.GetJobResults(submitted["job_id"].(string)).Results
+	if len(results) != 1 || results[0].RequestID != "upstream-id.42" {
+		t.Errorf("expected the result to carry the request ID, got %+v", results)
+	}
+}
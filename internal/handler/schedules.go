@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fetch/cmd/model"
+	"fetch/internal/service"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// HandleSchedules handles /schedules - list (GET) or create (POST) schedules
+func (h *Handler) HandleSchedules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		tenant := tenantFromRequest(r)
+		schedules := make([]models.Schedule, 0)
+		for _, schedule := range h.service.ListSchedules() {
+			if schedule.Tenant == tenant {
+				schedules = append(schedules, schedule)
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"schedules": schedules,
+		})
+	case http.MethodPost:
+		var req models.ScheduleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid JSON payload: %v", err), http.StatusBadRequest)
+			return
+		}
+		req.Tenant = tenantFromRequest(r)
+		if !h.allowURLCount(w, len(req.URLs)) {
+			return
+		}
+
+		// Creating counts as a request; each run's URLs are charged when it
+		// starts, and a schedule too large to ever run is rejected now
+		if err := h.service.ValidateSchedule(req); err != nil {
+			writeScheduleError(w, err)
+			return
+		}
+		key := h.rateLimitKey(r)
+		_, dailyLimit := dailyLimits(r)
+		if rejected := h.oversized(r.Context(), key, dailyLimit, len(req.URLs)); rejected != nil {
+			writeURLBudgetError(w, rejected)
+			return
+		}
+		if !h.useSubmissionBudgets(w, r, 0) {
+			return
+		}
+		req.Budget = h.urlBudget(r)
+
+		schedule, err := h.service.CreateSchedule(req)
+		if err != nil {
+			writeScheduleError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, schedule)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleScheduleByID handles /schedules/{id}, /schedules/{id}/pause and /schedules/{id}/resume
+func (h *Handler) HandleScheduleByID(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/schedules/"), "/"), "/")
+	id := parts[0]
+	if id == "" || len(parts) > 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Schedules of other tenants are reported as not found
+	schedule, err := h.service.GetSchedule(id)
+	if err == nil && schedule.Tenant != tenantFromRequest(r) {
+		err = service.ErrScheduleNotFound
+	}
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+
+	if len(parts) == 2 {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		switch parts[1] {
+		case "pause":
+			schedule, err = h.service.PauseSchedule(id)
+		case "resume":
+			schedule, err = h.service.ResumeSchedule(id)
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			writeScheduleError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, schedule)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, schedule)
+	case http.MethodDelete:
+		if err = h.service.DeleteSchedule(id); err != nil {
+			writeScheduleError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"message": "Schedule deleted",
+			"id":      id,
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// writeScheduleError maps schedule errors to HTTP status codes
+func writeScheduleError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrScheduleNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidSchedule):
+		status = http.StatusBadRequest
+	}
+	writeJSON(w, status, map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fetch/cmd/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleSchedulesLifecycle(t *testing.T) {
+	svc := createTestService()
+	defer svc.Stop()
+
+	handler := NewHandler(svc, 100, "1m")
+
+	// Create
+	reqBody := `{"urls": ["https://example.com"], "cron": "0 * * * *"}`
+	req := httptest.NewRequest("POST", "/schedules", strings.NewReader(reqBody))
+	w := httptest.NewRecorder()
+	handler.HandleSchedules(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	if strings.Contains(w.Body.String(), `"last_run"`) {
+		t.Errorf("expected last_run to be omitted before the first run, got %s", w.Body.String())
+	}
+	var created models.Schedule
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if created.ID == "" || created.NextRun.IsZero() {
+		t.Fatalf("expected id and next run to be set, got %+v", created)
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{"get", "GET", "/schedules/" + created.ID, http.StatusOK},
+		{"pause", "POST", "/schedules/" + created.ID + "/pause", http.StatusOK},
+		{"resume", "POST", "/schedules/" + created.ID + "/resume", http.StatusOK},
+		{"unknown action", "POST", "/schedules/" + created.ID + "/bogus", http.StatusNotFound},
+		{"delete", "DELETE", "/schedules/" + created.ID, http.StatusOK},
+		{"get deleted", "GET", "/schedules/" + created.ID, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			w := httptest.NewRecorder()
+			handler.HandleScheduleByID(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestHandleSchedulesInvalid(t *testing.T) {
+	handler := createTestHandler()
+
+	req := httptest.NewRequest("POST", "/schedules", strings.NewReader(`{"urls": ["https://example.com"]}`))
+	w := httptest.NewRecorder()
+	handler.HandleSchedules(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"fetch/internal/tracing"
+	"net/http"
+)
+
+// Tracing records a server span for every request, continuing the trace
+// of a valid traceparent header from the caller. Spans are named by the
+// method and the routes pattern matching the request, e.g. "GET /crawl/".
+// The request's context carries the span, so jobs started by the request
+// become part of its trace.
+func Tracing(t *tracing.Tracer, routes *http.ServeMux, next http.Handler) http.Handler {
+	if t == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.Method
+		if _, pattern := routes.Handler(r); pattern != "" {
+			name += " " + pattern
+		}
+
+		ctx := tracing.ContextWithTraceparent(r.Context(), r.Header.Get(tracing.TraceparentHeader))
+		ctx, span := t.Start(ctx, name, tracing.KindServer,
+			tracing.String("http.request.method", r.Method),
+			tracing.String("url.path", r.URL.Path),
+		)
+		if id := requestID(r); id != "" {
+			span.SetAttributes(tracing.String("request_id", id))
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			span.SetAttributes(
+				tracing.Int("http.response.status_code", rec.status),
+				tracing.Int64("http.response.body.size", rec.bytes),
+			)
+			if rec.status >= 500 {
+				span.SetError(http.StatusText(rec.status))
+			}
+			span.End()
+		}()
+		next.ServeHTTP(rec, r.WithContext(ctx))
+	})
+}
+
+// traceparent returns the trace context of r's span for jobs it starts,
+// "" when tracing is disabled
+func traceparent(r *http.Request) string {
+	return tracing.SpanContextFromContext(r.Context()).Traceparent()
+}
+
+// statusRecorder records the status code and body size of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
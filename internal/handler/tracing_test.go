@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fetch/internal/ratelimit"
+	"fetch/internal/service"
+	"fetch/internal/tracing"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTracingPropagation(t *testing.T) {
+	type exportedSpan struct {
+		TraceID      string `json:"traceId"`
+		SpanID       string `json:"spanId"`
+		ParentSpanID string `json:"parentSpanId"`
+		Name         string `json:"name"`
+	}
+	var (
+		mu    sync.Mutex
+		spans []exportedSpan
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []exportedSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		defer mu.Unlock()
+		for _, rs := range body.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}))
+	defer collector.Close()
+
+	var outbound string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		outbound = r.Header.Get("traceparent")
+		w.Write([]byte("page"))
+	}))
+	defer target.Close()
+
+	exporter, err := tracing.NewOTLPExporter(tracing.OTLPConfig{Endpoint: collector.URL, ServiceName: "fetch"})
+	if err != nil {
+		t.Fatalf("NewOTLPExporter failed: %v", err)
+	}
+	defer exporter.Shutdown()
+	tracer := tracing.NewTracer(exporter, true)
+
+	svc := service.NewFetchService(service.Config{
+		FetchTimeout:    5 * time.Second,
+		MaxRedirects:    10,
+		MaxContentSize:  1024,
+		ResultTTL:       1 * time.Hour,
+		CleanupInterval: 10 * time.Minute,
+		Tracer:          tracer,
+	}, ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer svc.Stop()
+	handler := NewHandler(svc, 100, "1m")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fetch", handler.HandleFetch)
+	server := RequestID(Tracing(tracer, mux, mux))
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest("POST", "/fetch", strings.NewReader(`{"urls": ["`+target.URL+`"]}`))
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d", http.StatusAccepted, w.Code)
+	}
+
+	// The job span ends once all of the job's fetches are done
+	byName := map[string]exportedSpan{}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(byName) < 4 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		exporter.Flush()
+		mu.Lock()
+		for _, s := range spans {
+			byName[s.Name] = s
+		}
+		mu.Unlock()
+	}
+
+	parents := map[string]string{
+		"POST /fetch": "00f067aa0ba902b7",
+		"fetch job":   byName["POST /fetch"].SpanID,
+		"fetch":       byName["fetch job"].SpanID,
+		"HTTP GET":    byName["fetch"].SpanID,
+	}
+	for name, parent := range parents {
+		s, ok := byName[name]
+		if !ok {
+			t.Errorf("expected a %q span, got %+v", name, spans)
+			continue
+		}
+		if s.TraceID != traceID || s.ParentSpanID != parent {
+			t.Errorf("expected %q to continue the caller's trace under %s, got %+v", name, parent, s)
+		}
+	}
+	if want := "00-" + traceID + "-" + byName["HTTP GET"].SpanID + "-01"; outbound != want {
+		t.Errorf("expected outbound traceparent %q, got %q", want, outbound)
+	}
+}
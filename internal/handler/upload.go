@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fetch/cmd/model"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Content types of bulk URL uploads to POST /fetch
+const (
+	ndjsonContentType = "application/x-ndjson"
+	csvContentType    = "text/csv"
+)
+
+// Upload limits
+const (
+	maxUploadLineSize = 64 * 1024 // Bytes per NDJSON line
+	maxLineErrors     = 100       // Invalid lines reported; the rest are only counted
+
+	defaultUploadMaxBytes = 10 * 1024 * 1024 // Body size without SetUploadLimits
+	defaultUploadMaxURLs  = 10000            // URLs per upload without SetUploadLimits
+)
+
+// errTooManyURLs is returned for uploads with more valid URLs than allowed
+var errTooManyURLs = errors.New("too many URLs")
+
+// SetUploadLimits sets the largest NDJSON or CSV body accepted by
+// POST /fetch and the most URLs it, a JSON URL list or a schedule may hold
+func (h *Handler) SetUploadLimits(maxBytes int64, maxURLs int) {
+	h.uploadMaxBytes = maxBytes
+	h.uploadMaxURLs = maxURLs
+}
+
+// allowURLCount writes a 413 response when a JSON request lists more than
+// the URLs allowed in an upload, so no submission format can exceed them
+func (h *Handler) allowURLCount(w http.ResponseWriter, n int) bool {
+	if n <= h.uploadMaxURLs {
+		return true
+	}
+	writeJSON(w, http.StatusRequestEntityTooLarge, map[string]interface{}{
+		"error":   "Too many URLs",
+		"message": fmt.Sprintf("Requests are limited to %d URLs; split the list", h.uploadMaxURLs),
+	})
+	return false
+}
+
+// urlUpload holds the URLs of an NDJSON or CSV body. The body is read line
+// by line and reading stops at maxURLs valid URLs, so only the URLs are
+// held in memory.
+type urlUpload struct {
+	URLs         []string
+	InvalidLines int
+	LineErrors   []models.LineError // The first maxLineErrors invalid lines
+
+	maxURLs int
+}
+
+// add validates the URL on a line, recording it or the problem with it. It
+// fails with errTooManyURLs once the upload holds more than maxURLs.
+func (u *urlUpload) add(line int, rawURL string) error {
+	rawURL = strings.TrimSpace(rawURL)
+	if err := validateUploadURL(rawURL); err != nil {
+		u.invalid(line, err.Error())
+		return nil
+	}
+	if len(u.URLs) >= u.maxURLs {
+		return errTooManyURLs
+	}
+	u.URLs = append(u.URLs, rawURL)
+	return nil
+}
+
+// invalid records an invalid line
+func (u *urlUpload) invalid(line int, problem string) {
+	u.InvalidLines++
+	if len(u.LineErrors) < maxLineErrors {
+		u.LineErrors = append(u.LineErrors, models.LineError{Line: line, Error: problem})
+	}
+}
+
+// validateUploadURL checks that an uploaded URL can be fetched
+func validateUploadURL(rawURL string) error {
+	if rawURL == "" {
+		return errors.New("missing url")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %v", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url %q: not an absolute http or https URL", rawURL)
+	}
+	return nil
+}
+
+// requestMediaType returns the media type of the request body, without
+// parameters such as charset
+func requestMediaType(r *http.Request) string {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// readURLUpload reads an NDJSON or CSV body of at most maxURLs URLs.
+// Invalid lines are recorded in the upload; an error means the body as a
+// whole couldn't be read or was too large.
+func readURLUpload(body io.Reader, mediaType string, maxURLs int) (*urlUpload, error) {
+	upload := &urlUpload{maxURLs: maxURLs}
+	if mediaType == csvContentType {
+		return upload, readCSVUpload(body, upload)
+	}
+	return upload, readNDJSONUpload(body, upload)
+}
+
+// readNDJSONUpload reads one URL per line, either as a JSON string or as an
+// object with a "url" field. Other fields are ignored and blank lines are
+// skipped.
+func readNDJSONUpload(body io.Reader, upload *urlUpload) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 4096), maxUploadLineSize)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		var entry struct {
+			URL string `json:"url"`
+		}
+		var err error
+		if text[0] == '"' {
+			err = json.Unmarshal(text, &entry.URL)
+		} else {
+			err = json.Unmarshal(text, &entry)
+		}
+		if err != nil {
+			upload.invalid(line, fmt.Sprintf("invalid JSON: %v", err))
+			continue
+		}
+		if err := upload.add(line, entry.URL); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return fmt.Errorf("line %d is longer than %d bytes", line+1, maxUploadLineSize)
+		}
+		return fmt.Errorf("reading body: %w", err)
+	}
+	return nil
+}
+
+// readCSVUpload reads one URL per record. When the first record has a "url"
+// column it is a header naming the URL column; otherwise URLs are in the
+// first column. Blank lines are skipped.
+func readCSVUpload(body io.Reader, upload *urlUpload) error {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	column := 0
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			upload.invalid(parseErr.StartLine, fmt.Sprintf("invalid CSV: %v", parseErr.Err))
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("reading body: %w", err)
+		}
+
+		if first {
+			if i := headerColumn(record, "url"); i >= 0 {
+				column = i
+				continue
+			}
+		}
+		line, _ := reader.FieldPos(0)
+		if column >= len(record) {
+			upload.invalid(line, "missing url column")
+			continue
+		}
+		if err := upload.add(line, record[column]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// headerColumn returns the index of the named column in a CSV header, -1
+// if the record has none
+func headerColumn(record []string, name string) int {
+	for i, field := range record {
+		if strings.EqualFold(strings.TrimSpace(field), name) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fetch/cmd/model"
+	"fetch/internal/ratelimit"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandlePostFetchUpload(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantURLs    int
+		wantErrors  []models.LineError
+	}{
+		{
+			name:        "ndjson",
+			contentType: "application/x-ndjson",
+			body: `{"url": "http://127.0.0.1:1/a", "id": 1}
+"http://127.0.0.1:1/b"
+
+{"url": "ftp://127.0.0.1/c"}
+not json
+{"title": "no url"}
+`,
+			wantURLs: 2,
+			wantErrors: []models.LineError{
+				{Line: 4, Error: `invalid url "ftp://127.0.0.1/c": not an absolute http or https URL`},
+				{Line: 5, Error: "invalid JSON: invalid character 'o' in literal null (expecting 'u')"},
+				{Line: 6, Error: "missing url"},
+			},
+		},
+		{
+			name:        "csv with header",
+			contentType: "text/csv; charset=utf-8",
+			body:        "id,URL\n1,http://127.0.0.1:1/a\n2\n3,/relative\n4,\"http://127.0.0.1:1/b\"\n",
+			wantURLs:    2,
+			wantErrors: []models.LineError{
+				{Line: 3, Error: "missing url column"},
+				{Line: 4, Error: `invalid url "/relative": not an absolute http or https URL`},
+			},
+		},
+		{
+			name:        "csv without header",
+			contentType: "text/csv",
+			body:        "http://127.0.0.1:1/a,x\n\nhttp://127.0.0.1:1/b\n",
+			wantURLs:    2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := createTestHandler()
+			req := httptest.NewRequest("POST", "/fetch", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			handler.HandlePostFetch(w, req)
+
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("Expected status 202, got %d: %s", w.Code, w.Body.String())
+			}
+			var response struct {
+				TotalURLs    int                `json:"total_urls"`
+				InvalidLines int                `json:"invalid_lines"`
+				LineErrors   []models.LineError `json:"line_errors"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if response.TotalURLs != tt.wantURLs {
+				t.Errorf("Expected %d URLs, got %d", tt.wantURLs, response.TotalURLs)
+			}
+			if response.InvalidLines != len(tt.wantErrors) || !slices.Equal(response.LineErrors, tt.wantErrors) {
+				t.Errorf("Expected line errors %+v, got %d: %+v", tt.wantErrors, response.InvalidLines, response.LineErrors)
+			}
+		})
+	}
+}
+
+func TestHandlePostFetchUploadRejected(t *testing.T) {
+	handler := createTestHandler()
+
+	req := httptest.NewRequest("POST", "/fetch", strings.NewReader("nope\n\"also nope\"\n"))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	w := httptest.NewRecorder()
+	handler.HandlePostFetch(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"line":2`) {
+		t.Errorf("Expected 400 with line errors, got %d: %s", w.Code, w.Body.String())
+	}
+
+	long := `"http://127.0.0.1:1/` + strings.Repeat("a", 70*1024) + `"`
+	req = httptest.NewRequest("POST", "/fetch", strings.NewReader("\"http://127.0.0.1:1/\"\n"+long))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	w = httptest.NewRecorder()
+	handler.HandlePostFetch(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "line 2") {
+		t.Errorf("Expected 400 for an overlong line, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandlePostFetchUploadLimits(t *testing.T) {
+	svc := createTestService()
+	handler := NewHandler(svc, 100, "1m")
+	server := httptest.NewServer(http.HandlerFunc(handler.HandlePostFetch))
+	defer server.Close()
+
+	// upload posts n URLs as NDJSON and returns the status and error
+	upload := func(n int) (int, string) {
+		var body strings.Builder
+		for i := range n {
+			fmt.Fprintf(&body, "\"http://127.0.0.1:1/%d\"\n", i)
+		}
+		resp, err := http.Post(server.URL, "application/x-ndjson", strings.NewReader(body.String()))
+		if err != nil {
+			t.Fatalf("upload failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var response map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&response)
+		errorText, _ := response["error"].(string)
+		return resp.StatusCode, errorText
+	}
+
+	// One URL over the default UPLOAD_MAX_URLS
+	if status, errorText := upload(10001); status != http.StatusRequestEntityTooLarge || errorText != "Too many URLs" {
+		t.Errorf("expected 413 Too many URLs, got %d %q", status, errorText)
+	}
+
+	handler.SetUploadLimits(1024, 100)
+	if status, errorText := upload(50); status != http.StatusRequestEntityTooLarge || errorText != "Upload too large" {
+		t.Errorf("expected 413 Upload too large, got %d %q", status, errorText)
+	}
+
+	// Uploads within the limits are still bounded by the URL budget
+	handler.SetBudgets(Budgets{URLLimiter: ratelimit.NewRateLimiter(10, 10, time.Minute), URLLimit: 10})
+	if status, errorText := upload(11); status != http.StatusRequestEntityTooLarge || errorText != "Too many URLs" {
+		t.Errorf("expected 413 over the URL budget, got %d %q", status, errorText)
+	}
+
+	if total := svc.GetResults().TotalURLs; total != 0 {
+		t.Errorf("expected rejected uploads to submit nothing, got %d URLs", total)
+	}
+	if status, _ := upload(10); status != http.StatusAccepted {
+		t.Errorf("expected an upload within the limits to be accepted, got %d", status)
+	}
+}
+
+func TestJSONURLListsUseUploadMaxURLs(t *testing.T) {
+	handler := createTestHandler()
+	handler.SetUploadLimits(1024, 2)
+
+	urls := `["http://127.0.0.1:1/a", "http://127.0.0.1:1/b", "http://127.0.0.1:1/c"]`
+	tests := []struct {
+		name     string
+		endpoint http.HandlerFunc
+		body     string
+	}{
+		{"fetch", handler.HandlePostFetch, `{"urls": ` + urls + `}`},
+		{"schedule", handler.HandleSchedules, `{"urls": ` + urls + `, "interval": "1h"}`},
+		{"crawl", handler.HandleCrawl, `{"seeds": ` + urls + `}`},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+		w := httptest.NewRecorder()
+		tt.endpoint(w, req)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: expected 413 for more than UPLOAD_MAX_URLS URLs, got %d", tt.name, w.Code)
+		}
+	}
+}
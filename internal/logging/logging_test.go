@@ -0,0 +1,75 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestIDInLogRecords(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "info", FormatJSON)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	ctx := WithRequestID(context.Background(), "req-1")
+	logger.With("component", "test").InfoContext(ctx, "Fetched URL", "url", "https://example.com", "duration", 1500*time.Millisecond)
+	logger.Debug("Not logged at info level")
+	logger.Info("Without request")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 log lines, got %d:\n%s", len(lines), buf.String())
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("expected a JSON record, got %q: %v", lines[0], err)
+	}
+	if record["request_id"] != "req-1" || record["url"] != "https://example.com" || record["component"] != "test" || record["duration"] != "1.5s" {
+		t.Errorf("unexpected record %v", record)
+	}
+	if strings.Contains(lines[1], "request_id") {
+		t.Errorf("expected no request ID without one in the context, got %s", lines[1])
+	}
+}
+
+func TestNewValidation(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "WARN", FormatText)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if logger.Enabled(context.Background(), slog.LevelInfo) || !logger.Enabled(context.Background(), slog.LevelWarn) {
+		t.Error("expected the warn level to be case-insensitive and applied")
+	}
+	logger.Warn("Text record", "key", "value")
+	if !strings.Contains(buf.String(), "key=value") {
+		t.Errorf("expected a text record, got %q", buf.String())
+	}
+
+	if _, err := New(&buf, "verbose", FormatJSON); err == nil {
+		t.Error("expected error for an unknown level")
+	}
+	if _, err := New(&buf, "info", "xml"); err == nil {
+		t.Error("expected error for an unknown format")
+	}
+	if RequestID(WithRequestID(context.Background(), "")) != "" {
+		t.Error("expected an empty request ID to be ignored")
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	defer defaultLevel.Set(defaultLevel.Level())
+
+	if err := SetLevel("debug"); err != nil || defaultLevel.Level() != slog.LevelDebug {
+		t.Errorf("expected the debug level, got %v (%v)", defaultLevel.Level(), err)
+	}
+	if err := SetLevel("loud"); err == nil || defaultLevel.Level() != slog.LevelDebug {
+		t.Errorf("expected an unknown level to be rejected and the level kept, got %v", defaultLevel.Level())
+	}
+}
@@ -0,0 +1,362 @@
+// Package metrics collects counters, gauges and histograms and writes them
+// in the Prometheus text exposition format
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the media type of the text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Metric types as written in TYPE lines
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// Labels are constant label values of a gauge
+type Labels map[string]string
+
+// collector is a metric of a family, writing its samples
+type collector interface {
+	samples() []sample
+}
+
+// sample is a single line of the exposition
+type sample struct {
+	suffix string // Appended to the family name, e.g. "_bucket"
+	series string // Label set of the series the sample belongs to, for ordering
+	labels string // Rendered label set, without braces
+	value  float64
+}
+
+// family groups the metrics sharing a name, HELP and TYPE
+type family struct {
+	name       string
+	help       string
+	typ        string
+	collectors map[string]collector // Keyed by the metric's label names or constant labels
+}
+
+// Registry holds metrics by name. Registering a metric that already exists
+// returns the existing one, so components created more than once share it.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// register adds a collector to the family name, returning the collector
+// already registered under key instead if there is one. It panics when the
+// name is registered with another type, as that is a programming error.
+func (r *Registry) register(name, help, typ, key string, c collector) collector {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{name: name, help: help, typ: typ, collectors: make(map[string]collector)}
+		r.families[name] = f
+	}
+	if f.typ != typ {
+		panic(fmt.Sprintf("metrics: %s registered as %s and %s", name, f.typ, typ))
+	}
+	if existing, ok := f.collectors[key]; ok {
+		return existing
+	}
+	f.collectors[key] = c
+	return c
+}
+
+// NewCounter registers a counter with the given label names
+func (r *Registry) NewCounter(name, help string, labelNames ...string) *Counter {
+	c := &Counter{labelNames: labelNames, values: make(map[string]float64)}
+	existing, ok := r.register(name, help, typeCounter, strings.Join(labelNames, ","), c).(*Counter)
+	if !ok {
+		panic(fmt.Sprintf("metrics: %s registered with other labels", name))
+	}
+	return existing
+}
+
+// NewHistogram registers a histogram with the given upper bucket bounds,
+// which must be sorted, and label names
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	h := &Histogram{buckets: buckets, labelNames: labelNames, series: make(map[string]*histogramSeries)}
+	existing, ok := r.register(name, help, typeHistogram, strings.Join(labelNames, ","), h).(*Histogram)
+	if !ok {
+		panic(fmt.Sprintf("metrics: %s registered with other labels", name))
+	}
+	return existing
+}
+
+// NewGaugeFunc registers a gauge whose value is read from fn on every
+// scrape. Registering the same name and labels again replaces fn.
+func (r *Registry) NewGaugeFunc(name, help string, labels Labels, fn func() float64) {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	values := make([]string, len(names))
+	for i, name := range names {
+		values[i] = labels[name]
+	}
+
+	g := &gaugeFunc{labels: formatLabels(names, values), fn: fn}
+	if existing := r.register(name, help, typeGauge, g.labels, g).(*gaugeFunc); existing != g {
+		existing.set(fn)
+	}
+}
+
+// WriteText writes all metrics in the text exposition format, ordered by
+// name and labels
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.Unlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		r.mu.Lock()
+		collectors := make([]collector, 0, len(f.collectors))
+		for _, c := range f.collectors {
+			collectors = append(collectors, c)
+		}
+		r.mu.Unlock()
+
+		var samples []sample
+		for _, c := range collectors {
+			samples = append(samples, c.samples()...)
+		}
+		// Histogram samples keep their bucket order within a series
+		sort.SliceStable(samples, func(i, j int) bool { return samples[i].series < samples[j].series })
+
+		fmt.Fprintf(bw, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.name, f.typ)
+		for _, s := range samples {
+			bw.WriteString(f.name + s.suffix)
+			if s.labels != "" {
+				bw.WriteString("{" + s.labels + "}")
+			}
+			bw.WriteString(" " + formatValue(s.value) + "\n")
+		}
+	}
+	return bw.Flush()
+}
+
+// Counter is a monotonically increasing value per label set
+type Counter struct {
+	labelNames []string
+	mu         sync.Mutex
+	values     map[string]float64 // Rendered labels -> value
+}
+
+// Inc adds 1 to the counter of the given label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the counter of the given
+// label values
+func (c *Counter) Add(v float64, labelValues ...string) {
+	labels := formatLabels(c.labelNames, labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[labels] += v
+}
+
+// Value returns the counter of the given label values
+func (c *Counter) Value(labelValues ...string) float64 {
+	labels := formatLabels(c.labelNames, labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[labels]
+}
+
+func (c *Counter) samples() []sample {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Counters without labels are reported before their first increment
+	if len(c.labelNames) == 0 && len(c.values) == 0 {
+		return []sample{{}}
+	}
+	samples := make([]sample, 0, len(c.values))
+	for labels, v := range c.values {
+		samples = append(samples, sample{series: labels, labels: labels, value: v})
+	}
+	return samples
+}
+
+// Histogram counts observations into cumulative buckets per label set
+type Histogram struct {
+	buckets    []float64
+	labelNames []string
+	mu         sync.Mutex
+	series     map[string]*histogramSeries // Rendered labels -> series
+}
+
+// histogramSeries holds the observations of one label set
+type histogramSeries struct {
+	counts []uint64 // Per bucket, not cumulative; the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+// Observe records v for the given label values
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	labels := formatLabels(h.labelNames, labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[labels]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets)+1)}
+		h.series[labels] = s
+	}
+	s.counts[sort.SearchFloat64s(h.buckets, v)]++
+	s.sum += v
+	s.count++
+}
+
+// Count returns the number of observations for the given label values
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	labels := formatLabels(h.labelNames, labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.series[labels]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *Histogram) samples() []sample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	series := h.series
+	if len(h.labelNames) == 0 && len(series) == 0 {
+		series = map[string]*histogramSeries{"": {counts: make([]uint64, len(h.buckets)+1)}}
+	}
+
+	var samples []sample
+	for labels, s := range series {
+		var cumulative uint64
+		for i, count := range s.counts {
+			cumulative += count
+			le := math.Inf(1)
+			if i < len(h.buckets) {
+				le = h.buckets[i]
+			}
+			samples = append(samples, sample{
+				suffix: "_bucket",
+				series: labels,
+				labels: joinLabels(labels, `le="`+formatValue(le)+`"`),
+				value:  float64(cumulative),
+			})
+		}
+		samples = append(samples,
+			sample{suffix: "_sum", series: labels, labels: labels, value: s.sum},
+			sample{suffix: "_count", series: labels, labels: labels, value: float64(s.count)},
+		)
+	}
+	return samples
+}
+
+// ExponentialBuckets returns count bucket bounds, starting at start and
+// multiplied by factor each
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+// gaugeFunc is a gauge read when scraped
+type gaugeFunc struct {
+	labels string
+	mu     sync.Mutex
+	fn     func() float64
+}
+
+func (g *gaugeFunc) set(fn func() float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.fn = fn
+}
+
+func (g *gaugeFunc) samples() []sample {
+	g.mu.Lock()
+	fn := g.fn
+	g.mu.Unlock()
+	return []sample{{series: g.labels, labels: g.labels, value: fn()}}
+}
+
+// formatLabels renders label pairs as name="value",... Missing values are
+// empty, which Prometheus treats like an absent label.
+func formatLabels(names, values []string) string {
+	var b strings.Builder
+	for i, name := range names {
+		var value string
+		if i < len(values) {
+			value = values[i]
+		}
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name + `="` + escapeLabel(value) + `"`)
+	}
+	return b.String()
+}
+
+// joinLabels appends a rendered label pair to a rendered label set
+func joinLabels(labels, pair string) string {
+	if labels == "" {
+		return pair
+	}
+	return labels + "," + pair
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// formatValue formats a sample value, spelling infinities as Prometheus does
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("test_requests_total", "Requests by code.", "code")
+	requests.Inc("200")
+	requests.Add(2, "500")
+	r.NewCounter("test_errors_total", "Errors.")
+	r.NewGaugeFunc("test_queue", "Queued \"items\"\nright now.", Labels{"queue": `a"b`}, func() float64 { return 3 })
+	latency := r.NewHistogram("test_latency_seconds", "Latency.", []float64{0.1, 1})
+	latency.Observe(0.05)
+	latency.Observe(0.1)
+	latency.Observe(5)
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	expected := `# HELP test_errors_total Errors.
+# TYPE test_errors_total counter
+test_errors_total 0
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{le="0.1"} 2
+test_latency_seconds_bucket{le="1"} 2
+test_latency_seconds_bucket{le="+Inf"} 3
+test_latency_seconds_sum 5.15
+test_latency_seconds_count 3
+# HELP test_queue Queued "items"\nright now.
+# TYPE test_queue gauge
+test_queue{queue="a\"b"} 3
+# HELP test_requests_total Requests by code.
+# TYPE test_requests_total counter
+test_requests_total{code="200"} 1
+test_requests_total{code="500"} 2
+`
+	if b.String() != expected {
+		t.Errorf("unexpected exposition:\n%s\nexpected:\n%s", b.String(), expected)
+	}
+}
+
+func TestRegisterReturnsExistingMetric(t *testing.T) {
+	r := NewRegistry()
+	a := r.NewCounter("test_total", "Test.", "kind")
+	b := r.NewCounter("test_total", "Test.", "kind")
+	a.Inc("x")
+	b.Inc("x")
+	if a != b || a.Value("x") != 2 {
+		t.Errorf("expected both registrations to share a counter, got %v", a.Value("x"))
+	}
+
+	r.NewGaugeFunc("test_gauge", "Test.", nil, func() float64 { return 1 })
+	r.NewGaugeFunc("test_gauge", "Test.", nil, func() float64 { return 2 })
+	var out strings.Builder
+	r.WriteText(&out)
+	if !strings.Contains(out.String(), "test_gauge 2\n") || strings.Contains(out.String(), "test_gauge 1\n") {
+		t.Errorf("expected the gauge function to be replaced, got:\n%s", out.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic registering a name with another type")
+		}
+	}()
+	r.NewHistogram("test_total", "Test.", []float64{1}, "kind")
+}
@@ -0,0 +1,146 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrWaitTooLong is returned by HostLimiter.Wait when a token would not be
+// available within the maximum wait
+var ErrWaitTooLong = errors.New("egress rate limit wait exceeds the maximum")
+
+// HostLimit is the outbound request rate allowed to a single host
+type HostLimit struct {
+	Rate   int           // Requests per window; 0 leaves the host unlimited
+	Window time.Duration // Window the rate applies to
+	Burst  int           // Requests that may be sent at once
+}
+
+// ParseHostLimits parses "domain:rate:window:burst" entries, as used by the
+// EGRESS_HOST_LIMITS environment variable. Empty window and burst fields
+// keep those of defaults. A domain's limit also applies to its subdomains.
+func ParseHostLimits(entries []string, defaults HostLimit) (map[string]HostLimit, error) {
+	limits := make(map[string]HostLimit, len(entries))
+	for _, entry := range entries {
+		parts := strings.Split(entry, ":")
+		domain := strings.ToLower(strings.TrimSpace(parts[0]))
+		if len(parts) != 4 || domain == "" {
+			return nil, fmt.Errorf("invalid host limit %q (expected domain:rate:window:burst)", entry)
+		}
+
+		limit := defaults
+		rate, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || rate < 0 {
+			return nil, fmt.Errorf("invalid rate in host limit %q", entry)
+		}
+		limit.Rate = rate
+		if v := strings.TrimSpace(parts[2]); v != "" {
+			window, err := time.ParseDuration(v)
+			if err != nil || window <= 0 {
+				return nil, fmt.Errorf("invalid window in host limit %q", entry)
+			}
+			limit.Window = window
+		}
+		if v := strings.TrimSpace(parts[3]); v != "" {
+			burst, err := strconv.Atoi(v)
+			if err != nil || burst <= 0 {
+				return nil, fmt.Errorf("invalid burst in host limit %q", entry)
+			}
+			limit.Burst = burst
+		}
+		limits[domain] = limit
+	}
+	return limits, nil
+}
+
+// HostLimiter limits outbound requests with a token bucket per target host,
+// so fetches respect third-party rate limits without coordination
+type HostLimiter struct {
+	defaults  *RateLimiter            // nil when hosts without an override are unlimited
+	overrides map[string]*RateLimiter // Domain -> limiter, nil for unlimited domains
+	maxWait   time.Duration
+}
+
+// NewHostLimiter creates a limiter applying defaults to every host, except
+// for the domains in overrides. Wait gives up on tokens further away than
+// maxWait (0 waits as long as the context allows).
+func NewHostLimiter(defaults HostLimit, overrides map[string]HostLimit, maxWait time.Duration) (*HostLimiter, error) {
+	hl := &HostLimiter{
+		overrides: make(map[string]*RateLimiter, len(overrides)),
+		maxWait:   maxWait,
+	}
+
+	var err error
+	if hl.defaults, err = newHostRateLimiter(defaults); err != nil {
+		return nil, fmt.Errorf("invalid default egress rate limit: %w", err)
+	}
+	for domain, limit := range overrides {
+		if hl.overrides[domain], err = newHostRateLimiter(limit); err != nil {
+			return nil, fmt.Errorf("invalid egress rate limit for %s: %w", domain, err)
+		}
+	}
+	return hl, nil
+}
+
+// newHostRateLimiter creates the token bucket for a limit, nil if unlimited
+func newHostRateLimiter(limit HostLimit) (*RateLimiter, error) {
+	if limit.Rate == 0 {
+		return nil, nil
+	}
+	return NewRateLimiterWithAlgorithm(AlgorithmTokenBucket, limit.Rate, limit.Burst, limit.Window)
+}
+
+// Wait blocks until a request to host may be sent and returns how long it
+// was throttled. It fails without waiting when the token is further away
+// than the maximum wait, and when ctx ends first.
+func (hl *HostLimiter) Wait(ctx context.Context, host string) (time.Duration, error) {
+	limiter := hl.limiterFor(host)
+	if limiter == nil {
+		return 0, nil
+	}
+
+	host = strings.ToLower(host)
+	start := time.Now()
+	for {
+		d := limiter.Take(host, 1)
+		if d.Allowed {
+			return time.Since(start), nil
+		}
+
+		waited := time.Since(start)
+		if hl.maxWait > 0 && waited+d.RetryAfter > hl.maxWait {
+			return waited, fmt.Errorf("%w of %v for %s", ErrWaitTooLong, hl.maxWait, host)
+		}
+
+		// Other workers may take the token first, so it is retried rather
+		// than assumed after the wait
+		timer := time.NewTimer(d.RetryAfter)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return time.Since(start), ctx.Err()
+		}
+	}
+}
+
+// limiterFor returns the limiter of the most specific domain matching host,
+// or the default one
+func (hl *HostLimiter) limiterFor(host string) *RateLimiter {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for domain := host; domain != ""; {
+		if limiter, ok := hl.overrides[domain]; ok {
+			return limiter
+		}
+		_, parent, found := strings.Cut(domain, ".")
+		if !found {
+			break
+		}
+		domain = parent
+	}
+	return hl.defaults
+}
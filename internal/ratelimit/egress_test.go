@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseHostLimits(t *testing.T) {
+	defaults := HostLimit{Rate: 5, Window: time.Second, Burst: 1}
+	limits, err := ParseHostLimits([]string{"API.example.com:100:1m:10", "slow.org:1::", "internal.net:0::"}, defaults)
+	if err != nil {
+		t.Fatalf("ParseHostLimits failed: %v", err)
+	}
+	expected := map[string]HostLimit{
+		"api.example.com": {Rate: 100, Window: time.Minute, Burst: 10},
+		"slow.org":        {Rate: 1, Window: time.Second, Burst: 1},
+		"internal.net":    {Rate: 0, Window: time.Second, Burst: 1},
+	}
+	for domain, limit := range expected {
+		if limits[domain] != limit {
+			t.Errorf("%s: expected %+v, got %+v", domain, limit, limits[domain])
+		}
+	}
+
+	for _, entry := range []string{"example.com:5", ":5:1s:1", "example.com:x:1s:1", "example.com:5:soon:1", "example.com:5:1s:0"} {
+		if _, err := ParseHostLimits([]string{entry}, defaults); err == nil {
+			t.Errorf("expected error for %q", entry)
+		}
+	}
+}
+
+func TestHostLimiterWait(t *testing.T) {
+	// One request per 100ms to any host, none limited for internal.net
+	hl, err := NewHostLimiter(
+		HostLimit{Rate: 10, Window: time.Second, Burst: 1},
+		map[string]HostLimit{"internal.net": {}, "api.example.com": {Rate: 1, Window: time.Hour, Burst: 1}},
+		time.Second,
+	)
+	if err != nil {
+		t.Fatalf("NewHostLimiter failed: %v", err)
+	}
+	ctx := context.Background()
+
+	if waited, err := hl.Wait(ctx, "example.com"); err != nil || waited > 50*time.Millisecond {
+		t.Errorf("expected the first request to go out immediately, waited %v (%v)", waited, err)
+	}
+	if waited, err := hl.Wait(ctx, "Example.com"); err != nil || waited < 50*time.Millisecond {
+		t.Errorf("expected the second request to wait for a token, waited %v (%v)", waited, err)
+	}
+	if waited, _ := hl.Wait(ctx, "other.com"); waited > 50*time.Millisecond {
+		t.Errorf("expected hosts to have separate buckets, waited %v", waited)
+	}
+
+	for i := 0; i < 3; i++ {
+		if waited, _ := hl.Wait(ctx, "db.internal.net"); waited != 0 {
+			t.Errorf("expected subdomains of an unlimited domain not to wait, waited %v", waited)
+		}
+	}
+
+	// The override's next token is an hour away, beyond the maximum wait
+	hl.Wait(ctx, "v2.api.example.com")
+	if _, err := hl.Wait(ctx, "v2.api.example.com"); !errors.Is(err, ErrWaitTooLong) {
+		t.Errorf("expected ErrWaitTooLong, got %v", err)
+	}
+}
+
+func TestHostLimiterWaitHonorsContext(t *testing.T) {
+	hl, err := NewHostLimiter(HostLimit{Rate: 1, Window: time.Hour, Burst: 1}, nil, 0)
+	if err != nil {
+		t.Fatalf("NewHostLimiter failed: %v", err)
+	}
+	hl.Wait(context.Background(), "example.com")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := hl.Wait(ctx, "example.com"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the wait to end with the context, got %v", err)
+	}
+}
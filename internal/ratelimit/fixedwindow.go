@@ -0,0 +1,171 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// fixedWindow limits requests per window with an approximate token refill
+// for bursts. Counters and tokens start over with every window.
+type fixedWindow struct {
+	mu       sync.RWMutex
+	visitors map[string]*Visitor
+	rate     int
+	burst    int
+	window   time.Duration
+	now      func() time.Time
+}
+
+// Visitor tracks rate limit info for a single IP
+type Visitor struct {
+	tokens       int
+	lastSeen     time.Time
+	windowStart  time.Time
+	requestCount int
+}
+
+func newFixedWindow(rate, burst int, window time.Duration, now func() time.Time) *fixedWindow {
+	return &fixedWindow{
+		visitors: make(map[string]*Visitor),
+		rate:     rate,
+		burst:    burst,
+		window:   window,
+		now:      now,
+	}
+}
+
+// Take checks if n units may be consumed by key at once. Either all n are
+// consumed or none.
+func (fw *fixedWindow) Take(key string, n int) Decision {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	now := fw.now()
+
+	// A batch larger than a whole window's budget can never pass
+	if n > fw.rate || n > fw.burst {
+		return rejected(fw.decision(fw.visitors[key], now))
+	}
+
+	visitor, exists := fw.visitors[key]
+	if !exists {
+		visitor = &Visitor{
+			tokens:       fw.burst - n,
+			lastSeen:     now,
+			windowStart:  now,
+			requestCount: n,
+		}
+		fw.visitors[key] = visitor
+		return fw.allowed(visitor, now)
+	}
+
+	visitor.lastSeen = now
+
+	// Check if we're in a new window
+	if now.Sub(visitor.windowStart) > fw.window {
+		visitor.windowStart = now
+		visitor.requestCount = n
+		visitor.tokens = fw.burst - n
+		return fw.allowed(visitor, now)
+	}
+
+	// Check request count limit
+	if visitor.requestCount+n > fw.rate {
+		return rejected(fw.decision(visitor, now))
+	}
+
+	// Refill tokens based on time passed
+	visitor.tokens = min(visitor.tokens+fw.refill(visitor, now), fw.burst)
+
+	// Check if we have tokens available
+	if visitor.tokens >= n {
+		visitor.tokens -= n
+		visitor.requestCount += n
+		return fw.allowed(visitor, now)
+	}
+
+	// Wait until enough tokens have been refilled, or the window resets
+	d := rejected(fw.decision(visitor, now))
+	if fw.burst > 0 {
+		needed := time.Duration(n-visitor.tokens) * fw.window / time.Duration(fw.burst)
+		if wait := visitor.windowStart.Add(needed).Sub(now); wait < d.RetryAfter {
+			d.RetryAfter = max(wait, time.Second)
+		}
+	}
+	return d
+}
+
+// Peek reports key's current budget without consuming any of it
+func (fw *fixedWindow) Peek(key string) Decision {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+
+	d := fw.decision(fw.visitors[key], fw.now())
+	d.Allowed = d.Remaining > 0
+	return d
+}
+
+// Limit returns the number of requests allowed per window
+func (fw *fixedWindow) Limit() int {
+	return fw.rate
+}
+
+// Window returns the rate limit window
+func (fw *fixedWindow) Window() time.Duration {
+	return fw.window
+}
+
+// Len returns the number of tracked visitors
+func (fw *fixedWindow) Len() int {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+	return len(fw.visitors)
+}
+
+// Cleanup removes visitors that haven't been seen for two windows
+func (fw *fixedWindow) Cleanup() {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	now := fw.now()
+	for ip, visitor := range fw.visitors {
+		if now.Sub(visitor.lastSeen) > fw.window*2 {
+			delete(fw.visitors, ip)
+		}
+	}
+}
+
+// allowed builds the decision for a request that was just admitted
+func (fw *fixedWindow) allowed(visitor *Visitor, now time.Time) Decision {
+	d := fw.decision(visitor, now)
+	d.Allowed = true
+	return d
+}
+
+// decision reports a visitor's budget at now without modifying it.
+// Callers must hold fw.mu.
+func (fw *fixedWindow) decision(visitor *Visitor, now time.Time) Decision {
+	d := Decision{Limit: fw.rate}
+	if visitor == nil || now.Sub(visitor.windowStart) > fw.window {
+		d.Remaining = min(fw.rate, fw.burst)
+		d.Reset = fw.window
+		return d
+	}
+
+	tokens := min(visitor.tokens+fw.refill(visitor, now), fw.burst)
+	d.Remaining = max(min(fw.rate-visitor.requestCount, tokens), 0)
+	d.Reset = visitor.windowStart.Add(fw.window).Sub(now)
+	return d
+}
+
+// refill returns the tokens regained since the visitor's window started
+func (fw *fixedWindow) refill(visitor *Visitor, now time.Time) int {
+	elapsed := now.Sub(visitor.windowStart)
+	windowSeconds := fw.window.Seconds()
+
+	// Avoid divide by zero - if window is too small, just use the burst
+	if windowSeconds > 0 {
+		return int(elapsed.Seconds() * float64(fw.burst) / windowSeconds)
+	}
+	return fw.burst
+}
@@ -0,0 +1,120 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// gcra implements the generic cell rate algorithm: each key stores only its
+// theoretical arrival time (TAT), which every admitted unit pushes back by
+// the emission interval window/rate. Requests are admitted while the TAT
+// stays within burst intervals of now.
+type gcra struct {
+	mu       sync.Mutex
+	tats     map[string]time.Time
+	rate     int
+	burst    int
+	window   time.Duration
+	interval time.Duration // Emission interval between units at the sustained rate
+	now      func() time.Time
+}
+
+func newGCRA(rate, burst int, window time.Duration, now func() time.Time) *gcra {
+	return &gcra{
+		tats:     make(map[string]time.Time),
+		rate:     rate,
+		burst:    burst,
+		window:   window,
+		interval: window / time.Duration(rate),
+		now:      now,
+	}
+}
+
+// Take admits n units for key if they conform to the rate and burst
+func (g *gcra) Take(key string, n int) Decision {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	tat := g.tat(key, now)
+	if n > g.burst {
+		return rejected(g.decision(tat, now))
+	}
+
+	newTAT := tat.Add(time.Duration(n) * g.interval)
+	if allowAt := newTAT.Add(-g.tolerance()); allowAt.After(now) {
+		d := g.decision(tat, now)
+		d.RetryAfter = allowAt.Sub(now)
+		return d
+	}
+
+	g.tats[key] = newTAT
+	d := g.decision(newTAT, now)
+	d.Allowed = true
+	return d
+}
+
+// Peek reports key's current budget without consuming any of it
+func (g *gcra) Peek(key string) Decision {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	d := g.decision(g.tat(key, now), now)
+	d.Allowed = d.Remaining > 0
+	return d
+}
+
+// Limit returns the sustained number of units per window
+func (g *gcra) Limit() int {
+	return g.rate
+}
+
+// Window returns the rate limit window
+func (g *gcra) Window() time.Duration {
+	return g.window
+}
+
+// Len returns the number of tracked keys
+func (g *gcra) Len() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.tats)
+}
+
+// Cleanup forgets keys whose TAT has passed
+func (g *gcra) Cleanup() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	for key, tat := range g.tats {
+		if !tat.After(now) {
+			delete(g.tats, key)
+		}
+	}
+}
+
+// tat returns key's theoretical arrival time, no earlier than now.
+// Callers must hold g.mu.
+func (g *gcra) tat(key string, now time.Time) time.Time {
+	if tat, ok := g.tats[key]; ok && tat.After(now) {
+		return tat
+	}
+	return now
+}
+
+// tolerance returns how far the TAT may run ahead of now
+func (g *gcra) tolerance() time.Duration {
+	return time.Duration(g.burst) * g.interval
+}
+
+// decision reports the budget left by a TAT
+func (g *gcra) decision(tat, now time.Time) Decision {
+	ahead := tat.Sub(now)
+	return Decision{
+		Limit:     g.rate,
+		Remaining: min(max(int((g.tolerance()-ahead)/g.interval), 0), g.rate),
+		Reset:     ahead,
+	}
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"fmt"
+	"time"
+)
+
+// Rate limiting algorithms, selectable with RATE_LIMIT_ALGORITHM
+const (
+	AlgorithmFixedWindow   = "fixed_window"   // Per-window counter with a token refill (the original limiter)
+	AlgorithmTokenBucket   = "token_bucket"   // Continuously refilled bucket of burst tokens
+	AlgorithmSlidingLog    = "sliding_log"    // Exact count over the trailing window
+	AlgorithmSlidingWindow = "sliding_window" // Weighted count of the current and previous window
+	AlgorithmGCRA          = "gcra"           // Generic cell rate algorithm
+)
+
+// Limiter decides whether keys may consume units of a rate limit
+type Limiter interface {
+	// Take consumes n units for key if all of them are available
+	Take(key string, n int) Decision
+	// Peek reports key's current budget without consuming any of it
+	Peek(key string) Decision
+	// Limit returns the number of units allowed per window
+	Limit() int
+	// Window returns the rate limit window
+	Window() time.Duration
+	// Len returns the number of keys currently tracked
+	Len() int
+	// Cleanup forgets keys whose budget has fully recovered
+	Cleanup()
+}
+
+// NewLimiter creates a limiter using algorithm, allowing rate units per
+// window with bursts of up to burst units
+func NewLimiter(algorithm string, rate, burst int, window time.Duration) (Limiter, error) {
+	return newLimiter(algorithm, rate, burst, window, time.Now)
+}
+
+// newLimiter is NewLimiter with a clock, for tests
+func newLimiter(algorithm string, rate, burst int, window time.Duration, now func() time.Time) (Limiter, error) {
+	if rate <= 0 || window <= 0 {
+		return nil, fmt.Errorf("rate limit requires a positive rate and window, got %d per %v", rate, window)
+	}
+
+	switch algorithm {
+	case AlgorithmFixedWindow, "":
+		return newFixedWindow(rate, burst, window, now), nil
+	case AlgorithmSlidingLog:
+		return newSlidingLog(rate, window, now), nil
+	case AlgorithmSlidingWindow:
+		return newSlidingWindow(rate, window, now), nil
+	case AlgorithmTokenBucket, AlgorithmGCRA:
+		if burst <= 0 {
+			return nil, fmt.Errorf("%s rate limit requires a positive burst, got %d", algorithm, burst)
+		}
+		if algorithm == AlgorithmGCRA {
+			return newGCRA(rate, burst, window, now), nil
+		}
+		return newTokenBucket(rate, burst, window, now), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit algorithm %q (expected %s, %s, %s, %s or %s)", algorithm,
+			AlgorithmFixedWindow, AlgorithmTokenBucket, AlgorithmSlidingLog, AlgorithmSlidingWindow, AlgorithmGCRA)
+	}
+}
+
+// rejected builds the decision for a request that can never pass because
+// it asks for more than the limiter's capacity
+func rejected(d Decision) Decision {
+	d.Allowed = false
+	d.RetryAfter = d.Reset
+	return d
+}
@@ -0,0 +1,242 @@
+package ratelimit
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock for deterministic limiter tests
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestLimiter(t *testing.T, algorithm string, rate, burst int, window time.Duration) (Limiter, *fakeClock) {
+	t.Helper()
+	clock := newFakeClock()
+	limiter, err := newLimiter(algorithm, rate, burst, window, clock.Now)
+	if err != nil {
+		t.Fatalf("newLimiter(%s) failed: %v", algorithm, err)
+	}
+	return limiter, clock
+}
+
+// expectTake takes n units and checks whether they were allowed
+func expectTake(t *testing.T, l Limiter, key string, n int, allowed bool) Decision {
+	t.Helper()
+	d := l.Take(key, n)
+	if d.Allowed != allowed {
+		t.Fatalf("Take(%s, %d): expected allowed=%t, got %+v", key, n, allowed, d)
+	}
+	return d
+}
+
+func TestTokenBucket(t *testing.T) {
+	// 10 tokens per minute: one every 6s, up to 5 at once
+	l, clock := newTestLimiter(t, AlgorithmTokenBucket, 10, 5, time.Minute)
+
+	d := expectTake(t, l, "a", 5, true)
+	if d.Remaining != 0 || d.Reset != 30*time.Second {
+		t.Errorf("expected empty bucket refilled in 30s, got %+v", d)
+	}
+	d = expectTake(t, l, "a", 1, false)
+	if d.RetryAfter != 6*time.Second {
+		t.Errorf("expected retry after 6s, got %v", d.RetryAfter)
+	}
+
+	// Tokens refill continuously rather than per window
+	clock.Advance(12 * time.Second)
+	if d := l.Peek("a"); d.Remaining != 2 {
+		t.Errorf("expected 2 tokens after 12s, got %+v", d)
+	}
+	expectTake(t, l, "a", 2, true)
+	d = expectTake(t, l, "a", 3, false)
+	if d.RetryAfter != 18*time.Second {
+		t.Errorf("expected retry after 18s for 3 tokens, got %v", d.RetryAfter)
+	}
+
+	// The bucket never holds more than burst tokens
+	clock.Advance(time.Hour)
+	if d := l.Peek("a"); d.Remaining != 5 || d.Reset != 0 {
+		t.Errorf("expected a full bucket, got %+v", d)
+	}
+	expectTake(t, l, "a", 6, false)
+
+	l.Cleanup()
+	if l.Len() != 0 {
+		t.Errorf("expected full buckets to be cleaned up, got %d keys", l.Len())
+	}
+}
+
+func TestSlidingLog(t *testing.T) {
+	l, clock := newTestLimiter(t, AlgorithmSlidingLog, 3, 0, time.Minute)
+
+	expectTake(t, l, "a", 2, true)
+	clock.Advance(20 * time.Second)
+	d := expectTake(t, l, "a", 1, true)
+	if d.Remaining != 0 || d.Reset != time.Minute {
+		t.Errorf("expected no budget until the newest entry expires, got %+v", d)
+	}
+
+	// The first two units leave the window 60s after they were taken
+	d = expectTake(t, l, "a", 1, false)
+	if d.RetryAfter != 40*time.Second {
+		t.Errorf("expected retry after 40s, got %v", d.RetryAfter)
+	}
+	d = expectTake(t, l, "a", 3, false)
+	if d.RetryAfter != time.Minute {
+		t.Errorf("expected retry after 60s for the whole budget, got %v", d.RetryAfter)
+	}
+
+	// Unlike a fixed window, there is no boundary to burst across
+	clock.Advance(39 * time.Second)
+	expectTake(t, l, "a", 1, false)
+	clock.Advance(time.Second)
+	expectTake(t, l, "a", 2, true)
+	expectTake(t, l, "b", 3, true)
+
+	clock.Advance(2 * time.Minute)
+	l.Cleanup()
+	if l.Len() != 0 {
+		t.Errorf("expected expired logs to be cleaned up, got %d keys", l.Len())
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	l, clock := newTestLimiter(t, AlgorithmSlidingWindow, 10, 0, time.Minute)
+
+	expectTake(t, l, "a", 10, true)
+	d := expectTake(t, l, "a", 1, false)
+	if d.RetryAfter != time.Minute+6*time.Second {
+		t.Errorf("expected retry after 66s, got %v", d.RetryAfter)
+	}
+
+	// A quarter into the next window, 75% of the previous count still weighs in
+	clock.Advance(time.Minute + 15*time.Second)
+	if d := l.Peek("a"); d.Remaining != 2 {
+		t.Errorf("expected 2 remaining, got %+v", d)
+	}
+	expectTake(t, l, "a", 2, true)
+	d = expectTake(t, l, "a", 2, false)
+	// 4 units fit once the previous window weighs 60%, 24s into this one
+	if d.RetryAfter != 9*time.Second {
+		t.Errorf("expected retry after 9s, got %v", d.RetryAfter)
+	}
+	if d.Reset != time.Minute+45*time.Second {
+		t.Errorf("expected reset at the end of the next window, got %v", d.Reset)
+	}
+
+	clock.Advance(8 * time.Second)
+	expectTake(t, l, "a", 2, false)
+	clock.Advance(time.Second)
+	expectTake(t, l, "a", 2, true)
+	expectTake(t, l, "a", 11, false)
+
+	clock.Advance(2 * time.Minute)
+	l.Cleanup()
+	if l.Len() != 0 {
+		t.Errorf("expected idle counters to be cleaned up, got %d keys", l.Len())
+	}
+}
+
+func TestGCRA(t *testing.T) {
+	// One unit every 6s, bursts of up to 3
+	l, clock := newTestLimiter(t, AlgorithmGCRA, 10, 3, time.Minute)
+
+	d := expectTake(t, l, "a", 3, true)
+	if d.Remaining != 0 || d.Reset != 18*time.Second {
+		t.Errorf("expected burst spent for 18s, got %+v", d)
+	}
+	d = expectTake(t, l, "a", 1, false)
+	if d.RetryAfter != 6*time.Second {
+		t.Errorf("expected retry after 6s, got %v", d.RetryAfter)
+	}
+
+	// Requests conform again at the sustained rate
+	clock.Advance(6 * time.Second)
+	expectTake(t, l, "a", 1, true)
+	expectTake(t, l, "a", 1, false)
+	clock.Advance(5 * time.Second)
+	expectTake(t, l, "a", 1, false)
+	clock.Advance(time.Second)
+	expectTake(t, l, "a", 1, true)
+
+	d = expectTake(t, l, "a", 2, false)
+	if d.RetryAfter != 12*time.Second {
+		t.Errorf("expected retry after 12s for 2 units, got %v", d.RetryAfter)
+	}
+	expectTake(t, l, "b", 4, false)
+
+	clock.Advance(time.Minute)
+	if d := l.Peek("a"); d.Remaining != 3 || d.Reset != 0 {
+		t.Errorf("expected the full burst back, got %+v", d)
+	}
+	l.Cleanup()
+	if l.Len() != 0 {
+		t.Errorf("expected idle keys to be cleaned up, got %d keys", l.Len())
+	}
+}
+
+func TestFixedWindowResetsEachWindow(t *testing.T) {
+	l, clock := newTestLimiter(t, AlgorithmFixedWindow, 3, 3, time.Minute)
+
+	expectTake(t, l, "a", 3, true)
+	d := expectTake(t, l, "a", 1, false)
+	if d.RetryAfter != time.Minute {
+		t.Errorf("expected retry once the window resets, got %v", d.RetryAfter)
+	}
+
+	clock.Advance(time.Minute + time.Second)
+	expectTake(t, l, "a", 3, true)
+
+	clock.Advance(3 * time.Minute)
+	l.Cleanup()
+	if l.Len() != 0 {
+		t.Errorf("expected idle visitors to be cleaned up, got %d keys", l.Len())
+	}
+}
+
+func TestNewLimiterValidation(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmFixedWindow, AlgorithmTokenBucket, AlgorithmSlidingLog, AlgorithmSlidingWindow, AlgorithmGCRA} {
+		if _, err := NewLimiter(algorithm, 10, 5, time.Minute); err != nil {
+			t.Errorf("%s: unexpected error: %v", algorithm, err)
+		}
+		if _, err := NewLimiter(algorithm, 0, 5, time.Minute); err == nil {
+			t.Errorf("%s: expected error for a zero rate", algorithm)
+		}
+	}
+	if _, err := NewLimiter(AlgorithmGCRA, 10, 0, time.Minute); err == nil {
+		t.Error("expected error for GCRA without burst")
+	}
+	if _, err := NewLimiter("leaky", 10, 5, time.Minute); err == nil {
+		t.Error("expected error for an unknown algorithm")
+	}
+
+	rl, err := NewRateLimiterWithAlgorithm(AlgorithmSlidingLog, 2, 0, time.Minute)
+	if err != nil {
+		t.Fatalf("NewRateLimiterWithAlgorithm failed: %v", err)
+	}
+	if !rl.AllowN("a", 2) || rl.Allow("a") {
+		t.Error("expected the facade to enforce the selected algorithm")
+	}
+	if stats := rl.GetStats(); stats["algorithm"] != AlgorithmSlidingLog || stats["active_ips"] != 1 {
+		t.Errorf("unexpected stats %v", stats)
+	}
+}
@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// DailyQuota counts usage per key over a UTC calendar day
+type DailyQuota struct {
+	mu    sync.Mutex
+	limit int            // Default limit; 0 means unlimited
+	day   string         // UTC day the counters belong to, e.g. "2024-05-01"
+	used  map[string]int // Key -> units used today
+	now   func() time.Time
+}
+
+// NewDailyQuota creates a quota allowing limit units per key and day.
+// A limit of 0 disables the quota unless a key has its own limit.
+func NewDailyQuota(limit int) *DailyQuota {
+	return &DailyQuota{
+		limit: limit,
+		used:  make(map[string]int),
+		now:   time.Now,
+	}
+}
+
+// Use consumes n units for key if they fit into today's quota and returns
+// the remaining units (-1 when unlimited). A positive keyLimit overrides the
+// default limit for this key.
+func (q *DailyQuota) Use(key string, n int, keyLimit int) (remaining int, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.rollover()
+
+	limit := q.limitFor(keyLimit)
+	if limit <= 0 {
+		return -1, true
+	}
+
+	used := q.used[key]
+	if used+n > limit {
+		return limit - used, false
+	}
+	q.used[key] = used + n
+	return limit - used - n, true
+}
+
+// Remaining returns the units key has left today (-1 when unlimited)
+func (q *DailyQuota) Remaining(key string, keyLimit int) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.rollover()
+
+	limit := q.limitFor(keyLimit)
+	if limit <= 0 {
+		return -1
+	}
+	return max(limit-q.used[key], 0)
+}
+
+// Limit returns the units a key with the given override may use per day,
+// 0 when unlimited
+func (q *DailyQuota) Limit(keyLimit int) int {
+	return q.limitFor(keyLimit)
+}
+
+// Reset returns when the current day's counters are reset
+func (q *DailyQuota) Reset() time.Time {
+	now := q.now().UTC()
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+}
+
+// limitFor returns the effective limit for a key-specific override
+func (q *DailyQuota) limitFor(keyLimit int) int {
+	if keyLimit > 0 {
+		return keyLimit
+	}
+	return q.limit
+}
+
+// rollover drops yesterday's counters. Callers must hold q.mu.
+func (q *DailyQuota) rollover() {
+	day := q.now().UTC().Format("2006-01-02")
+	if day != q.day {
+		q.day = day
+		q.used = make(map[string]int)
+	}
+}
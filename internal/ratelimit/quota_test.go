@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDailyQuota(t *testing.T) {
+	now := time.Date(2024, 5, 1, 23, 0, 0, 0, time.UTC)
+	q := NewDailyQuota(10)
+	q.now = func() time.Time { return now }
+
+	if remaining, ok := q.Use("a", 7, 0); !ok || remaining != 3 {
+		t.Errorf("expected 7 units to fit with 3 remaining, got %d (ok: %t)", remaining, ok)
+	}
+	if remaining, ok := q.Use("a", 4, 0); ok || remaining != 3 {
+		t.Errorf("expected 4 units to be rejected with 3 remaining, got %d (ok: %t)", remaining, ok)
+	}
+	if remaining, ok := q.Use("b", 10, 0); !ok || remaining != 0 {
+		t.Errorf("expected keys to have separate quotas, got %d (ok: %t)", remaining, ok)
+	}
+	if remaining, ok := q.Use("c", 15, 20); !ok || remaining != 5 {
+		t.Errorf("expected key limit override, got %d (ok: %t)", remaining, ok)
+	}
+
+	if reset := q.Reset(); !reset.Equal(time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected reset at midnight UTC, got %v", reset)
+	}
+
+	// Counters start over on the next day
+	now = now.Add(2 * time.Hour)
+	if remaining := q.Remaining("a", 0); remaining != 10 {
+		t.Errorf("expected full quota on the next day, got %d", remaining)
+	}
+}
+
+func TestDailyQuotaUnlimited(t *testing.T) {
+	q := NewDailyQuota(0)
+	if remaining, ok := q.Use("a", 1000000, 0); !ok || remaining != -1 {
+		t.Errorf("expected unlimited quota, got %d (ok: %t)", remaining, ok)
+	}
+}
+
+func TestAllowN(t *testing.T) {
+	rl := NewRateLimiter(10, 10, time.Minute)
+
+	if !rl.AllowN("a", 6) {
+		t.Error("expected first batch of 6 to be allowed")
+	}
+	if rl.AllowN("a", 5) {
+		t.Error("expected batch exceeding the remaining budget to be rejected")
+	}
+	if !rl.AllowN("a", 4) {
+		t.Error("expected batch matching the remaining budget to be allowed")
+	}
+	if rl.AllowN("b", 11) {
+		t.Error("expected batch larger than the limit to be rejected")
+	}
+}
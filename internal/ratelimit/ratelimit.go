@@ -5,30 +5,50 @@ import (
 	"time"
 )
 
-// RateLimiter implements token bucket rate limiting per IP
+// RateLimiter implements per-key rate limiting with a configurable algorithm
 type RateLimiter struct {
-	mu       sync.RWMutex
-	visitors map[string]*Visitor
-	rate     int
-	burst    int
-	window   time.Duration
+	mu        sync.RWMutex // Guards the fields replaced by Reconfigure
+	limiter   Limiter
+	algorithm string
+	backend   string // "memory" or "redis"
+	burst     int
 }
 
-// Visitor tracks rate limit info for a single IP
-type Visitor struct {
-	tokens       int
-	lastSeen     time.Time
-	windowStart  time.Time
-	requestCount int
+// NewRateLimiter creates a new rate limiter using the fixed window algorithm
+func NewRateLimiter(rate int, burst int, window time.Duration) *RateLimiter {
+	return newRateLimiter(AlgorithmFixedWindow, newFixedWindow(rate, burst, window, time.Now), burst)
 }
 
-// NewRateLimiter creates a new rate limiter
-func NewRateLimiter(rate int, burst int, window time.Duration) *RateLimiter {
+// NewRateLimiterWithAlgorithm creates a rate limiter using algorithm
+func NewRateLimiterWithAlgorithm(algorithm string, rate int, burst int, window time.Duration) (*RateLimiter, error) {
+	limiter, err := NewLimiter(algorithm, rate, burst, window)
+	if err != nil {
+		return nil, err
+	}
+	if algorithm == "" {
+		algorithm = AlgorithmFixedWindow
+	}
+	return newRateLimiter(algorithm, limiter, burst), nil
+}
+
+// NewRedisRateLimiter creates a rate limiter whose state is shared with
+// other replicas through a Redis store
+func NewRedisRateLimiter(algorithm string, rate int, burst int, window time.Duration, cfg RedisConfig) (*RateLimiter, error) {
+	limiter, err := NewRedisLimiter(algorithm, rate, burst, window, cfg)
+	if err != nil {
+		return nil, err
+	}
+	rl := newRateLimiter(algorithm, limiter, burst)
+	rl.backend = "redis"
+	return rl, nil
+}
+
+func newRateLimiter(algorithm string, limiter Limiter, burst int) *RateLimiter {
 	rl := &RateLimiter{
-		visitors: make(map[string]*Visitor),
-		rate:     rate,
-		burst:    burst,
-		window:   window,
+		limiter:   limiter,
+		algorithm: algorithm,
+		backend:   "memory",
+		burst:     burst,
 	}
 
 	// Cleanup old visitors every minute
@@ -37,60 +57,89 @@ func NewRateLimiter(rate int, burst int, window time.Duration) *RateLimiter {
 	return rl
 }
 
-// Allow checks if a request from the given IP should be allowed
-func (rl *RateLimiter) Allow(ip string) bool {
+// Reconfigure replaces the algorithm and limits, keeping the backend. Keys
+// tracked in memory start over with a full budget; state shared through
+// Redis is kept, as are the connections to the store.
+func (rl *RateLimiter) Reconfigure(algorithm string, rate int, burst int, window time.Duration) error {
+	var limiter Limiter
+	var err error
+	if shared, ok := rl.current().(*redisLimiter); ok {
+		limiter, err = shared.withLimits(algorithm, rate, burst, window)
+	} else {
+		limiter, err = NewLimiter(algorithm, rate, burst, window)
+	}
+	if err != nil {
+		return err
+	}
+	if algorithm == "" {
+		algorithm = AlgorithmFixedWindow
+	}
+
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
+	rl.limiter = limiter
+	rl.algorithm = algorithm
+	rl.burst = burst
+	return nil
+}
 
-	now := time.Now()
-
-	visitor, exists := rl.visitors[ip]
-	if !exists {
-		rl.visitors[ip] = &Visitor{
-			tokens:       rl.burst - 1,
-			lastSeen:     now,
-			windowStart:  now,
-			requestCount: 1,
-		}
-		return true
-	}
+// current returns the limiter in use
+func (rl *RateLimiter) current() Limiter {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+	return rl.limiter
+}
 
-	visitor.lastSeen = now
+// Decision is the outcome of a rate limit check
+type Decision struct {
+	Allowed    bool
+	Limit      int           // Requests allowed per window
+	Remaining  int           // Requests left right now
+	Reset      time.Duration // Until the full limit is available again
+	RetryAfter time.Duration // Until a rejected request could succeed; 0 when allowed
+}
 
-	// Check if we're in a new window
-	if now.Sub(visitor.windowStart) > rl.window {
-		visitor.windowStart = now
-		visitor.requestCount = 1
-		visitor.tokens = rl.burst - 1
-		return true
-	}
+// Allow checks if a request from the given IP should be allowed
+func (rl *RateLimiter) Allow(ip string) bool {
+	return rl.AllowN(ip, 1)
+}
 
-	// Check request count limit
-	if visitor.requestCount >= rl.rate {
-		return false
-	}
+// AllowN checks if n units (requests, URLs, ...) may be consumed by key at
+// once. Either all n are consumed or none.
+func (rl *RateLimiter) AllowN(key string, n int) bool {
+	return rl.Take(key, n).Allowed
+}
 
-	// Refill tokens based on time passed
-	elapsed := now.Sub(visitor.windowStart)
-	windowSeconds := rl.window.Seconds()
-	
-	// Avoid divide by zero - if window is too small, just use the burst
-	var tokensToAdd int
-	if windowSeconds > 0 {
-		tokensToAdd = int(elapsed.Seconds() * float64(rl.burst) / windowSeconds)
-	} else {
-		tokensToAdd = rl.burst
-	}
-	visitor.tokens = min(visitor.tokens+tokensToAdd, rl.burst)
+// Take is AllowN reporting the remaining budget and reset times
+func (rl *RateLimiter) Take(key string, n int) Decision {
+	return rl.current().Take(key, n)
+}
 
-	// Check if we have tokens available
-	if visitor.tokens > 0 {
-		visitor.tokens--
-		visitor.requestCount++
-		return true
-	}
+// Peek reports key's current budget without consuming any of it
+func (rl *RateLimiter) Peek(key string) Decision {
+	return rl.current().Peek(key)
+}
+
+// Limit returns the number of requests allowed per window
+func (rl *RateLimiter) Limit() int {
+	return rl.current().Limit()
+}
+
+// Window returns the rate limit window
+func (rl *RateLimiter) Window() time.Duration {
+	return rl.current().Window()
+}
 
-	return false
+// Algorithm returns the name of the rate limiting algorithm
+func (rl *RateLimiter) Algorithm() string {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+	return rl.algorithm
+}
+
+// Len returns the number of keys currently tracked
+func (rl *RateLimiter) Len() int {
+	return rl.current().Len()
 }
 
 // cleanupVisitors removes old visitor entries
@@ -99,14 +148,7 @@ func (rl *RateLimiter) cleanupVisitors() {
 	defer ticker.Stop()
 
 	for range ticker.C {
-		rl.mu.Lock()
-		now := time.Now()
-		for ip, visitor := range rl.visitors {
-			if now.Sub(visitor.lastSeen) > rl.window*2 {
-				delete(rl.visitors, ip)
-			}
-		}
-		rl.mu.Unlock()
+		rl.current().Cleanup()
 	}
 }
 
@@ -114,13 +156,18 @@ func (rl *RateLimiter) cleanupVisitors() {
 func (rl *RateLimiter) GetStats() map[string]interface{} {
 	rl.mu.RLock()
 	defer rl.mu.RUnlock()
-
-	return map[string]interface{}{
-		"active_ips":     len(rl.visitors),
-		"rate_limit":     rl.rate,
+	stats := map[string]interface{}{
+		"algorithm":      rl.algorithm,
+		"backend":        rl.backend,
+		"active_ips":     rl.limiter.Len(),
+		"rate_limit":     rl.limiter.Limit(),
 		"burst_size":     rl.burst,
-		"window_seconds": int(rl.window.Seconds()),
+		"window_seconds": int(rl.limiter.Window().Seconds()),
+	}
+	if shared, ok := rl.limiter.(interface{ Available() bool }); ok {
+		stats["store_available"] = shared.Available()
 	}
+	return stats
 }
 
 func min(a, b int) int {
@@ -129,5 +176,3 @@ func min(a, b int) int {
 	}
 	return b
 }
-
-
@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTakeReportsBudget(t *testing.T) {
+	rl := NewRateLimiter(3, 3, time.Minute)
+
+	if d := rl.Peek("a"); !d.Allowed || d.Limit != 3 || d.Remaining != 3 || d.Reset != time.Minute {
+		t.Errorf("expected a fresh key to have the full budget, got %+v", d)
+	}
+
+	for i, remaining := range []int{2, 1, 0} {
+		d := rl.Take("a", 1)
+		if !d.Allowed || d.Remaining != remaining || d.RetryAfter != 0 {
+			t.Errorf("request %d: expected allowed with %d remaining, got %+v", i+1, remaining, d)
+		}
+		if d.Reset <= 0 || d.Reset > time.Minute {
+			t.Errorf("request %d: expected reset within the window, got %v", i+1, d.Reset)
+		}
+	}
+
+	d := rl.Take("a", 1)
+	if d.Allowed || d.Remaining != 0 {
+		t.Errorf("expected request over the limit to be rejected, got %+v", d)
+	}
+	if d.RetryAfter < time.Second || d.RetryAfter > d.Reset {
+		t.Errorf("expected Retry-After between 1s and the window reset, got %v (reset %v)", d.RetryAfter, d.Reset)
+	}
+
+	if d := rl.Peek("a"); d.Allowed || d.Remaining != 0 {
+		t.Errorf("expected Peek to report the spent budget, got %+v", d)
+	}
+	if d := rl.Peek("b"); d.Remaining != 3 {
+		t.Errorf("expected other keys to be unaffected, got %+v", d)
+	}
+}
+
+func TestTakeRetryAfterWaitsForRefill(t *testing.T) {
+	rl := NewRateLimiter(10, 2, time.Minute)
+
+	rl.Take("a", 2)
+	d := rl.Take("a", 1)
+	if d.Allowed {
+		t.Fatal("expected request to be rejected once the burst is spent")
+	}
+	// One token refills every 30s, well before the window resets
+	if d.RetryAfter < 29*time.Second || d.RetryAfter > 31*time.Second {
+		t.Errorf("expected Retry-After of about 30s, got %v", d.RetryAfter)
+	}
+}
+
+func TestReconfigure(t *testing.T) {
+	rl := NewRateLimiter(2, 2, time.Minute)
+	rl.Take("a", 2)
+
+	if err := rl.Reconfigure(AlgorithmTokenBucket, 5, 3, time.Hour); err != nil {
+		t.Fatalf("Reconfigure failed: %v", err)
+	}
+	if rl.Algorithm() != AlgorithmTokenBucket || rl.Limit() != 5 || rl.Window() != time.Hour {
+		t.Errorf("expected the new limits, got %v", rl.GetStats())
+	}
+	if d := rl.Take("a", 3); !d.Allowed {
+		t.Errorf("expected the new burst to be available, got %+v", d)
+	}
+
+	if err := rl.Reconfigure("leaky", 5, 3, time.Hour); err == nil {
+		t.Error("expected an unknown algorithm to be rejected")
+	}
+	if rl.Algorithm() != AlgorithmTokenBucket {
+		t.Errorf("expected a failed Reconfigure to keep the limiter, got %s", rl.Algorithm())
+	}
+}
@@ -0,0 +1,335 @@
+package ratelimit
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRedisTimeout = 200 * time.Millisecond
+	// redisRetryInterval is how long the local fallback is used before the
+	// store is tried again
+	redisRetryInterval = 5 * time.Second
+)
+
+// RedisConfig configures a rate limiter whose state is shared through a
+// Redis-compatible store, so all replicas enforce one limit together
+type RedisConfig struct {
+	URL     string        // redis://[:password@]host[:port][/db]
+	Prefix  string        // Key prefix, distinguishing limiters sharing a store
+	Timeout time.Duration // Per-command timeout; 0 for the default
+}
+
+// Scripts run atomically on the store. Both use the store's clock, so
+// replicas with skewed clocks agree, and return the key's state for the
+// caller to derive the decision from with the in-memory algorithm's math.
+// Times are in microseconds.
+var (
+	// KEYS[1] = key; ARGV = interval, tolerance, n
+	// Returns {allowed, tat, now}
+	gcraScript = newRedisScript(`
+if redis.replicate_commands then redis.replicate_commands() end
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local interval = tonumber(ARGV[1])
+local tolerance = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local tat = tonumber(redis.call('GET', KEYS[1])) or now
+if tat < now then tat = now end
+local new_tat = tat + n * interval
+if n == 0 or new_tat - tolerance > now then
+  return {0, tat, now}
+end
+redis.call('SET', KEYS[1], new_tat, 'PX', math.ceil((new_tat - now) / 1000))
+return {1, new_tat, now}
+`)
+
+	// KEYS[1] = key; ARGV = window, rate, n
+	// Returns {allowed, start, prev, curr, now}
+	slidingWindowScript = newRedisScript(`
+if redis.replicate_commands then redis.replicate_commands() end
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local window = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local start = now - (now % window)
+local state = redis.call('HMGET', KEYS[1], 'start', 'prev', 'curr')
+local prev, curr = 0, 0
+local last = tonumber(state[1])
+if last == start then
+  prev, curr = tonumber(state[2]) or 0, tonumber(state[3]) or 0
+elseif last == start - window then
+  prev = tonumber(state[3]) or 0
+end
+local estimate = prev * (1 - (now - start) / window) + curr
+if n == 0 or n > rate or estimate + n > rate then
+  return {0, start, prev, curr, now}
+end
+curr = curr + n
+redis.call('HSET', KEYS[1], 'start', start, 'prev', prev, 'curr', curr)
+redis.call('PEXPIRE', KEYS[1], math.ceil(2 * window / 1000))
+return {1, start, prev, curr, now}
+`)
+)
+
+// redisScript is a Lua script run by its SHA1 digest once the store has it
+type redisScript struct {
+	source string
+	sha    string
+}
+
+func newRedisScript(source string) *redisScript {
+	sum := sha1.Sum([]byte(source))
+	return &redisScript{source: source, sha: hex.EncodeToString(sum[:])}
+}
+
+// run runs the script with EVALSHA, falling back to EVAL (which caches the
+// script) when the store doesn't know it yet
+func (s *redisScript) run(c *redisClient, key string, args ...string) ([]int64, error) {
+	cmd := append([]string{"EVALSHA", s.sha, "1", key}, args...)
+	reply, err := c.do(cmd...)
+	if err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT") {
+		cmd[0], cmd[1] = "EVAL", s.source
+		reply, err = c.do(cmd...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	items, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected script reply %v", reply)
+	}
+	values := make([]int64, len(items))
+	for i, item := range items {
+		if values[i], ok = item.(int64); !ok {
+			return nil, fmt.Errorf("unexpected script reply %v", reply)
+		}
+	}
+	return values, nil
+}
+
+// redisLimiter keeps rate limit state in a shared store. While the store
+// is unreachable, each replica limits on its own with a local limiter.
+type redisLimiter struct {
+	client    *redisClient
+	prefix    string
+	algorithm string
+	gcra      *gcra          // Decision math for AlgorithmGCRA
+	sliding   *slidingWindow // Decision math for AlgorithmSlidingWindow
+	fallback  Limiter
+	now       func() time.Time
+
+	mu      sync.Mutex
+	downAt  time.Time // When the store failed; zero while it is available
+	retryAt time.Time // When to try the store again
+}
+
+// NewRedisLimiter creates a limiter sharing its state through a Redis
+// store. Only AlgorithmGCRA and AlgorithmSlidingWindow are supported, as
+// their state fits a single key that scripts can update atomically.
+func NewRedisLimiter(algorithm string, rate, burst int, window time.Duration, cfg RedisConfig) (Limiter, error) {
+	return newRedisLimiter(algorithm, rate, burst, window, cfg, time.Now)
+}
+
+// newRedisLimiter is NewRedisLimiter with a clock, for tests
+func newRedisLimiter(algorithm string, rate, burst int, window time.Duration, cfg RedisConfig, now func() time.Time) (*redisLimiter, error) {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultRedisTimeout
+	}
+	client, err := newRedisClient(cfg.URL, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return newRedisLimiterWithClient(client, cfg.Prefix, algorithm, rate, burst, window, now)
+}
+
+// withLimits returns a limiter with new limits that shares rl's client, and
+// so its pooled connections, instead of opening another pool
+func (rl *redisLimiter) withLimits(algorithm string, rate, burst int, window time.Duration) (*redisLimiter, error) {
+	return newRedisLimiterWithClient(rl.client, rl.prefix, algorithm, rate, burst, window, rl.now)
+}
+
+// newRedisLimiterWithClient creates a limiter using an existing client
+func newRedisLimiterWithClient(client *redisClient, prefix, algorithm string, rate, burst int, window time.Duration, now func() time.Time) (*redisLimiter, error) {
+	if algorithm != AlgorithmGCRA && algorithm != AlgorithmSlidingWindow {
+		return nil, fmt.Errorf("the redis backend supports the %s and %s algorithms, not %q",
+			AlgorithmGCRA, AlgorithmSlidingWindow, algorithm)
+	}
+	fallback, err := newLimiter(algorithm, rate, burst, window, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &redisLimiter{
+		client:    client,
+		prefix:    prefix,
+		algorithm: algorithm,
+		gcra:      newGCRA(rate, burst, window, now),
+		sliding:   newSlidingWindow(rate, window, now),
+		fallback:  fallback,
+		now:       now,
+	}, nil
+}
+
+// Take consumes n units for key in the shared store, or locally while the
+// store is unreachable
+func (rl *redisLimiter) Take(key string, n int) Decision {
+	if !rl.storeUsable() {
+		return rl.fallback.Take(key, n)
+	}
+	d, err := rl.run(key, n)
+	if err != nil {
+		rl.storeFailed(err)
+		return rl.fallback.Take(key, n)
+	}
+	rl.storeRecovered()
+	return d
+}
+
+// Peek reports key's current budget without consuming any of it
+func (rl *redisLimiter) Peek(key string) Decision {
+	if !rl.storeUsable() {
+		return rl.fallback.Peek(key)
+	}
+	d, err := rl.run(key, 0)
+	if err != nil {
+		rl.storeFailed(err)
+		return rl.fallback.Peek(key)
+	}
+	rl.storeRecovered()
+	d.Allowed = d.Remaining > 0
+	return d
+}
+
+// Limit returns the number of units allowed per window
+func (rl *redisLimiter) Limit() int {
+	return rl.fallback.Limit()
+}
+
+// Window returns the rate limit window
+func (rl *redisLimiter) Window() time.Duration {
+	return rl.fallback.Window()
+}
+
+// Len returns the number of keys limited locally during store outages;
+// keys in the shared store expire on their own
+func (rl *redisLimiter) Len() int {
+	return rl.fallback.Len()
+}
+
+// Cleanup cleans up the local fallback
+func (rl *redisLimiter) Cleanup() {
+	rl.fallback.Cleanup()
+}
+
+// Available reports whether the shared store is in use
+func (rl *redisLimiter) Available() bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.downAt.IsZero()
+}
+
+// run takes n units (0 to peek) with the algorithm's script and derives
+// the decision from the returned state
+func (rl *redisLimiter) run(key string, n int) (Decision, error) {
+	key = rl.prefix + key
+
+	switch rl.algorithm {
+	case AlgorithmGCRA:
+		g := rl.gcra
+		v, err := gcraScript.run(rl.client, key, micros(g.interval), micros(g.tolerance()), strconv.Itoa(n))
+		if err != nil {
+			return Decision{}, err
+		}
+		if len(v) != 3 {
+			return Decision{}, fmt.Errorf("unexpected GCRA script reply %v", v)
+		}
+		tat, now := fromMicros(v[1]), fromMicros(v[2])
+		d := g.decision(tat, now)
+		d.Allowed = v[0] == 1
+		if !d.Allowed && n > 0 {
+			if n > g.burst {
+				return rejected(d), nil
+			}
+			d.RetryAfter = tat.Add(time.Duration(n)*g.interval - g.tolerance()).Sub(now)
+		}
+		return d, nil
+
+	default:
+		sw := rl.sliding
+		v, err := slidingWindowScript.run(rl.client, key, micros(sw.window), strconv.Itoa(sw.rate), strconv.Itoa(n))
+		if err != nil {
+			return Decision{}, err
+		}
+		if len(v) != 5 {
+			return Decision{}, fmt.Errorf("unexpected sliding window script reply %v", v)
+		}
+		c := &windowCounter{start: fromMicros(v[1]), prev: int(v[2]), curr: int(v[3])}
+		now := fromMicros(v[4])
+		d := sw.decision(c, now)
+		d.Allowed = v[0] == 1
+		if !d.Allowed && n > 0 {
+			if n > sw.rate {
+				return rejected(d), nil
+			}
+			d.RetryAfter = sw.retryAfter(c, n, now)
+		}
+		return d, nil
+	}
+}
+
+// storeUsable reports whether the store should be tried
+func (rl *redisLimiter) storeUsable() bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.downAt.IsZero() || !rl.now().Before(rl.retryAt)
+}
+
+// storeFailed switches to local limiting for redisRetryInterval
+func (rl *redisLimiter) storeFailed(err error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	if rl.downAt.IsZero() {
+		rl.downAt = now
+		var replyErr redisError
+		if errors.As(err, &replyErr) {
+			slog.Error("Rate limit store rejected a script, limiting locally", "error", err)
+		} else {
+			slog.Error("Rate limit store unreachable, limiting locally", "error", err)
+		}
+	}
+	rl.retryAt = now.Add(redisRetryInterval)
+}
+
+// storeRecovered switches back to the shared store after an outage
+func (rl *redisLimiter) storeRecovered() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if !rl.downAt.IsZero() {
+		slog.Info("Rate limit store reachable again", "outage", rl.now().Sub(rl.downAt).Round(time.Second))
+		rl.downAt = time.Time{}
+	}
+}
+
+// micros formats a duration in microseconds, the scripts' time unit
+func micros(d time.Duration) string {
+	return strconv.FormatInt(d.Microseconds(), 10)
+}
+
+// fromMicros converts microseconds since the Unix epoch to a time
+func fromMicros(us int64) time.Time {
+	return time.UnixMicro(us)
+}
@@ -0,0 +1,374 @@
+package ratelimit
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is a stand-in for a Redis server that speaks enough RESP to run
+// the limiter scripts. Scripts are emulated in Go, keyed by their digest.
+type fakeRedis struct {
+	t        *testing.T
+	listener net.Listener
+	clock    *fakeClock
+	password string
+
+	mu      sync.Mutex
+	scripts map[string]bool // Digests loaded with EVAL
+	strings map[string]int64
+	hashes  map[string]map[string]int64
+	evals   int  // EVAL calls, i.e. script loads
+	down    bool // Drop connections, like an unreachable store
+	conns   []net.Conn
+}
+
+func newFakeRedis(t *testing.T, clock *fakeClock, password string) *fakeRedis {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	f := &fakeRedis{
+		t:        t,
+		listener: listener,
+		clock:    clock,
+		password: password,
+		scripts:  make(map[string]bool),
+		strings:  make(map[string]int64),
+		hashes:   make(map[string]map[string]int64),
+	}
+	go f.serve()
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeRedis) Addr() string {
+	return f.listener.Addr().String()
+}
+
+func (f *fakeRedis) Close() {
+	f.listener.Close()
+}
+
+// SetDown makes the server drop all connections until it is brought back
+func (f *fakeRedis) SetDown(down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down = down
+	if down {
+		for _, conn := range f.conns {
+			conn.Close()
+		}
+		f.conns = nil
+	}
+}
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		if f.down {
+			conn.Close()
+		} else {
+			f.conns = append(f.conns, conn)
+			go f.handle(conn)
+		}
+		f.mu.Unlock()
+	}
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authenticated := f.password == ""
+
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+		items, _ := reply.([]interface{})
+		args := make([]string, len(items))
+		for i, item := range items {
+			args[i], _ = item.(string)
+		}
+		if len(args) == 0 {
+			return
+		}
+
+		var out string
+		switch cmd := strings.ToUpper(args[0]); {
+		case cmd == "AUTH":
+			authenticated = len(args) == 2 && args[1] == f.password
+			out = "+OK\r\n"
+			if !authenticated {
+				out = "-WRONGPASS invalid password\r\n"
+			}
+		case !authenticated:
+			out = "-NOAUTH Authentication required.\r\n"
+		case cmd == "SELECT" || cmd == "PING":
+			out = "+OK\r\n"
+		case cmd == "EVAL" || cmd == "EVALSHA":
+			out = f.eval(cmd, args)
+		default:
+			out = fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+		}
+		if _, err := conn.Write([]byte(out)); err != nil {
+			return
+		}
+	}
+}
+
+// eval runs an emulated script and encodes its reply
+func (f *fakeRedis) eval(cmd string, args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	sha := args[1]
+	if cmd == "EVAL" {
+		sha = newRedisScript(args[1]).sha
+		f.scripts[sha] = true
+		f.evals++
+	} else if !f.scripts[sha] {
+		return "-NOSCRIPT No matching script. Please use EVAL.\r\n"
+	}
+
+	key := args[3]
+	argv := make([]int64, len(args)-4)
+	for i, arg := range args[4:] {
+		argv[i], _ = strconv.ParseInt(arg, 10, 64)
+	}
+	now := f.clock.Now().UnixMicro()
+
+	var values []int64
+	switch sha {
+	case gcraScript.sha:
+		values = f.gcra(key, now, argv[0], argv[1], argv[2])
+	case slidingWindowScript.sha:
+		values = f.slidingWindow(key, now, argv[0], argv[1], argv[2])
+	default:
+		return "-ERR unknown script\r\n"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(values))
+	for _, v := range values {
+		fmt.Fprintf(&b, ":%d\r\n", v)
+	}
+	return b.String()
+}
+
+// gcra emulates gcraScript
+func (f *fakeRedis) gcra(key string, now, interval, tolerance, n int64) []int64 {
+	tat, ok := f.strings[key]
+	if !ok || tat < now {
+		tat = now
+	}
+	newTAT := tat + n*interval
+	if n == 0 || newTAT-tolerance > now {
+		return []int64{0, tat, now}
+	}
+	f.strings[key] = newTAT
+	return []int64{1, newTAT, now}
+}
+
+// slidingWindow emulates slidingWindowScript
+func (f *fakeRedis) slidingWindow(key string, now, window, rate, n int64) []int64 {
+	start := now - now%window
+	state := f.hashes[key]
+	var prev, curr int64
+	switch {
+	case state == nil:
+	case state["start"] == start:
+		prev, curr = state["prev"], state["curr"]
+	case state["start"] == start-window:
+		prev = state["curr"]
+	}
+
+	estimate := float64(prev)*(1-float64(now-start)/float64(window)) + float64(curr)
+	if n == 0 || n > rate || estimate+float64(n) > float64(rate) {
+		return []int64{0, start, prev, curr, now}
+	}
+	curr += n
+	f.hashes[key] = map[string]int64{"start": start, "prev": prev, "curr": curr}
+	return []int64{1, start, prev, curr, now}
+}
+
+func newTestRedisLimiter(t *testing.T, server *fakeRedis, algorithm string, rate, burst int) *redisLimiter {
+	t.Helper()
+	url := "redis://" + server.Addr()
+	if server.password != "" {
+		url = "redis://:" + server.password + "@" + server.Addr() + "/2"
+	}
+	rl, err := newRedisLimiter(algorithm, rate, burst, time.Minute, RedisConfig{URL: url, Prefix: "test:"}, server.clock.Now)
+	if err != nil {
+		t.Fatalf("newRedisLimiter failed: %v", err)
+	}
+	return rl
+}
+
+func TestRedisLimiterSharesStateAcrossReplicas(t *testing.T) {
+	clock := newFakeClock()
+	server := newFakeRedis(t, clock, "")
+
+	// Two replicas with their own limiter instances
+	a := newTestRedisLimiter(t, server, AlgorithmGCRA, 10, 3)
+	b := newTestRedisLimiter(t, server, AlgorithmGCRA, 10, 3)
+
+	expectTake(t, a, "client", 2, true)
+	d := expectTake(t, b, "client", 1, true)
+	if d.Remaining != 0 || d.Reset != 18*time.Second {
+		t.Errorf("expected the replicas to share one burst, got %+v", d)
+	}
+	d = expectTake(t, a, "client", 1, false)
+	if d.RetryAfter != 6*time.Second {
+		t.Errorf("expected retry after 6s, got %v", d.RetryAfter)
+	}
+	if d := b.Peek("client"); d.Allowed || d.Remaining != 0 {
+		t.Errorf("expected Peek to see the shared state, got %+v", d)
+	}
+
+	clock.Advance(6 * time.Second)
+	expectTake(t, b, "client", 1, true)
+	expectTake(t, a, "other", 3, true)
+	expectTake(t, a, "other", 4, false)
+
+	// The script is loaded once, then run by digest
+	server.mu.Lock()
+	evals := server.evals
+	server.mu.Unlock()
+	if evals != 1 {
+		t.Errorf("expected the script to be loaded once, got %d EVALs", evals)
+	}
+	if a.Len() != 0 {
+		t.Errorf("expected no locally tracked keys while the store is up, got %d", a.Len())
+	}
+}
+
+func TestRedisLimiterSlidingWindow(t *testing.T) {
+	clock := newFakeClock()
+	server := newFakeRedis(t, clock, "secret")
+
+	a := newTestRedisLimiter(t, server, AlgorithmSlidingWindow, 10, 0)
+	b := newTestRedisLimiter(t, server, AlgorithmSlidingWindow, 10, 0)
+
+	expectTake(t, a, "client", 6, true)
+	expectTake(t, b, "client", 4, true)
+	d := expectTake(t, a, "client", 1, false)
+	if d.RetryAfter != time.Minute+6*time.Second {
+		t.Errorf("expected retry after 66s, got %v", d.RetryAfter)
+	}
+
+	clock.Advance(time.Minute + 15*time.Second)
+	if d := b.Peek("client"); d.Remaining != 2 {
+		t.Errorf("expected the previous window to weigh 75%%, got %+v", d)
+	}
+	expectTake(t, a, "client", 2, true)
+	if !a.Available() {
+		t.Error("expected the store to be available")
+	}
+}
+
+func TestRedisLimiterFallsBackToLocalLimiting(t *testing.T) {
+	clock := newFakeClock()
+	server := newFakeRedis(t, clock, "")
+	rl := newTestRedisLimiter(t, server, AlgorithmGCRA, 10, 2)
+
+	expectTake(t, rl, "client", 2, true)
+	server.SetDown(true)
+
+	// The shared state is gone, so the local limiter starts from scratch
+	expectTake(t, rl, "client", 2, true)
+	expectTake(t, rl, "client", 1, false)
+	if rl.Available() {
+		t.Error("expected the store to be reported unavailable")
+	}
+	if rl.Len() != 1 {
+		t.Errorf("expected the key to be tracked locally, got %d keys", rl.Len())
+	}
+
+	// The store is retried after redisRetryInterval; while it is still down
+	// the local limiter keeps its state, refilling one unit after 6s
+	clock.Advance(redisRetryInterval)
+	expectTake(t, rl, "client", 1, false)
+	clock.Advance(time.Second)
+	expectTake(t, rl, "client", 1, true)
+
+	// Once the store is back, the shared state applies again
+	server.SetDown(false)
+	clock.Advance(redisRetryInterval)
+	expectTake(t, rl, "client", 1, true)
+	if !rl.Available() {
+		t.Error("expected the store to be available again")
+	}
+}
+
+func TestRedisRateLimiterReconfigureKeepsClient(t *testing.T) {
+	server := newFakeRedis(t, newFakeClock(), "")
+	rl, err := NewRedisRateLimiter(AlgorithmGCRA, 10, 3, time.Minute, RedisConfig{URL: server.Addr()})
+	if err != nil {
+		t.Fatalf("NewRedisRateLimiter failed: %v", err)
+	}
+	client := rl.current().(*redisLimiter).client
+
+	if err := rl.Reconfigure(AlgorithmSlidingWindow, 20, 20, time.Minute); err != nil {
+		t.Fatalf("Reconfigure failed: %v", err)
+	}
+	reconfigured, ok := rl.current().(*redisLimiter)
+	if !ok || reconfigured.client != client {
+		t.Error("expected the reconfigured limiter to reuse the store's client")
+	}
+	if rl.Algorithm() != AlgorithmSlidingWindow || rl.Limit() != 20 {
+		t.Errorf("unexpected limiter after Reconfigure: %s, %d", rl.Algorithm(), rl.Limit())
+	}
+	if err := rl.Reconfigure(AlgorithmFixedWindow, 20, 20, time.Minute); err == nil {
+		t.Error("expected an error for an algorithm the store doesn't support")
+	}
+}
+
+func TestRedisLimiterValidation(t *testing.T) {
+	if _, err := NewRedisLimiter(AlgorithmFixedWindow, 10, 5, time.Minute, RedisConfig{URL: "localhost:6379"}); err == nil {
+		t.Error("expected error for an algorithm without a script")
+	}
+	for _, url := range []string{"http://localhost", "redis://localhost/db", "redis://"} {
+		if _, err := NewRedisLimiter(AlgorithmGCRA, 10, 5, time.Minute, RedisConfig{URL: url}); err == nil {
+			t.Errorf("expected error for URL %q", url)
+		}
+	}
+
+	client, err := newRedisClient("redis://:pw@cache:6380/3", time.Second)
+	if err != nil {
+		t.Fatalf("newRedisClient failed: %v", err)
+	}
+	if client.addr != "cache:6380" || client.password != "pw" || client.db != 3 {
+		t.Errorf("unexpected client %+v", client)
+	}
+	if client, _ := newRedisClient("cache", time.Second); client.addr != "cache:6379" {
+		t.Errorf("expected the default port, got %s", client.addr)
+	}
+}
+
+func TestReadReply(t *testing.T) {
+	input := "*4\r\n:42\r\n$5\r\nhello\r\n$-1\r\n-ERR inner\r\n"
+	reply, err := readReply(bufio.NewReader(strings.NewReader(input)))
+	if err != nil {
+		t.Fatalf("readReply failed: %v", err)
+	}
+	items := reply.([]interface{})
+	if items[0] != int64(42) || items[1] != "hello" || items[2] != nil || items[3] != redisError("ERR inner") {
+		t.Errorf("unexpected reply %#v", items)
+	}
+
+	if _, err := readReply(bufio.NewReader(strings.NewReader("-NOSCRIPT missing\r\n"))); err == nil || !strings.HasPrefix(err.Error(), "NOSCRIPT") {
+		t.Errorf("expected NOSCRIPT error, got %v", err)
+	}
+}
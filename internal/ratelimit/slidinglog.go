@@ -0,0 +1,145 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// slidingLog records when each key consumed units and allows at most rate
+// units within any trailing window. It is exact, but keeps an entry per
+// admitted request.
+type slidingLog struct {
+	mu     sync.Mutex
+	logs   map[string][]logEntry // Oldest first
+	rate   int
+	window time.Duration
+	now    func() time.Time
+}
+
+// logEntry records n units consumed at once
+type logEntry struct {
+	at time.Time
+	n  int
+}
+
+func newSlidingLog(rate int, window time.Duration, now func() time.Time) *slidingLog {
+	return &slidingLog{
+		logs:   make(map[string][]logEntry),
+		rate:   rate,
+		window: window,
+		now:    now,
+	}
+}
+
+// Take consumes n units for key if they fit into the trailing window
+func (sl *slidingLog) Take(key string, n int) Decision {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	now := sl.now()
+	entries := sl.prune(key, now)
+	if n > sl.rate {
+		return rejected(sl.decision(entries, now))
+	}
+
+	used := countEntries(entries)
+	if used+n > sl.rate {
+		d := sl.decision(entries, now)
+
+		// Wait until enough of the oldest entries have left the window
+		excess := used + n - sl.rate
+		for _, e := range entries {
+			excess -= e.n
+			if excess <= 0 {
+				d.RetryAfter = e.at.Add(sl.window).Sub(now)
+				break
+			}
+		}
+		return d
+	}
+
+	entries = append(entries, logEntry{at: now, n: n})
+	sl.logs[key] = entries
+	d := sl.decision(entries, now)
+	d.Allowed = true
+	return d
+}
+
+// Peek reports key's current budget without consuming any of it
+func (sl *slidingLog) Peek(key string) Decision {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	now := sl.now()
+	d := sl.decision(sl.prune(key, now), now)
+	d.Allowed = d.Remaining > 0
+	return d
+}
+
+// Limit returns the number of units allowed per window
+func (sl *slidingLog) Limit() int {
+	return sl.rate
+}
+
+// Window returns the trailing window
+func (sl *slidingLog) Window() time.Duration {
+	return sl.window
+}
+
+// Len returns the number of tracked keys
+func (sl *slidingLog) Len() int {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	return len(sl.logs)
+}
+
+// Cleanup forgets keys without entries in the trailing window
+func (sl *slidingLog) Cleanup() {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	now := sl.now()
+	for key := range sl.logs {
+		sl.prune(key, now)
+	}
+}
+
+// prune drops key's entries that have left the window and returns the
+// rest. Callers must hold sl.mu.
+func (sl *slidingLog) prune(key string, now time.Time) []logEntry {
+	entries := sl.logs[key]
+	i := 0
+	for i < len(entries) && now.Sub(entries[i].at) >= sl.window {
+		i++
+	}
+	if i == len(entries) {
+		delete(sl.logs, key)
+		return nil
+	}
+	if i > 0 {
+		entries = append([]logEntry(nil), entries[i:]...)
+		sl.logs[key] = entries
+	}
+	return entries
+}
+
+// decision reports the budget left by a pruned log
+func (sl *slidingLog) decision(entries []logEntry, now time.Time) Decision {
+	d := Decision{
+		Limit:     sl.rate,
+		Remaining: max(sl.rate-countEntries(entries), 0),
+	}
+	if len(entries) > 0 {
+		d.Reset = entries[len(entries)-1].at.Add(sl.window).Sub(now)
+	}
+	return d
+}
+
+// countEntries returns the units recorded in entries
+func countEntries(entries []logEntry) int {
+	count := 0
+	for _, e := range entries {
+		count += e.n
+	}
+	return count
+}
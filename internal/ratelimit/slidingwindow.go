@@ -0,0 +1,161 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// slidingWindow approximates a sliding log with two counters per key: the
+// previous window's count is weighted by how much of it still overlaps the
+// trailing window
+type slidingWindow struct {
+	mu       sync.Mutex
+	counters map[string]*windowCounter
+	rate     int
+	window   time.Duration
+	now      func() time.Time
+}
+
+// windowCounter counts the units of the current and the previous window
+type windowCounter struct {
+	start time.Time // Start of the current window
+	prev  int
+	curr  int
+}
+
+func newSlidingWindow(rate int, window time.Duration, now func() time.Time) *slidingWindow {
+	return &slidingWindow{
+		counters: make(map[string]*windowCounter),
+		rate:     rate,
+		window:   window,
+		now:      now,
+	}
+}
+
+// Take consumes n units for key if the weighted count leaves room for them
+func (sw *slidingWindow) Take(key string, n int) Decision {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	now := sw.now()
+	c := sw.counter(key, now)
+	if n > sw.rate {
+		return rejected(sw.decision(c, now))
+	}
+
+	if sw.estimate(c, now)+float64(n) > float64(sw.rate) {
+		d := sw.decision(c, now)
+		d.RetryAfter = sw.retryAfter(c, n, now)
+		return d
+	}
+
+	c.curr += n
+	sw.counters[key] = c
+	d := sw.decision(c, now)
+	d.Allowed = true
+	return d
+}
+
+// Peek reports key's current budget without consuming any of it
+func (sw *slidingWindow) Peek(key string) Decision {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	now := sw.now()
+	d := sw.decision(sw.counter(key, now), now)
+	d.Allowed = d.Remaining > 0
+	return d
+}
+
+// Limit returns the number of units allowed per window
+func (sw *slidingWindow) Limit() int {
+	return sw.rate
+}
+
+// Window returns the window length
+func (sw *slidingWindow) Window() time.Duration {
+	return sw.window
+}
+
+// Len returns the number of tracked keys
+func (sw *slidingWindow) Len() int {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return len(sw.counters)
+}
+
+// Cleanup forgets keys without units in the current or previous window
+func (sw *slidingWindow) Cleanup() {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	now := sw.now()
+	for key := range sw.counters {
+		if c := sw.counter(key, now); c.prev == 0 && c.curr == 0 {
+			delete(sw.counters, key)
+		}
+	}
+}
+
+// counter returns a copy of key's counter advanced to the window containing
+// now; callers store it back when they count units. Callers must hold sw.mu.
+func (sw *slidingWindow) counter(key string, now time.Time) *windowCounter {
+	start := now.Truncate(sw.window)
+	c, ok := sw.counters[key]
+	if !ok {
+		return &windowCounter{start: start}
+	}
+
+	advanced := *c
+	switch {
+	case !start.After(c.start):
+		// Still in the same window
+	case start.Sub(c.start) == sw.window:
+		advanced = windowCounter{start: start, prev: c.curr}
+	default:
+		advanced = windowCounter{start: start}
+	}
+	return &advanced
+}
+
+// estimate returns the units counted in the trailing window
+func (sw *slidingWindow) estimate(c *windowCounter, now time.Time) float64 {
+	return float64(c.prev)*sw.weight(c, now) + float64(c.curr)
+}
+
+// weight returns the share of the previous window still inside the
+// trailing window
+func (sw *slidingWindow) weight(c *windowCounter, now time.Time) float64 {
+	return 1 - float64(now.Sub(c.start))/float64(sw.window)
+}
+
+// retryAfter returns how long until n more units fit
+func (sw *slidingWindow) retryAfter(c *windowCounter, n int, now time.Time) time.Duration {
+	// The previous window's weight decays until the rest fits
+	if c.curr+n <= sw.rate && c.prev > 0 {
+		weight := float64(sw.rate-c.curr-n) / float64(c.prev)
+		at := c.start.Add(time.Duration(math.Ceil((1 - weight) * float64(sw.window))))
+		return at.Sub(now)
+	}
+
+	// Otherwise the current window has to end and decay in turn
+	next := c.start.Add(sw.window)
+	weight := float64(sw.rate-n) / float64(c.curr)
+	return next.Add(time.Duration(math.Ceil((1 - weight) * float64(sw.window)))).Sub(now)
+}
+
+// decision reports the budget of an advanced counter
+func (sw *slidingWindow) decision(c *windowCounter, now time.Time) Decision {
+	d := Decision{
+		Limit:     sw.rate,
+		Remaining: max(sw.rate-int(math.Ceil(sw.estimate(c, now))), 0),
+	}
+	switch {
+	case c.curr > 0:
+		d.Reset = c.start.Add(2 * sw.window).Sub(now)
+	case c.prev > 0:
+		d.Reset = c.start.Add(sw.window).Sub(now)
+	}
+	return d
+}
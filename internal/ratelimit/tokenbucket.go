@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// tokenBucket holds up to burst tokens per key and refills them
+// continuously at rate tokens per window
+type tokenBucket struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	rate    int
+	burst   int
+	window  time.Duration
+	now     func() time.Time
+}
+
+// bucket is the state of a single key
+type bucket struct {
+	tokens float64
+	last   time.Time // When tokens was last brought up to date
+}
+
+func newTokenBucket(rate, burst int, window time.Duration, now func() time.Time) *tokenBucket {
+	return &tokenBucket{
+		buckets: make(map[string]*bucket),
+		rate:    rate,
+		burst:   burst,
+		window:  window,
+		now:     now,
+	}
+}
+
+// Take consumes n tokens for key if all of them are available
+func (tb *tokenBucket) Take(key string, n int) Decision {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := tb.now()
+	b := tb.bucket(key, now)
+	if n > tb.burst {
+		return rejected(tb.decision(b))
+	}
+	if b.tokens < float64(n) {
+		d := tb.decision(b)
+		d.RetryAfter = tb.duration(float64(n) - b.tokens)
+		return d
+	}
+
+	b.tokens -= float64(n)
+	tb.buckets[key] = b
+	d := tb.decision(b)
+	d.Allowed = true
+	return d
+}
+
+// Peek reports key's current budget without consuming any of it
+func (tb *tokenBucket) Peek(key string) Decision {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	d := tb.decision(tb.bucket(key, tb.now()))
+	d.Allowed = d.Remaining > 0
+	return d
+}
+
+// Limit returns the number of tokens refilled per window
+func (tb *tokenBucket) Limit() int {
+	return tb.rate
+}
+
+// Window returns the refill window
+func (tb *tokenBucket) Window() time.Duration {
+	return tb.window
+}
+
+// Len returns the number of tracked keys
+func (tb *tokenBucket) Len() int {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return len(tb.buckets)
+}
+
+// Cleanup forgets keys whose bucket is full again
+func (tb *tokenBucket) Cleanup() {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := tb.now()
+	for key := range tb.buckets {
+		if tb.bucket(key, now).tokens >= float64(tb.burst) {
+			delete(tb.buckets, key)
+		}
+	}
+}
+
+// bucket returns a copy of key's bucket refilled up to now; callers store
+// it back when they consume tokens. Callers must hold tb.mu.
+func (tb *tokenBucket) bucket(key string, now time.Time) *bucket {
+	b, ok := tb.buckets[key]
+	if !ok {
+		return &bucket{tokens: float64(tb.burst), last: now}
+	}
+
+	refilled := float64(now.Sub(b.last)) * float64(tb.rate) / float64(tb.window)
+	return &bucket{
+		tokens: math.Min(b.tokens+math.Max(refilled, 0), float64(tb.burst)),
+		last:   now,
+	}
+}
+
+// decision reports the budget of a refilled bucket
+func (tb *tokenBucket) decision(b *bucket) Decision {
+	return Decision{
+		Limit:     tb.rate,
+		Remaining: min(int(b.tokens), tb.rate),
+		Reset:     tb.duration(float64(tb.burst) - b.tokens),
+	}
+}
+
+// duration returns how long refilling tokens takes
+func (tb *tokenBucket) duration(tokens float64) time.Duration {
+	return time.Duration(math.Ceil(tokens * float64(tb.window) / float64(tb.rate)))
+}
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"container/list"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache modes accepted in FetchOptions.Cache
+const (
+	CacheDefault = ""       // Serve fresh entries, revalidate stale ones
+	CacheBypass  = "bypass" // Always fetch from the origin, still store the response
+	CachePrefer  = "prefer" // Serve any cached entry, even stale, without contacting the origin
+	CacheOnly    = "only"   // Never contact the origin; fail if nothing is cached
+)
+
+// ValidCacheMode reports whether mode is a supported cache mode
+func ValidCacheMode(mode string) bool {
+	switch mode {
+	case CacheDefault, CacheBypass, CachePrefer, CacheOnly:
+		return true
+	}
+	return false
+}
+
+// cacheEntry is a stored response and the data needed to revalidate it
+type cacheEntry struct {
+	key          string
+	varyHeaders  []string    // Header names listed in the response's Vary
+	varyValues   http.Header // Request values of those headers when stored
+	statusCode   int
+	contentType  string
+	body         []byte
+	finalURL     string
+	redirects    int
+	etag         string
+	lastModified string
+	storedAt     time.Time
+	expiresAt    time.Time // Zero means the entry must always be revalidated
+}
+
+// fresh reports whether the entry can be served without revalidation
+func (e *cacheEntry) fresh(now time.Time) bool {
+	return !e.expiresAt.IsZero() && now.Before(e.expiresAt)
+}
+
+// matches reports whether the entry was stored for an equivalent request
+func (e *cacheEntry) matches(req *http.Request) bool {
+	for _, name := range e.varyHeaders {
+		if req.Header.Get(name) != e.varyValues.Get(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// responseCache is a shared, size-bounded LRU cache of HTTP responses keyed
+// by method and URL, with one variant per distinct set of Vary header values
+type responseCache struct {
+	mu         sync.Mutex
+	entries    map[string][]*list.Element // method+URL -> variants
+	lru        *list.List                 // Front is most recently used
+	maxEntries int
+}
+
+// newResponseCache creates a cache holding at most maxEntries responses
+func newResponseCache(maxEntries int) *responseCache {
+	return &responseCache{
+		entries:    make(map[string][]*list.Element),
+		lru:        list.New(),
+		maxEntries: maxEntries,
+	}
+}
+
+// cacheKey returns the primary cache key for a request
+func cacheKey(req *http.Request) string {
+	return req.Method + " " + req.URL.String()
+}
+
+// lookup returns a copy of the stored variant matching req, if any
+func (c *responseCache) lookup(req *http.Request) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem := c.find(req); elem != nil {
+		c.lru.MoveToFront(elem)
+		entry := *elem.Value.(*cacheEntry)
+		return &entry
+	}
+	return nil
+}
+
+// find returns the list element of the variant matching req. Callers must hold c.mu.
+func (c *responseCache) find(req *http.Request) *list.Element {
+	for _, elem := range c.entries[cacheKey(req)] {
+		if elem.Value.(*cacheEntry).matches(req) {
+			return elem
+		}
+	}
+	return nil
+}
+
+// store saves a response if its headers allow caching it in a shared cache
+func (c *responseCache) store(req *http.Request, resp *http.Response, body []byte, redirects int, now time.Time) {
+	if resp.StatusCode != http.StatusOK {
+		return
+	}
+
+	directives := parseCacheControl(resp.Header.Get("Cache-Control"))
+	if _, ok := directives["no-store"]; ok {
+		return
+	}
+	if _, ok := directives["private"]; ok {
+		return
+	}
+	if _, ok := parseCacheControl(req.Header.Get("Cache-Control"))["no-store"]; ok {
+		return
+	}
+
+	vary := varyHeaderNames(resp.Header)
+	for _, name := range vary {
+		if name == "*" {
+			return
+		}
+	}
+
+	entry := &cacheEntry{
+		key:          cacheKey(req),
+		varyHeaders:  vary,
+		varyValues:   make(http.Header),
+		statusCode:   resp.StatusCode,
+		contentType:  resp.Header.Get("Content-Type"),
+		body:         body,
+		finalURL:     resp.Request.URL.String(),
+		redirects:    redirects,
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		storedAt:     now,
+		expiresAt:    freshUntil(resp.Header, directives, now),
+	}
+	for _, name := range vary {
+		entry.varyValues.Set(name, req.Header.Get(name))
+	}
+
+	// Without freshness information or validators the entry is useless
+	if entry.expiresAt.IsZero() && entry.etag == "" && entry.lastModified == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Replace an existing variant for the same request
+	if elem := c.find(req); elem != nil {
+		c.removeElement(elem)
+	}
+	c.entries[entry.key] = append(c.entries[entry.key], c.lru.PushFront(entry))
+
+	for c.lru.Len() > c.maxEntries {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+// revalidated refreshes the entry for req after a 304 Not Modified response
+func (c *responseCache) revalidated(req *http.Request, resp *http.Response, now time.Time) {
+	directives := parseCacheControl(resp.Header.Get("Cache-Control"))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem := c.find(req)
+	if elem == nil {
+		return
+	}
+	entry := elem.Value.(*cacheEntry)
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		entry.etag = etag
+	}
+	if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+		entry.lastModified = lastModified
+	}
+	entry.storedAt = now
+	entry.expiresAt = freshUntil(resp.Header, directives, now)
+}
+
+// removeElement drops a single entry. Callers must hold c.mu.
+func (c *responseCache) removeElement(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cacheEntry)
+	variants := c.entries[entry.key]
+	for i, v := range variants {
+		if v == elem {
+			variants = append(variants[:i], variants[i+1:]...)
+			break
+		}
+	}
+	if len(variants) == 0 {
+		delete(c.entries, entry.key)
+	} else {
+		c.entries[entry.key] = variants
+	}
+}
+
+// len returns the number of stored responses
+func (c *responseCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// freshUntil computes the expiry of a response from s-maxage, max-age or
+// Expires. A zero time means the response must be revalidated before reuse.
+func freshUntil(header http.Header, directives map[string]string, now time.Time) time.Time {
+	if _, ok := directives["no-cache"]; ok {
+		return time.Time{}
+	}
+	for _, name := range []string{"s-maxage", "max-age"} {
+		if value, ok := directives[name]; ok {
+			seconds, err := strconv.Atoi(value)
+			if err != nil || seconds <= 0 {
+				return time.Time{}
+			}
+			return now.Add(time.Duration(seconds) * time.Second)
+		}
+	}
+	if expires := header.Get("Expires"); expires != "" {
+		if t, err := http.ParseTime(expires); err == nil && t.After(now) {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// parseCacheControl splits a Cache-Control header into lower-cased directives
+func parseCacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, arg, _ := strings.Cut(part, "=")
+		directives[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(arg), `"`)
+	}
+	return directives
+}
+
+// varyHeaderNames returns the canonical header names listed in Vary
+func varyHeaderNames(header http.Header) []string {
+	var names []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"fetch/internal/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func createCacheTestService() *FetchService {
+	cfg := testConfig()
+	cfg.CacheEnabled = true
+	cfg.CacheMaxEntries = 10
+	return NewFetchService(cfg, ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+}
+
+func TestCacheRevalidatesWithETag(t *testing.T) {
+	var requests, notModified atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "no-cache")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("cached body"))
+	}))
+	defer server.Close()
+
+	service := createCacheTestService()
+	defer service.Stop()
+
+	first := service.fetch(server.URL, FetchOptions{})
+	if first.FromCache || first.Status != "success" {
+		t.Fatalf("expected fresh fetch, got %+v", first)
+	}
+
+	second := service.fetch(server.URL, FetchOptions{})
+	if !second.FromCache || !second.Revalidated {
+		t.Errorf("expected revalidated cache hit, got from_cache=%t revalidated=%t", second.FromCache, second.Revalidated)
+	}
+	if second.Content != "cached body" {
+		t.Errorf("expected cached content, got %q", second.Content)
+	}
+	if requests.Load() != 2 || notModified.Load() != 1 {
+		t.Errorf("expected 2 requests with 1 conditional hit, got %d and %d", requests.Load(), notModified.Load())
+	}
+}
+
+func TestCacheModes(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("body"))
+	}))
+	defer server.Close()
+
+	service := createCacheTestService()
+	defer service.Stop()
+
+	// Nothing cached yet
+	if result := service.fetch(server.URL, FetchOptions{Cache: CacheOnly}); result.Status != "failed" {
+		t.Errorf("expected cache=only miss to fail, got %s", result.Status)
+	}
+	if requests.Load() != 0 {
+		t.Fatalf("expected cache=only not to contact origin, got %d requests", requests.Load())
+	}
+
+	service.fetch(server.URL, FetchOptions{})
+
+	tests := []struct {
+		mode          string
+		fromCache     bool
+		totalRequests int32
+	}{
+		{CacheDefault, true, 1},
+		{CachePrefer, true, 1},
+		{CacheOnly, true, 1},
+		{CacheBypass, false, 2},
+	}
+
+	for _, tt := range tests {
+		result := service.fetch(server.URL, FetchOptions{Cache: tt.mode})
+		if result.FromCache != tt.fromCache {
+			t.Errorf("cache=%q: expected from_cache=%t, got %t", tt.mode, tt.fromCache, result.FromCache)
+		}
+		if requests.Load() != tt.totalRequests {
+			t.Errorf("cache=%q: expected %d origin requests, got %d", tt.mode, tt.totalRequests, requests.Load())
+		}
+	}
+}
+
+func TestCacheHonorsNoStore(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Cache-Control", "no-store, max-age=60")
+		w.Write([]byte("secret"))
+	}))
+	defer server.Close()
+
+	service := createCacheTestService()
+	defer service.Stop()
+
+	service.fetch(server.URL, FetchOptions{})
+	result := service.fetch(server.URL, FetchOptions{})
+
+	if result.FromCache || requests.Load() != 2 {
+		t.Errorf("expected no-store response not to be cached, got from_cache=%t after %d requests", result.FromCache, requests.Load())
+	}
+	if size := service.GetCacheSize(); size != 0 {
+		t.Errorf("expected empty cache, got %d entries", size)
+	}
+}
+
+func TestCacheVary(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		w.Write([]byte(r.Header.Get("Accept-Language")))
+	}))
+	defer server.Close()
+
+	cache := newResponseCache(10)
+	now := time.Now()
+
+	for _, lang := range []string{"en", "fr"} {
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		req.Header.Set("Accept-Language", lang)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		cache.store(req, resp, []byte(lang), 0, now)
+	}
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("Accept-Language", "fr")
+	entry := cache.lookup(req)
+	if entry == nil || string(entry.body) != "fr" {
+		t.Fatalf("expected the fr variant, got %+v", entry)
+	}
+
+	req.Header.Set("Accept-Language", "de")
+	if entry := cache.lookup(req); entry != nil {
+		t.Errorf("expected no variant for de, got %q", entry.body)
+	}
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fetch/cmd/model"
+	"fetch/internal/logging"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// contentSnapshot is the last normalized content seen for a URL
+type contentSnapshot struct {
+	hash      string
+	lines     []string
+	fetchedAt time.Time
+}
+
+// whitespaceRun matches runs of spaces and tabs collapsed during normalization
+var whitespaceRun = regexp.MustCompile(`[ \t]+`)
+
+// compileIgnorePatterns compiles the configured ignore regexes, skipping invalid ones
+func compileIgnorePatterns(patterns []string) []*regexp.Regexp {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			slog.Warn("Skipping invalid change ignore pattern", "pattern", pattern, "error", err)
+			continue
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled
+}
+
+// normalizeContent strips ignored regions and, if enabled, collapses
+// whitespace and drops blank lines so formatting-only edits are not reported
+func (fs *FetchService) normalizeContent(content string) []string {
+	for _, re := range fs.ignorePatterns {
+		content = re.ReplaceAllString(content, "")
+	}
+
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	if !fs.config.Load().ChangeNormalizeWhitespace {
+		return lines
+	}
+
+	normalized := make([]string, 0, len(lines))
+	for _, line := range lines {
+		line = strings.TrimSpace(whitespaceRun.ReplaceAllString(line, " "))
+		if line != "" {
+			normalized = append(normalized, line)
+		}
+	}
+	return normalized
+}
+
+// detectChange compares a successful result with the previous fetch of the
+// same URL by the same tenant (identified by key) and records the content hash, changed flag
+// and diff summary
+func (fs *FetchService) detectChange(key tenantURL, result *models.FetchResult) {
+	lines := fs.normalizeContent(result.Content)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	hash := hex.EncodeToString(sum[:])
+	result.ContentHash = hash
+
+	fs.changeMu.Lock()
+	previous, seen := fs.snapshots[key]
+	fs.snapshots[key] = contentSnapshot{
+		hash:      hash,
+		lines:     lines,
+		fetchedAt: result.FetchedAt,
+	}
+	fs.changeMu.Unlock()
+
+	// Nothing to compare against on the first fetch
+	if !seen {
+		return
+	}
+
+	changed := previous.hash != hash
+	result.Changed = &changed
+	result.PreviousFetchedAt = previous.fetchedAt
+	if !changed {
+		return
+	}
+
+	unified, added, removed, truncated := unifiedDiff(lineDiff(previous.lines, lines))
+	result.Diff = &models.DiffSummary{
+		LinesAdded:   added,
+		LinesRemoved: removed,
+		Unified:      unified,
+		Truncated:    truncated,
+	}
+	slog.InfoContext(logging.WithRequestID(context.Background(), result.RequestID), "Content changed",
+		"url", result.URL, "lines_added", added, "lines_removed", removed)
+}
+
+// cleanupSnapshots drops change-detection state for URLs not fetched within ResultTTL
+func (fs *FetchService) cleanupSnapshots(now time.Time) {
+	fs.changeMu.Lock()
+	defer fs.changeMu.Unlock()
+
+	for key, snapshot := range fs.snapshots {
+		if now.Sub(snapshot.fetchedAt) >= fs.config.Load().ResultTTL {
+			delete(fs.snapshots, key)
+		}
+	}
+}
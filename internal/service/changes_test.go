@@ -0,0 +1,137 @@
+package service
+
+import (
+	"encoding/json"
+	"fetch/internal/ratelimit"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	a := []string{"one", "two", "three", "four", "five", "six", "seven", "eight", "nine", "ten"}
+	b := []string{"one", "two", "THREE", "four", "five", "six", "seven", "eight", "nine", "ten", "eleven"}
+
+	unified, added, removed, truncated := unifiedDiff(lineDiff(a, b))
+
+	if added != 2 || removed != 1 {
+		t.Errorf("expected +2 -1, got +%d -%d", added, removed)
+	}
+	if truncated {
+		t.Error("expected diff not to be truncated")
+	}
+
+	expected := "@@ -1,6 +1,6 @@\n one\n two\n-three\n+THREE\n four\n five\n six\n" +
+		"@@ -8,3 +8,4 @@\n eight\n nine\n ten\n+eleven\n"
+	if unified != expected {
+		t.Errorf("unexpected unified diff:\n%s\nexpected:\n%s", unified, expected)
+	}
+}
+
+func TestUnifiedDiffIdentical(t *testing.T) {
+	lines := []string{"a", "b", "c"}
+	unified, added, removed, _ := unifiedDiff(lineDiff(lines, lines))
+	if unified != "" || added != 0 || removed != 0 {
+		t.Errorf("expected empty diff, got +%d -%d %q", added, removed, unified)
+	}
+}
+
+func TestLineDiffIsMinimal(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	lines := func(n int) []string {
+		out := make([]string, n)
+		for i := range out {
+			out[i] = string(rune('a' + rng.IntN(4)))
+		}
+		return out
+	}
+
+	for range 200 {
+		a, b := lines(rng.IntN(30)), lines(rng.IntN(30))
+		var gotA, gotB []string
+		common := 0
+		for _, op := range lineDiff(a, b) {
+			if op.kind != '+' {
+				gotA = append(gotA, op.text)
+			}
+			if op.kind != '-' {
+				gotB = append(gotB, op.text)
+			}
+			if op.kind == ' ' {
+				common++
+			}
+		}
+		if !slices.Equal(gotA, a) || !slices.Equal(gotB, b) {
+			t.Fatalf("edit script doesn't turn %q into %q", a, b)
+		}
+		if want := lcsLengths(a, b, false)[len(b)]; common != want {
+			t.Fatalf("expected %d common lines for %q and %q, got %d", want, a, b, common)
+		}
+	}
+}
+
+func TestChangeDetection(t *testing.T) {
+	var version atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The timestamp differs on every request and must be ignored
+		fmt.Fprintf(w, "<p>Generated at %s</p>\n<p>Price:   %d</p>\n", time.Now().Format(time.RFC3339Nano), 10+version.Load())
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.ChangeDetection = true
+	cfg.ChangeIgnorePatterns = []string{`Generated at \S+`}
+	cfg.ChangeNormalizeWhitespace = true
+	service := NewFetchService(cfg, ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	fetchOnce := func() int {
+		service.SubmitURLs([]string{server.URL})
+		time.Sleep(200 * time.Millisecond)
+		results := service.GetResults()
+		return len(results.Results) - 1
+	}
+
+	// First fetch has nothing to compare against
+	i := fetchOnce()
+	result := service.GetResults().Results[i]
+	if result.ContentHash == "" {
+		t.Fatal("expected content hash to be set")
+	}
+	if result.Changed != nil {
+		t.Errorf("expected changed to be unset on first fetch, got %v", *result.Changed)
+	}
+	if encoded, _ := json.Marshal(result); strings.Contains(string(encoded), "previous_fetched_at") {
+		t.Errorf("expected previous_fetched_at to be omitted on first fetch, got %s", encoded)
+	}
+
+	// Only the ignored timestamp differs
+	i = fetchOnce()
+	result = service.GetResults().Results[i]
+	if result.Changed == nil || *result.Changed {
+		t.Fatalf("expected changed=false, got %v", result.Changed)
+	}
+	if result.Diff != nil {
+		t.Error("expected no diff when content is unchanged")
+	}
+
+	// A real change is reported with a diff
+	version.Store(5)
+	i = fetchOnce()
+	result = service.GetResults().Results[i]
+	if result.Changed == nil || !*result.Changed {
+		t.Fatalf("expected changed=true, got %v", result.Changed)
+	}
+	if result.Diff == nil || result.Diff.LinesAdded != 1 || result.Diff.LinesRemoved != 1 {
+		t.Fatalf("expected +1 -1 diff, got %+v", result.Diff)
+	}
+	if !strings.Contains(result.Diff.Unified, "-<p>Price: 10</p>") || !strings.Contains(result.Diff.Unified, "+<p>Price: 15</p>") {
+		t.Errorf("unexpected unified diff: %s", result.Diff.Unified)
+	}
+}
@@ -0,0 +1,404 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fetch/cmd/model"
+	"fetch/internal/logging"
+	"fetch/internal/tracing"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Crawl errors returned to callers
+var (
+	ErrCrawlNotFound = errors.New("crawl not found")
+	ErrInvalidCrawl  = errors.New("invalid crawl")
+)
+
+// Defaults used when the corresponding Config fields are unset
+const (
+	defaultCrawlMaxDepth    = 5
+	defaultCrawlMaxPages    = 1000
+	defaultCrawlConcurrency = 5
+
+	defaultCrawlDepth = 1 // max_depth of a request without one
+)
+
+// Crawl scope modes
+const (
+	CrawlScopeHost   = "host"
+	CrawlScopeDomain = "domain"
+	CrawlScopeRegex  = "regex"
+)
+
+// crawlScope decides which discovered links a crawl follows
+type crawlScope struct {
+	mode    string
+	hosts   map[string]bool // Seed hosts, for "host" scope
+	domains []string        // Seed hosts without "www.", for "domain" scope
+	pattern *regexp.Regexp  // For "regex" scope
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// allows reports whether a link is within the crawl's scope and filters
+func (s *crawlScope) allows(u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	raw := u.String()
+
+	switch s.mode {
+	case CrawlScopeHost:
+		if !s.hosts[host] {
+			return false
+		}
+	case CrawlScopeDomain:
+		inDomain := false
+		for _, domain := range s.domains {
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				inDomain = true
+				break
+			}
+		}
+		if !inDomain {
+			return false
+		}
+	case CrawlScopeRegex:
+		if !s.pattern.MatchString(raw) {
+			return false
+		}
+	}
+
+	return passesFilters(raw, s.include, s.exclude)
+}
+
+// passesFilters reports whether raw matches at least one include pattern
+// (when any are given) and none of the exclude patterns
+func passesFilters(raw string, include, exclude []*regexp.Regexp) bool {
+	if len(include) > 0 {
+		included := false
+		for _, re := range include {
+			if re.MatchString(raw) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	for _, re := range exclude {
+		if re.MatchString(raw) {
+			return false
+		}
+	}
+	return true
+}
+
+// crawlTask is a page waiting to be fetched
+type crawlTask struct {
+	url    string
+	parent string
+	depth  int
+}
+
+// ValidateCrawl checks a crawl request and returns it with defaults applied
+// to unset fields, so MaxPages is the most pages the crawl can fetch
+func (fs *FetchService) ValidateCrawl(req models.CrawlRequest) (models.CrawlRequest, error) {
+	cfg := fs.config.Load()
+	maxDepth := cfg.CrawlMaxDepth
+	if maxDepth <= 0 {
+		maxDepth = defaultCrawlMaxDepth
+	}
+	maxPages := cfg.CrawlMaxPages
+	if maxPages <= 0 {
+		maxPages = defaultCrawlMaxPages
+	}
+
+	if len(req.Seeds) == 0 {
+		return req, fmt.Errorf("%w: no seed URLs provided", ErrInvalidCrawl)
+	}
+	if req.MaxDepth == nil {
+		depth := defaultCrawlDepth
+		req.MaxDepth = &depth
+	}
+	if *req.MaxDepth < 0 || *req.MaxDepth > maxDepth {
+		return req, fmt.Errorf("%w: max_depth must be between 0 and %d", ErrInvalidCrawl, maxDepth)
+	}
+	if req.MaxPages > maxPages {
+		return req, fmt.Errorf("%w: max_pages must not exceed %d", ErrInvalidCrawl, maxPages)
+	}
+	if req.MaxPages <= 0 {
+		req.MaxPages = maxPages
+	}
+	if req.Scope == "" {
+		req.Scope = CrawlScopeHost
+	}
+	if _, err := newCrawlScope(req); err != nil {
+		return req, err
+	}
+	return req, nil
+}
+
+// StartCrawl validates a crawl request and starts crawling in the background.
+// Every fetched page is stored as a result under the returned job ID.
+func (fs *FetchService) StartCrawl(req models.CrawlRequest) (models.CrawlJob, error) {
+	req, err := fs.ValidateCrawl(req)
+	if err != nil {
+		return models.CrawlJob{}, err
+	}
+	scope, err := newCrawlScope(req)
+	if err != nil {
+		return models.CrawlJob{}, err
+	}
+
+	job := &models.CrawlJob{
+		JobID:     newID(),
+		Status:    models.JobRunning,
+		Request:   req,
+		StartedAt: time.Now(),
+	}
+
+	fs.crawlMu.Lock()
+	fs.crawls[job.JobID] = job
+	snapshot := *job
+	fs.crawlMu.Unlock()
+
+	go fs.runCrawl(job, scope)
+
+	slog.InfoContext(logging.WithRequestID(context.Background(), req.RequestID), "Started crawl",
+		"job_id", job.JobID,
+		"seeds", len(req.Seeds),
+		"max_depth", *req.MaxDepth,
+		"max_pages", req.MaxPages,
+		"scope", req.Scope)
+	return snapshot, nil
+}
+
+// GetCrawl returns the progress of a crawl
+func (fs *FetchService) GetCrawl(jobID string) (models.CrawlJob, error) {
+	fs.crawlMu.RLock()
+	defer fs.crawlMu.RUnlock()
+
+	job, ok := fs.crawls[jobID]
+	if !ok {
+		return models.CrawlJob{}, ErrCrawlNotFound
+	}
+	return *job, nil
+}
+
+// newCrawlScope compiles the scope rules and URL filters of a crawl request
+func newCrawlScope(req models.CrawlRequest) (*crawlScope, error) {
+	scope := &crawlScope{
+		mode:  req.Scope,
+		hosts: make(map[string]bool),
+	}
+
+	for _, seed := range req.Seeds {
+		u, err := url.Parse(seed)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%w: invalid seed URL %q", ErrInvalidCrawl, seed)
+		}
+		host := strings.ToLower(u.Hostname())
+		scope.hosts[host] = true
+		scope.domains = append(scope.domains, strings.TrimPrefix(host, "www."))
+	}
+
+	switch req.Scope {
+	case CrawlScopeHost, CrawlScopeDomain:
+	case CrawlScopeRegex:
+		if req.ScopePattern == "" {
+			return nil, fmt.Errorf("%w: scope_pattern is required for regex scope", ErrInvalidCrawl)
+		}
+		pattern, err := regexp.Compile(req.ScopePattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid scope_pattern: %v", ErrInvalidCrawl, err)
+		}
+		scope.pattern = pattern
+	default:
+		return nil, fmt.Errorf("%w: unknown scope %q (expected host, domain or regex)", ErrInvalidCrawl, req.Scope)
+	}
+
+	var err error
+	if scope.include, err = compileFilters(ErrInvalidCrawl, "include", req.Include); err != nil {
+		return nil, err
+	}
+	if scope.exclude, err = compileFilters(ErrInvalidCrawl, "exclude", req.Exclude); err != nil {
+		return nil, err
+	}
+	return scope, nil
+}
+
+// compileFilters compiles include/exclude patterns, wrapping errors in kind
+func compileFilters(kind error, name string, patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid %s pattern %q: %v", kind, name, pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// runCrawl fetches the crawl breadth-first, one depth level at a time,
+// until the frontier is empty or the page budget is spent
+func (fs *FetchService) runCrawl(job *models.CrawlJob, scope *crawlScope) {
+	req := job.Request
+	// The whole crawl runs with the settings it started with
+	cfg := fs.config.Load()
+	_, span := cfg.Tracer.Start(tracing.ContextWithTraceparent(context.Background(), req.Traceparent),
+		"crawl", tracing.KindInternal,
+		tracing.String("job_id", job.JobID),
+		tracing.Int("seeds", len(req.Seeds)))
+	opts := FetchOptions{Tenant: req.Tenant, RequestID: req.RequestID, Traceparent: span.SpanContext().Traceparent()}
+
+	concurrency := cfg.CrawlConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultCrawlConcurrency
+	}
+
+	visited := make(map[string]bool)
+	var level []crawlTask
+	for _, seed := range req.Seeds {
+		key := normalizeURL(seed, cfg.DedupSortQuery)
+		if !visited[key] {
+			visited[key] = true
+			level = append(level, crawlTask{url: seed})
+		}
+	}
+
+	status := models.JobCompleted
+	pages := 0
+	for depth := 0; len(level) > 0; depth++ {
+		if remaining := req.MaxPages - pages; len(level) > remaining {
+			level = level[:remaining]
+		}
+
+		fs.crawlMu.Lock()
+		job.CurrentDepth = depth
+		fs.crawlMu.Unlock()
+
+		var (
+			mu   sync.Mutex
+			next []crawlTask
+			wg   sync.WaitGroup
+		)
+		sem := make(chan struct{}, concurrency)
+
+	tasks:
+		for _, task := range level {
+			select {
+			case <-fs.done:
+				status = models.JobCancelled
+				break tasks
+			case sem <- struct{}{}:
+			}
+
+			wg.Add(1)
+			go func(task crawlTask) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				links := fs.crawlPage(job, task, opts)
+				if task.depth >= *req.MaxDepth {
+					return
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				for _, link := range links {
+					if link.Tag != "a" && link.Tag != "area" {
+						continue
+					}
+					u, err := url.Parse(link.URL)
+					if err != nil || !scope.allows(u) {
+						continue
+					}
+					key := normalizeURL(link.URL, cfg.DedupSortQuery)
+					if visited[key] {
+						continue
+					}
+					visited[key] = true
+					next = append(next, crawlTask{url: link.URL, parent: task.url, depth: task.depth + 1})
+				}
+			}(task)
+		}
+		wg.Wait()
+
+		pages += len(level)
+		level = next
+
+		fs.crawlMu.Lock()
+		job.LinksDiscovered += len(next)
+		fs.crawlMu.Unlock()
+
+		if status == models.JobCancelled || pages >= req.MaxPages {
+			break
+		}
+	}
+
+	fs.crawlMu.Lock()
+	job.Status = status
+	job.FinishedAt = time.Now()
+	fs.crawlMu.Unlock()
+
+	span.SetAttributes(tracing.String("crawl.status", status), tracing.Int("crawl.pages", pages))
+	span.End()
+
+	slog.InfoContext(logging.WithRequestID(context.Background(), job.Request.RequestID), "Crawl finished",
+		"job_id", job.JobID, "status", status, "pages", pages)
+}
+
+// crawlPage fetches one crawl page into a result with opts and returns its
+// links
+func (fs *FetchService) crawlPage(job *models.CrawlJob, task crawlTask, opts FetchOptions) []pageLink {
+	record := fs.addResult(models.FetchResult{
+		URL:       task.url,
+		Status:    "pending",
+		CreatedAt: time.Now(),
+		JobID:     job.JobID,
+		Tenant:    job.Request.Tenant,
+		RequestID: job.Request.RequestID,
+		ParentURL: task.parent,
+		Depth:     task.depth,
+	})
+
+	result := fs.fetchShared(task.url, opts)
+	fs.updateResult(record, result)
+
+	fs.crawlMu.Lock()
+	job.PagesFetched++
+	fs.crawlMu.Unlock()
+
+	if result.Status != "success" || !isHTML(result.ContentType) {
+		return nil
+	}
+
+	base, err := url.Parse(result.FinalURL)
+	if err != nil || result.FinalURL == "" {
+		if base, err = url.Parse(task.url); err != nil {
+			return nil
+		}
+	}
+	return extractLinks(result.Content, base)
+}
+
+// cleanupCrawls drops finished crawls older than ResultTTL. Their pages are
+// subject to the regular result cleanup.
+func (fs *FetchService) cleanupCrawls(now time.Time) {
+	fs.crawlMu.Lock()
+	defer fs.crawlMu.Unlock()
+
+	for id, job := range fs.crawls {
+		if job.Status != models.JobRunning && now.Sub(job.FinishedAt) >= fs.config.Load().ResultTTL {
+			delete(fs.crawls, id)
+		}
+	}
+}
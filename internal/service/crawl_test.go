@@ -0,0 +1,239 @@
+package service
+
+import (
+	"errors"
+	"fetch/cmd/model"
+	"fetch/internal/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestExtractLinks(t *testing.T) {
+	base, _ := url.Parse("https://example.com/docs/index.html")
+	body := `<html><body>
+		<a href="page.html">Relative <b>page</b></a>
+		<a HREF='/root#section'>Root</a>
+		<a href="https://other.org/x?a=1&amp;b=2">Other</a>
+		<a href="mailto:someone@example.com">Mail</a>
+		<a href="#top">Top</a>
+		<!-- <a href="/commented">Hidden</a> -->
+		<img src="/logo.png" alt="logo">
+	</body></html>`
+
+	links := extractLinks(body, base)
+
+	expected := []pageLink{
+		{URL: "https://example.com/docs/page.html", Tag: "a", Text: "Relative page"},
+		{URL: "https://example.com/root", Tag: "a", Text: "Root"},
+		{URL: "https://other.org/x?a=1&b=2", Tag: "a", Text: "Other"},
+		{URL: "https://example.com/logo.png", Tag: "img"},
+	}
+	if len(links) != len(expected) {
+		t.Fatalf("expected %d links, got %d: %+v", len(expected), len(links), links)
+	}
+	for i := range expected {
+		if links[i] != expected[i] {
+			t.Errorf("link %d: expected %+v, got %+v", i, expected[i], links[i])
+		}
+	}
+}
+
+func TestExtractLinksHonorsBase(t *testing.T) {
+	base, _ := url.Parse("https://example.com/")
+	links := extractLinks(`<base href="https://cdn.example.com/v2/"><a href="a">A</a>`, base)
+
+	if len(links) != 1 || links[0].URL != "https://cdn.example.com/v2/a" {
+		t.Errorf("expected link resolved against <base>, got %+v", links)
+	}
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+// newTestSite serves routes by exact path and 404s everything else.
+func newTestSite(routes map[string]http.HandlerFunc) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, ok := routes[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		route(w, r)
+	}))
+}
+
+func htmlPage(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(body))
+	}
+}
+
+func newCrawlTestSite() *httptest.Server {
+	return newTestSite(map[string]http.HandlerFunc{
+		"/":  htmlPage(`<a href="/a">A</a> <a href="/b">B</a> <a href="https://elsewhere.invalid/">Out</a>`),
+		"/a": htmlPage(`<a href="/c">C</a> <a href="/">Home</a>`),
+		"/b": htmlPage(`<a href="/private/x">Private</a>`),
+		"/c": htmlPage(`<a href="/d">D</a>`),
+	})
+}
+
+// waitForJob polls a background job's status until it is no longer running.
+func waitForJob(t *testing.T, status func() (string, error)) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		current, err := status()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if current != models.JobRunning {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("job did not finish in time")
+}
+
+func waitForCrawl(t *testing.T, service *FetchService, jobID string) models.CrawlJob {
+	t.Helper()
+	var job models.CrawlJob
+	waitForJob(t, func() (status string, err error) {
+		job, err = service.GetCrawl(jobID)
+		return job.Status, err
+	})
+	return job
+}
+
+func TestCrawlRecordsParentAndDepth(t *testing.T) {
+	site := newCrawlTestSite()
+	defer site.Close()
+
+	service := NewFetchService(testConfig(), ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	job, err := service.StartCrawl(models.CrawlRequest{
+		Seeds:    []string{site.URL + "/"},
+		MaxDepth: intPtr(2),
+		MaxPages: 10,
+		Exclude:  []string{`/private/`},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	finished := waitForCrawl(t, service, job.JobID)
+	if finished.Status != models.JobCompleted {
+		t.Errorf("expected completed crawl, got %s", finished.Status)
+	}
+
+	results := service.GetJobResults(job.JobID)
+	pages := make(map[string]models.FetchResult)
+	for _, result := range results.Results {
+		pages[result.URL] = result
+	}
+
+	// /d is beyond max depth, /private/x is excluded and the external link is out of scope
+	expected := map[string]struct {
+		parent string
+		depth  int
+	}{
+		site.URL + "/":  {"", 0},
+		site.URL + "/a": {site.URL + "/", 1},
+		site.URL + "/b": {site.URL + "/", 1},
+		site.URL + "/c": {site.URL + "/a", 2},
+	}
+	if len(pages) != len(expected) {
+		t.Fatalf("expected %d pages, got %d: %v", len(expected), len(pages), pages)
+	}
+	for u, want := range expected {
+		page, ok := pages[u]
+		if !ok {
+			t.Errorf("expected %s to be crawled", u)
+			continue
+		}
+		if page.ParentURL != want.parent || page.Depth != want.depth {
+			t.Errorf("%s: expected parent %q depth %d, got parent %q depth %d", u, want.parent, want.depth, page.ParentURL, page.Depth)
+		}
+		if page.Status != models.StatusSuccess {
+			t.Errorf("%s: expected success, got %s", u, page.Status)
+		}
+	}
+}
+
+func TestCrawlDefaultDepth(t *testing.T) {
+	site := newCrawlTestSite()
+	defer site.Close()
+
+	service := NewFetchService(testConfig(), ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	tests := []struct {
+		maxDepth *int
+		pages    int
+	}{
+		{nil, 3},       // The seed, /a and /b
+		{intPtr(0), 1}, // Only the seed
+	}
+	for _, tt := range tests {
+		job, err := service.StartCrawl(models.CrawlRequest{Seeds: []string{site.URL + "/"}, MaxDepth: tt.maxDepth})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if tt.maxDepth == nil && (job.Request.MaxDepth == nil || *job.Request.MaxDepth != 1) {
+			t.Errorf("expected max_depth to default to 1, got %v", job.Request.MaxDepth)
+		}
+
+		waitForCrawl(t, service, job.JobID)
+		if results := service.GetJobResults(job.JobID); results.TotalURLs != tt.pages {
+			t.Errorf("expected %d pages, got %d", tt.pages, results.TotalURLs)
+		}
+	}
+}
+
+func TestCrawlMaxPages(t *testing.T) {
+	site := newCrawlTestSite()
+	defer site.Close()
+
+	service := NewFetchService(testConfig(), ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	job, err := service.StartCrawl(models.CrawlRequest{
+		Seeds:    []string{site.URL + "/"},
+		MaxDepth: intPtr(5),
+		MaxPages: 2,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	waitForCrawl(t, service, job.JobID)
+	if results := service.GetJobResults(job.JobID); results.TotalURLs != 2 {
+		t.Errorf("expected 2 pages, got %d", results.TotalURLs)
+	}
+}
+
+func TestStartCrawlValidation(t *testing.T) {
+	service := createTestService()
+	defer service.Stop()
+
+	tests := []models.CrawlRequest{
+		{},
+		{Seeds: []string{"ftp://example.com"}},
+		{Seeds: []string{"https://example.com"}, MaxDepth: intPtr(-1)},
+		{Seeds: []string{"https://example.com"}, MaxDepth: intPtr(100)},
+		{Seeds: []string{"https://example.com"}, Scope: "planet"},
+		{Seeds: []string{"https://example.com"}, Scope: CrawlScopeRegex},
+		{Seeds: []string{"https://example.com"}, Include: []string{"("}},
+	}
+
+	for _, req := range tests {
+		if _, err := service.StartCrawl(req); !errors.Is(err, ErrInvalidCrawl) {
+			t.Errorf("expected ErrInvalidCrawl for %+v, got %v", req, err)
+		}
+	}
+}
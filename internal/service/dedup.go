@@ -0,0 +1,123 @@
+package service
+
+import (
+	"fetch/cmd/model"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// normalizeURL returns a canonical form of rawURL used to detect duplicates:
+// lower-cased scheme and host, default ports removed, an empty path replaced
+// by "/", the fragment stripped and, optionally, query parameters sorted.
+// Unparseable URLs are returned unchanged.
+func normalizeURL(rawURL string, sortQuery bool) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		u.Host = "[" + host + "]"
+	} else {
+		u.Host = host
+	}
+
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	if sortQuery && u.RawQuery != "" {
+		u.RawQuery = u.Query().Encode()
+	}
+
+	return u.String()
+}
+
+// flightCall is an in-progress or completed fetch shared by several callers
+type flightCall struct {
+	wg     sync.WaitGroup
+	result models.FetchResult
+}
+
+// flightKey identifies fetches that may be coalesced
+type flightKey struct {
+	cache string
+	tenantURL
+}
+
+// flightGroup coalesces concurrent fetches with the same key into one
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[flightKey]*flightCall
+}
+
+// do runs fn once for all concurrent callers with the same key and returns
+// its result to each of them. shared is true for callers that did not run fn.
+func (g *flightGroup) do(key flightKey, fn func() models.FetchResult) (result models.FetchResult, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[flightKey]*flightCall)
+	}
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		call.wg.Wait()
+		return call.result, true
+	}
+	call := &flightCall{}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	call.result = fn()
+	call.wg.Done()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+
+	return call.result, false
+}
+
+// fetchShared fetches url, joining an identical fetch already in flight
+// when deduplication is enabled. The returned result always carries the
+// caller's own URL.
+func (fs *FetchService) fetchShared(rawURL string, opts FetchOptions) models.FetchResult {
+	cfg := fs.config.Load()
+	// Change history is kept per tenant, so each tenant only sees diffs
+	// against its own earlier fetches
+	key := tenantURL{tenant: opts.Tenant, url: rawURL}
+	if cfg.DedupEnabled {
+		key.url = normalizeURL(rawURL, cfg.DedupSortQuery)
+	}
+
+	fetch := func() models.FetchResult {
+		result := fs.fetch(rawURL, opts)
+		if result.Status == "success" && cfg.ChangeDetection {
+			fs.detectChange(key, &result)
+		}
+		return result
+	}
+
+	if !cfg.DedupEnabled {
+		return fetch()
+	}
+
+	// Different cache modes may legitimately produce different results, and
+	// change detection differs per tenant
+	result, shared := fs.inflight.do(flightKey{cache: opts.Cache, tenantURL: key}, fetch)
+	result.URL = rawURL
+	result.Deduplicated = shared
+	return result
+}
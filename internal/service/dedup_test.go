@@ -0,0 +1,82 @@
+package service
+
+import (
+	"fetch/internal/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		input     string
+		sortQuery bool
+		expected  string
+	}{
+		{"HTTP://Example.COM", false, "http://example.com/"},
+		{"https://example.com:443/a", false, "https://example.com/a"},
+		{"http://example.com:80/a", false, "http://example.com/a"},
+		{"http://example.com:8080/a", false, "http://example.com:8080/a"},
+		{"https://example.com/a#section", false, "https://example.com/a"},
+		{"https://example.com/a?b=2&a=1", false, "https://example.com/a?b=2&a=1"},
+		{"https://example.com/a?b=2&a=1", true, "https://example.com/a?a=1&b=2"},
+		{"https://[::1]:443/", false, "https://[::1]/"},
+		{"not a url", false, "not a url"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeURL(tt.input, tt.sortQuery); got != tt.expected {
+			t.Errorf("normalizeURL(%q, %t) = %q, expected %q", tt.input, tt.sortQuery, got, tt.expected)
+		}
+	}
+}
+
+func TestSubmitURLsDeduplicatesInFlightFetches(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("shared"))
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.DedupEnabled = true
+	service := NewFetchService(cfg, ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	// Duplicates within one submission and across two concurrent submissions
+	service.SubmitURLs([]string{server.URL, server.URL + "/#top"})
+	service.SubmitURLs([]string{server.URL + "/"})
+
+	time.Sleep(300 * time.Millisecond)
+
+	if n := requests.Load(); n != 1 {
+		t.Errorf("expected 1 outbound request, got %d", n)
+	}
+
+	results := service.GetResults()
+	if results.TotalURLs != 3 || results.SuccessCount != 3 {
+		t.Fatalf("expected 3 successful result records, got %d total / %d success", results.TotalURLs, results.SuccessCount)
+	}
+
+	deduplicated := 0
+	for _, result := range results.Results {
+		if result.Content != "shared" {
+			t.Errorf("expected shared content for %s, got %q", result.URL, result.Content)
+		}
+		if result.Deduplicated {
+			deduplicated++
+		}
+	}
+	if deduplicated != 2 {
+		t.Errorf("expected 2 deduplicated results, got %d", deduplicated)
+	}
+
+	// Each record keeps the URL as submitted
+	if results.Results[1].URL != server.URL+"/#top" {
+		t.Errorf("expected submitted URL to be preserved, got %s", results.Results[1].URL)
+	}
+}
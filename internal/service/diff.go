@@ -0,0 +1,203 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Diff limits keep change detection cheap on large pages
+const (
+	diffContextLines = 3
+	diffMaxLines     = 200     // Lines of unified diff kept in a summary
+	diffMaxCells     = 4000000 // Upper bound on the line comparisons of a diff
+)
+
+// diffOp is a single line of an edit script
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	text string
+}
+
+// lineDiff computes a line-based edit script turning a into b.
+// Common prefixes and suffixes are stripped first; if the remaining
+// region would take too many comparisons it is reported as a full
+// replacement.
+func lineDiff(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(midA)*len(midB) > diffMaxCells {
+		ops = appendReplacement(ops, midA, midB)
+	} else {
+		ops = lcsDiff(ops, midA, midB)
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+// lcsDiff appends an edit script turning a into b to ops. It finds a
+// longest common subsequence with Hirschberg's algorithm, which needs
+// memory linear in the input rather than a full LCS table.
+func lcsDiff(ops []diffOp, a, b []string) []diffOp {
+	switch {
+	case len(a) == 0 || len(b) == 0:
+		return appendReplacement(ops, a, b)
+	case len(a) == 1:
+		for j, line := range b {
+			if line == a[0] {
+				ops = appendReplacement(ops, nil, b[:j])
+				ops = append(ops, diffOp{' ', line})
+				return appendReplacement(ops, nil, b[j+1:])
+			}
+		}
+		return appendReplacement(ops, a, b)
+	}
+
+	// Split b where the LCS of a's halves with its parts is longest
+	mid := len(a) / 2
+	forward := lcsLengths(a[:mid], b, false)
+	backward := lcsLengths(a[mid:], b, true)
+	split, best := 0, -1
+	for j := range forward {
+		if length := forward[j] + backward[len(b)-j]; length > best {
+			split, best = j, length
+		}
+	}
+
+	ops = lcsDiff(ops, a[:mid], b[:split])
+	return lcsDiff(ops, a[mid:], b[split:])
+}
+
+// lcsLengths returns the LCS lengths of a with each prefix of b, indexed
+// by the prefix length, in a single row of the LCS table. With reverse
+// set both are read back to front, giving the lengths for b's suffixes.
+func lcsLengths(a, b []string, reverse bool) []int {
+	at := func(s []string, i int) string {
+		if reverse {
+			return s[len(s)-1-i]
+		}
+		return s[i]
+	}
+
+	row := make([]int, len(b)+1)
+	for i := range a {
+		diagonal := 0 // row[j-1] of the previous row
+		for j := 1; j <= len(b); j++ {
+			above := row[j]
+			if at(a, i) == at(b, j-1) {
+				row[j] = diagonal + 1
+			} else {
+				row[j] = max(above, row[j-1])
+			}
+			diagonal = above
+		}
+	}
+	return row
+}
+
+// appendReplacement appends the removal of a and the addition of b to ops
+func appendReplacement(ops []diffOp, a, b []string) []diffOp {
+	for _, line := range a {
+		ops = append(ops, diffOp{'-', line})
+	}
+	for _, line := range b {
+		ops = append(ops, diffOp{'+', line})
+	}
+	return ops
+}
+
+// unifiedDiff renders an edit script as unified diff hunks with a few lines
+// of context. The output is capped at diffMaxLines lines.
+func unifiedDiff(ops []diffOp) (diff string, added, removed int, truncated bool) {
+	var sb strings.Builder
+	lines := 0
+
+	for start := 0; start < len(ops); {
+		// Find the next change
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+
+		// Extend the hunk while changes are within 2*context lines of each other
+		hunkStart := max(start-diffContextLines, 0)
+		end := start
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			gap := end
+			for gap < len(ops) && ops[gap].kind == ' ' {
+				gap++
+			}
+			if gap == len(ops) || gap-end > 2*diffContextLines {
+				break
+			}
+			end = gap
+		}
+		hunkEnd := min(end+diffContextLines, len(ops))
+
+		// Line numbers are 1-based positions in the old and new documents
+		oldLine, newLine := 1, 1
+		for _, op := range ops[:hunkStart] {
+			if op.kind != '+' {
+				oldLine++
+			}
+			if op.kind != '-' {
+				newLine++
+			}
+		}
+		oldCount, newCount := 0, 0
+		for _, op := range ops[hunkStart:hunkEnd] {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+
+		if lines < diffMaxLines {
+			fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", oldLine, oldCount, newLine, newCount)
+			lines++
+		}
+		for _, op := range ops[hunkStart:hunkEnd] {
+			switch op.kind {
+			case '+':
+				added++
+			case '-':
+				removed++
+			}
+			if lines < diffMaxLines {
+				sb.WriteByte(op.kind)
+				sb.WriteString(op.text)
+				sb.WriteByte('\n')
+				lines++
+			} else {
+				truncated = true
+			}
+		}
+
+		start = hunkEnd
+	}
+
+	return sb.String(), added, removed, truncated
+}
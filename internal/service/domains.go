@@ -0,0 +1,100 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DomainSettings override fetch settings for a domain and its subdomains.
+// Zero fields keep the service-wide settings.
+type DomainSettings struct {
+	FetchTimeout   time.Duration
+	MaxRedirects   *int
+	MaxContentSize int64
+	UserAgent      string
+	Headers        map[string]string // Added to every request
+}
+
+// fetchSettings are the settings a single fetch runs with
+type fetchSettings struct {
+	domain         string // Entry of Config.Domains applied, "" if none
+	timeout        time.Duration
+	maxRedirects   int
+	maxContentSize int64
+	userAgent      string
+	headers        map[string]string
+}
+
+// settingsFor returns the settings for fetching from host: those of the
+// most specific domain in Config.Domains matching host, on top of the
+// service-wide ones
+func (fs *FetchService) settingsFor(host string) fetchSettings {
+	cfg := fs.config.Load()
+	s := fetchSettings{
+		timeout:        cfg.FetchTimeout,
+		maxRedirects:   cfg.MaxRedirects,
+		maxContentSize: cfg.MaxContentSize,
+		userAgent:      fs.userAgent,
+	}
+
+	domain, d, ok := domainFor(cfg.Domains, host)
+	if !ok {
+		return s
+	}
+	s.domain = domain
+	if d.FetchTimeout > 0 {
+		s.timeout = d.FetchTimeout
+	}
+	if d.MaxRedirects != nil {
+		s.maxRedirects = *d.MaxRedirects
+	}
+	if d.MaxContentSize > 0 {
+		s.maxContentSize = d.MaxContentSize
+	}
+	if d.UserAgent != "" {
+		s.userAgent = d.UserAgent
+	}
+	s.headers = d.Headers
+	return s
+}
+
+// prepareRedirect readies a redirect request of a fetch made with settings:
+// it copies the user agent, drops the domain's headers when leaving the
+// domain, checks robots.txt and waits for the host's egress rate limit,
+// returning how long that took
+func (fs *FetchService) prepareRedirect(req *http.Request, settings fetchSettings) (time.Duration, error) {
+	req.Header.Set("User-Agent", settings.userAgent)
+	// Don't leak a domain's headers to hosts outside it
+	if len(settings.headers) > 0 && fs.settingsFor(req.URL.Hostname()).domain != settings.domain {
+		for name := range settings.headers {
+			req.Header.Del(name)
+		}
+	}
+	if fs.robots != nil {
+		if err := fs.robots.check(req.Context(), req.URL); err != nil {
+			return 0, err
+		}
+	}
+	return fs.waitForHost(req.Context(), req.URL)
+}
+
+// domainFor returns the most specific domain of domains matching host with
+// its settings
+func domainFor(domains map[string]DomainSettings, host string) (string, DomainSettings, bool) {
+	if len(domains) == 0 {
+		return "", DomainSettings{}, false
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for domain := host; domain != ""; {
+		if d, ok := domains[domain]; ok {
+			return domain, d, true
+		}
+		_, parent, found := strings.Cut(domain, ".")
+		if !found {
+			break
+		}
+		domain = parent
+	}
+	return "", DomainSettings{}, false
+}
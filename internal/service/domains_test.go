@@ -0,0 +1,105 @@
+package service
+
+import (
+	"fetch/cmd/model"
+	"fetch/internal/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDomainSettings(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		headers = map[string]http.Header{}
+	)
+	record := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			headers[name+r.URL.Path] = r.Header.Clone()
+			mu.Unlock()
+			if r.URL.Path == "/redirect" {
+				http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+				return
+			}
+			w.Write([]byte("0123456789"))
+		}
+	}
+	origin := httptest.NewServer(record("origin"))
+	defer origin.Close()
+	other := httptest.NewServer(record("other"))
+	defer other.Close()
+
+	// The servers are 127.0.0.1, which has overrides, and localhost, which
+	// doesn't
+	otherURL := strings.Replace(other.URL, "127.0.0.1", "localhost", 1)
+	cfg := testConfig()
+	cfg.UserAgent = "default-agent"
+	cfg.Domains = map[string]DomainSettings{
+		"127.0.0.1": {
+			UserAgent:      "custom-agent",
+			Headers:        map[string]string{"X-Api-Token": "secret"},
+			MaxContentSize: 5,
+		},
+	}
+	service := NewFetchService(cfg, ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	result := service.fetch(origin.URL+"/page", FetchOptions{})
+	if result.Status != models.StatusFailed || !strings.Contains(result.Error, "exceeds 5 bytes") {
+		t.Errorf("expected the domain's max content size to apply, got %+v", result)
+	}
+	result = service.fetch(origin.URL+"/redirect?to="+otherURL+"/landing", FetchOptions{})
+	if result.RedirectCount != 1 {
+		t.Fatalf("expected the redirect to be followed, got %+v", result)
+	}
+	service.fetch(otherURL+"/plain", FetchOptions{})
+
+	mu.Lock()
+	defer mu.Unlock()
+	for path, want := range map[string][2]string{
+		"origin/page":     {"custom-agent", "secret"},
+		"origin/redirect": {"custom-agent", "secret"},
+		"other/landing":   {"custom-agent", ""}, // Not leaked outside the domain
+		"other/plain":     {"default-agent", ""},
+	} {
+		h := headers[path]
+		if h == nil {
+			t.Errorf("%s: not requested", path)
+			continue
+		}
+		if got := h.Get("User-Agent"); got != want[0] {
+			t.Errorf("%s: expected User-Agent %q, got %q", path, want[0], got)
+		}
+		if got := h.Get("X-Api-Token"); got != want[1] {
+			t.Errorf("%s: expected X-Api-Token %q, got %q", path, want[1], got)
+		}
+	}
+}
+
+func TestDomainForMatchesSubdomains(t *testing.T) {
+	cfg := testConfig()
+	cfg.Domains = map[string]DomainSettings{
+		"example.com":     {UserAgent: "example"},
+		"api.example.com": {UserAgent: "api"},
+	}
+	service := NewFetchService(cfg, ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	for host, want := range map[string][2]string{
+		"example.com":        {"example.com", "example"},
+		"WWW.Example.com.":   {"example.com", "example"},
+		"api.example.com":    {"api.example.com", "api"},
+		"v2.api.example.com": {"api.example.com", "api"},
+		"notexample.com":     {"", defaultUserAgent},
+	} {
+		settings := service.settingsFor(host)
+		if settings.domain != want[0] || settings.userAgent != want[1] {
+			t.Errorf("%s: expected domain %q with user agent %q, got %q with %q",
+				host, want[0], want[1], settings.domain, settings.userAgent)
+		}
+	}
+}
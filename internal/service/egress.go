@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"fetch/cmd/model"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// waitForHost waits until the egress rate limit of u's host allows a
+// request and returns how long that took
+func (fs *FetchService) waitForHost(ctx context.Context, u *url.URL) (time.Duration, error) {
+	egress := fs.config.Load().Egress
+	if egress == nil || u.Hostname() == "" {
+		return 0, nil
+	}
+	waited, err := egress.Wait(ctx, u.Hostname())
+	if err != nil {
+		return waited, fmt.Errorf("waiting for egress rate limit: %w", err)
+	}
+	return waited, nil
+}
+
+// throttledResult builds a failed result for a URL whose host's egress rate
+// limit didn't allow a request in time
+func throttledResult(url string, err error, redirectCount int, startTime time.Time) models.FetchResult {
+	return models.FetchResult{
+		URL:           url,
+		Status:        "failed",
+		Error:         fmt.Sprintf("Not fetched: %v", err),
+		FailureReason: models.FailureThrottled,
+		Duration:      time.Since(startTime).String(),
+		RedirectCount: redirectCount,
+	}
+}
+
+// hostname returns the host of rawURL, "" if it doesn't parse
+func hostname(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"fetch/cmd/model"
+	"fetch/internal/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFetchWaitsForEgressRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("page"))
+	}))
+	defer server.Close()
+
+	egress, err := ratelimit.NewHostLimiter(ratelimit.HostLimit{Rate: 10, Window: time.Second, Burst: 1}, nil, time.Second)
+	if err != nil {
+		t.Fatalf("NewHostLimiter failed: %v", err)
+	}
+	cfg := testConfig()
+	cfg.Egress = egress
+	service := NewFetchService(cfg, ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	start := time.Now()
+	service.SubmitURLs([]string{server.URL + "/1", server.URL + "/2", server.URL + "/3"})
+	deadline := time.Now().Add(5 * time.Second)
+	for service.GetResults().PendingCount > 0 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// One request per 100ms to the test server
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("expected fetches to be spread out, all finished after %v", elapsed)
+	}
+	throttled := 0
+	for _, result := range service.GetResults().Results {
+		if result.Status != models.StatusSuccess {
+			t.Errorf("expected %s to succeed, got %s: %s", result.URL, result.Status, result.Error)
+		}
+		if result.ThrottledFor != "" {
+			throttled++
+		}
+	}
+	if throttled < 2 {
+		t.Errorf("expected at least 2 throttled fetches, got %d", throttled)
+	}
+}
+
+func TestFetchFailsWhenEgressWaitTooLong(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("page"))
+	}))
+	defer server.Close()
+
+	egress, err := ratelimit.NewHostLimiter(ratelimit.HostLimit{Rate: 1, Window: time.Hour, Burst: 1}, nil, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewHostLimiter failed: %v", err)
+	}
+	cfg := testConfig()
+	cfg.Egress = egress
+	service := NewFetchService(cfg, ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	first := service.fetch(server.URL+"/1", FetchOptions{})
+	second := service.fetch(server.URL+"/2", FetchOptions{})
+	if first.Status != models.StatusSuccess {
+		t.Errorf("expected the first fetch to succeed, got %s: %s", first.Status, first.Error)
+	}
+	if second.Status != models.StatusFailed || second.FailureReason != models.FailureThrottled {
+		t.Errorf("expected the second fetch to fail as throttled, got %s (%s)", second.Status, second.FailureReason)
+	}
+}
@@ -2,57 +2,158 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fetch/cmd/model"
+	"fetch/internal/logging"
+	"fetch/internal/metrics"
 	"fetch/internal/ratelimit"
+	"fetch/internal/tracing"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"regexp"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// defaultUserAgent identifies the service when Config.UserAgent is unset
+const defaultUserAgent = "URL-Fetch-Service/1.0"
+
+// defaultFetchConcurrency applies when Config.FetchConcurrency is unset
+const defaultFetchConcurrency = 50
+
 // Config holds service configuration
 type Config struct {
 	FetchTimeout       time.Duration
 	MaxRedirects       int
 	MaxContentSize     int64
+	FetchConcurrency   int // URLs fetched in parallel per job
 	ResultTTL          time.Duration
 	CleanupInterval    time.Duration
 	MaxResultsInMemory int
+
+	ScheduleHistorySize int           // Runs kept per schedule
+	MinScheduleInterval time.Duration // Shortest allowed interval between runs
+
+	ChangeDetection           bool     // Compare each fetch with the previous one for the same URL
+	ChangeIgnorePatterns      []string // Regexes removed from content before comparing
+	ChangeNormalizeWhitespace bool     // Collapse whitespace and drop blank lines before comparing
+
+	CacheEnabled    bool // Keep a shared HTTP response cache
+	CacheMaxEntries int  // Maximum number of cached responses
+
+	DedupEnabled   bool // Share one outbound fetch between concurrent identical URLs
+	DedupSortQuery bool // Treat URLs differing only in query parameter order as identical
+
+	CrawlMaxDepth    int // Upper bound on a crawl's max_depth
+	CrawlMaxPages    int // Upper bound on a crawl's max_pages
+	CrawlConcurrency int // Pages fetched in parallel per crawl
+
+	UserAgent      string        // User-Agent sent with every request
+	RobotsEnabled  bool          // Honor robots.txt Allow/Disallow and Crawl-delay
+	RobotsCacheTTL time.Duration // How long a host's robots.txt is cached
+
+	SitemapMaxURLs int // Upper bound on URLs submitted from one sitemap
+
+	LinkCheckMaxLinks    int // Distinct link targets checked per link check
+	LinkCheckConcurrency int // Links checked in parallel per link check
+
+	TenantQuotas map[string]TenantQuota // Per-tenant overrides of MaxResultsInMemory and ResultTTL
+
+	Egress *ratelimit.HostLimiter // Outbound rate limits per target host; nil disables them
+
+	Tracer *tracing.Tracer // Records spans of jobs and outbound requests; nil disables tracing
+
+	Domains map[string]DomainSettings // Overrides by lowercase domain, also applied to subdomains
 }
 
 // FetchService manages URL fetching operations
 type FetchService struct {
 	mu              sync.RWMutex
-	results         []models.FetchResult
+	results         []*models.FetchResult // Fetches hold their record, so compaction can't misdirect updates
 	lastSubmission  time.Time
 	httpClient      *http.Client
 	rateLimiter     *ratelimit.RateLimiter
 	cleanupTicker   *time.Ticker
 	cleanupStopChan chan struct{}
 	cleanupStats    models.CleanupStats
-	config          Config
+	config          atomic.Pointer[Config] // Replaced by Reconfigure
+
+	schedMu   sync.RWMutex
+	schedules map[string]*schedule
+
+	changeMu       sync.Mutex
+	snapshots      map[tenantURL]contentSnapshot
+	ignorePatterns []*regexp.Regexp
+
+	cache *responseCache // nil when caching is disabled
+
+	inflight flightGroup
+
+	crawlMu sync.RWMutex
+	crawls  map[string]*models.CrawlJob
+
+	linkMu     sync.RWMutex
+	linkChecks map[string]*models.LinkCheckJob
+
+	done chan struct{} // Closed when the service stops
+
+	userAgent string
+	robots    *robotsCache // nil when robots.txt compliance is disabled
+
+	registry      *metrics.Registry
+	metrics       serviceMetrics
+	activeFetches atomic.Int64
 }
 
 // NewFetchService creates a new fetch service instance
 func NewFetchService(cfg Config, rateLimiter *ratelimit.RateLimiter) *FetchService {
 	fs := &FetchService{
-		results: make([]models.FetchResult, 0),
-		httpClient: &http.Client{
-			Timeout: cfg.FetchTimeout,
-			CheckRedirect: func(req *http.Request, via []*http.Request) error {
-				if len(via) >= cfg.MaxRedirects {
-					return fmt.Errorf("stopped after %d redirects", cfg.MaxRedirects)
-				}
-				return nil
-			},
-		},
+		results:         make([]*models.FetchResult, 0),
 		rateLimiter:     rateLimiter,
 		cleanupTicker:   time.NewTicker(cfg.CleanupInterval),
 		cleanupStopChan: make(chan struct{}),
-		config:          cfg,
+		schedules:       make(map[string]*schedule),
+		snapshots:       make(map[tenantURL]contentSnapshot),
+		crawls:          make(map[string]*models.CrawlJob),
+		linkChecks:      make(map[string]*models.LinkCheckJob),
+		done:            make(chan struct{}),
+		ignorePatterns:  compileIgnorePatterns(cfg.ChangeIgnorePatterns),
+		registry:        metrics.NewRegistry(),
+	}
+	fs.config.Store(&cfg)
+	fs.httpClient = &http.Client{
+		Timeout: cfg.FetchTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if maxRedirects := fs.config.Load().MaxRedirects; len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}
+	fs.registerMetrics()
+
+	// Every outbound request, including redirect hops and robots.txt and
+	// sitemap fetches, gets a client span
+	if cfg.Tracer != nil {
+		fs.httpClient.Transport = tracing.Transport(http.DefaultTransport, cfg.Tracer)
+	}
+
+	fs.userAgent = cfg.UserAgent
+	if fs.userAgent == "" {
+		fs.userAgent = defaultUserAgent
+	}
+	if cfg.RobotsEnabled {
+		fs.robots = newRobotsCache(fs.httpClient, fs.userAgent, cfg.RobotsCacheTTL)
+	}
+
+	if cfg.CacheEnabled && cfg.CacheMaxEntries > 0 {
+		fs.cache = newResponseCache(cfg.CacheMaxEntries)
 	}
 
 	// Start automatic cleanup goroutine
@@ -61,125 +162,352 @@ func NewFetchService(cfg Config, rateLimiter *ratelimit.RateLimiter) *FetchServi
 	return fs
 }
 
-// SubmitURLs receives URLs and starts fetching them concurrently
-func (fs *FetchService) SubmitURLs(urls []string) {
+// Reconfigure applies cfg to fetches, jobs and cleanups started from now on
+// and resets the cleanup ticker when CleanupInterval changes. Settings of
+// components created with the service are kept: the response cache,
+// robots.txt cache, user agent, change ignore patterns, egress limiter and
+// tracer.
+func (fs *FetchService) Reconfigure(cfg Config) {
+	old := fs.config.Load()
+	cfg.CacheEnabled, cfg.CacheMaxEntries = old.CacheEnabled, old.CacheMaxEntries
+	cfg.UserAgent, cfg.RobotsEnabled, cfg.RobotsCacheTTL = old.UserAgent, old.RobotsEnabled, old.RobotsCacheTTL
+	cfg.ChangeIgnorePatterns = old.ChangeIgnorePatterns
+	cfg.Egress, cfg.Tracer = old.Egress, old.Tracer
+	fs.config.Store(&cfg)
+
+	if cfg.CleanupInterval != old.CleanupInterval {
+		fs.cleanupTicker.Reset(cfg.CleanupInterval)
+	}
+}
+
+// Config returns the settings in effect
+func (fs *FetchService) Config() Config {
+	return *fs.config.Load()
+}
+
+// FetchOptions holds per-submission fetch settings
+type FetchOptions struct {
+	Cache     string // One of the Cache* modes
+	Tenant    string // Tenant the results belong to; "" when authentication is disabled
+	RequestID string // X-Request-ID of the submitting request, added to results and log lines
+
+	// Traceparent is the W3C trace context of the span the fetches belong
+	// to; "" starts a new trace
+	Traceparent string
+}
+
+// SubmitURLs receives URLs and starts fetching them concurrently.
+// It returns the job ID shared by all results of this submission.
+func (fs *FetchService) SubmitURLs(urls []string) string {
+	return fs.SubmitURLsWithOptions(urls, FetchOptions{})
+}
+
+// SubmitURLsWithOptions is SubmitURLs with per-submission fetch options
+func (fs *FetchService) SubmitURLsWithOptions(urls []string, opts FetchOptions) string {
+	jobID, _ := fs.submit(urls, opts)
+	return jobID
+}
+
+// FetchURLs is SubmitURLsWithOptions waiting for every fetch to complete.
+// It returns the job's results.
+func (fs *FetchService) FetchURLs(urls []string, opts FetchOptions) models.FetchResponse {
+	jobID, done := fs.submit(urls, opts)
+	<-done
+	return fs.GetJobResults(jobID)
+}
+
+// submit starts fetching urls as a new job. The returned channel is closed
+// once every fetch completed.
+func (fs *FetchService) submit(urls []string, opts FetchOptions) (string, <-chan struct{}) {
+	jobID := newID()
+	done := make(chan struct{})
+
+	// Each fetch of the job is a child of the job's span
+	_, span := fs.config.Load().Tracer.Start(tracing.ContextWithTraceparent(context.Background(), opts.Traceparent),
+		"fetch job", tracing.KindInternal,
+		tracing.String("job_id", jobID),
+		tracing.Int("urls", len(urls)))
+	opts.Traceparent = span.SpanContext().Traceparent()
+
 	fs.mu.Lock()
 	fs.lastSubmission = time.Now()
 
 	// Add all URLs with pending status
 	now := time.Now()
-	for _, url := range urls {
-		fs.results = append(fs.results, models.FetchResult{
+	records := make([]*models.FetchResult, len(urls))
+	for i, url := range urls {
+		records[i] = &models.FetchResult{
 			URL:       url,
 			Status:    "pending",
 			CreatedAt: now,
-		})
+			JobID:     jobID,
+			Tenant:    opts.Tenant,
+			RequestID: opts.RequestID,
+		}
 	}
+	fs.results = append(fs.results, records...)
 	fs.mu.Unlock()
 
-	// Fetch URLs concurrently
-	var wg sync.WaitGroup
-	for i := range urls {
-		wg.Add(1)
-		go func(index int) {
-			defer wg.Done()
-			fs.fetchURL(index)
-		}(len(fs.results) - len(urls) + i)
+	concurrency := fs.config.Load().FetchConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultFetchConcurrency
 	}
 
-	// Wait for all fetches to complete in a separate goroutine
+	// Fetch URLs concurrently, at most concurrency at a time, and wait for
+	// all fetches to complete in a separate goroutine
 	go func() {
+		sem := make(chan struct{}, concurrency)
+		var wg sync.WaitGroup
+		for _, record := range records {
+			sem <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				fs.fetchURL(record, opts)
+			}()
+		}
 		wg.Wait()
-		log.Println("All URLs fetched")
+		span.End()
+		slog.InfoContext(logging.WithRequestID(context.Background(), opts.RequestID),
+			"All URLs fetched", "job_id", jobID, "urls", len(urls))
+		close(done)
 	}()
+
+	return jobID, done
+}
+
+// addResult appends a single result and returns its record, to be
+// completed with updateResult
+func (fs *FetchService) addResult(result models.FetchResult) *models.FetchResult {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	record := &result
+	fs.results = append(fs.results, record)
+	return record
+}
+
+// GetJobResults returns the results belonging to a single job with statistics
+func (fs *FetchService) GetJobResults(jobID string) models.FetchResponse {
+	return fs.collectResults(func(r models.FetchResult) bool {
+		return r.JobID == jobID
+	})
+}
+
+// collectResults returns the results accepted by match with statistics
+func (fs *FetchService) collectResults(match func(models.FetchResult) bool) models.FetchResponse {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	response := models.FetchResponse{
+		Results:        make([]models.FetchResult, 0),
+		LastSubmission: fs.lastSubmission,
+	}
+
+	for _, result := range fs.results {
+		if !match(*result) {
+			continue
+		}
+		response.Results = append(response.Results, *result)
+		switch result.Status {
+		case "success":
+			response.SuccessCount++
+		case "failed":
+			response.FailedCount++
+		case "pending":
+			response.PendingCount++
+		}
+	}
+	response.TotalURLs = len(response.Results)
+
+	return response
 }
 
 // fetchURL fetches content from a single URL and updates the result
-func (fs *FetchService) fetchURL(index int) {
+func (fs *FetchService) fetchURL(record *models.FetchResult, opts FetchOptions) {
 	fs.mu.RLock()
-	url := fs.results[index].URL
+	url := record.URL
 	fs.mu.RUnlock()
 
+	fs.updateResult(record, fs.fetchShared(url, opts))
+}
+
+// fetch performs a single GET request, consulting the response cache
+// according to opts, and returns the completed result
+func (fs *FetchService) fetch(url string, opts FetchOptions) (result models.FetchResult) {
 	startTime := time.Now()
+	fs.activeFetches.Add(1)
+
+	// Log lines of the fetch carry the submitting request's ID, and its
+	// outbound requests are children of the fetch's span
+	base := logging.WithRequestID(context.Background(), opts.RequestID)
+	base, span := fs.config.Load().Tracer.Start(tracing.ContextWithTraceparent(base, opts.Traceparent),
+		"fetch", tracing.KindInternal, tracing.String("server.address", hostname(url)))
+
+	// Record time spent waiting for egress rate limits and metrics on
+	// every outcome
+	var throttled time.Duration
+	var errKind string
+	defer func() {
+		if throttled > 0 {
+			result.ThrottledFor = throttled.String()
+		}
+		result.RequestID = opts.RequestID
+		fs.activeFetches.Add(-1)
+		fs.recordFetch(result, errKind, time.Since(startTime))
+		endFetchSpan(span, result, errKind)
+	}()
 
 	// Validate URL format
 	if url == "" {
-		fs.updateResult(index, models.FetchResult{
+		errKind = errKindInvalidURL
+		return models.FetchResult{
 			URL:      url,
 			Status:   "failed",
 			Error:    "URL is empty",
 			Duration: time.Since(startTime).String(),
-		})
-		return
+		}
+	}
+
+	// Honor robots.txt, including Crawl-delay, before contacting the origin
+	if err := fs.checkRobots(base, url); err != nil {
+		slog.InfoContext(base, "Skipping URL disallowed by robots.txt", "url", url, "error", err)
+		return blockedResult(url, err, 0, startTime)
 	}
 
+	// Settings of the URL's domain apply to the whole redirect chain
+	settings := fs.settingsFor(hostname(url))
+
 	// Create a context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), fs.config.FetchTimeout)
+	ctx, cancel := context.WithTimeout(base, settings.timeout)
 	defer cancel()
 
 	// Create HTTP request
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		fs.updateResult(index, models.FetchResult{
+		slog.WarnContext(base, "Failed to create request", "url", url, "error", err)
+		errKind = errKindInvalidURL
+		return models.FetchResult{
 			URL:      url,
 			Status:   "failed",
 			Error:    fmt.Sprintf("Failed to create request: %v", err),
 			Duration: time.Since(startTime).String(),
-		})
-		log.Printf("Failed to create request for %s: %v", url, err)
-		return
+		}
 	}
 
-	// Set user agent to identify our service
-	req.Header.Set("User-Agent", "URL-Fetch-Service/1.0")
+	// Set user agent to identify our service, and the domain's headers
+	req.Header.Set("User-Agent", settings.userAgent)
+	for name, value := range settings.headers {
+		req.Header.Set(name, value)
+	}
+
+	// Serve from cache or turn the request into a conditional one
+	var cached *cacheEntry
+	if fs.cache != nil && opts.Cache != CacheBypass {
+		cached = fs.cache.lookup(req)
+	}
+	switch {
+	case opts.Cache == CacheOnly && cached == nil:
+		errKind = errKindCacheMiss
+		return models.FetchResult{
+			URL:      url,
+			Status:   "failed",
+			Error:    "Response not available in cache",
+			Duration: time.Since(startTime).String(),
+		}
+	case cached != nil && (opts.Cache == CacheOnly || opts.Cache == CachePrefer || cached.fresh(startTime)):
+		slog.InfoContext(base, "Served from cache", "url", url)
+		return cachedResult(url, cached, false, startTime)
+	case cached != nil:
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+
+	// Wait for the target host's egress rate limit. Waiting doesn't count
+	// toward the fetch timeout.
+	throttled, err = fs.waitForHost(base, req.URL)
+	if err != nil {
+		slog.WarnContext(base, "Not fetching URL", "url", url, "error", err)
+		return throttledResult(url, err, 0, startTime)
+	}
+	if throttled > 0 {
+		ctx, cancel = context.WithTimeout(base, settings.timeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
 
 	// Track redirects
 	redirectCount := 0
 	clientWithRedirectTracking := &http.Client{
-		Timeout: fs.httpClient.Timeout,
+		Transport: fs.httpClient.Transport,
+		Timeout:   settings.timeout,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			redirectCount = len(via)
-			if redirectCount >= fs.config.MaxRedirects {
-				return fmt.Errorf("stopped after %d redirects", fs.config.MaxRedirects)
+			if redirectCount >= settings.maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", settings.maxRedirects)
 			}
-			// Copy user agent to redirect requests
-			req.Header.Set("User-Agent", "URL-Fetch-Service/1.0")
-			return nil
+			waited, err := fs.prepareRedirect(req, settings)
+			throttled += waited
+			return err
 		},
 	}
 
 	// Perform the HTTP request
 	resp, err := clientWithRedirectTracking.Do(req)
 	if err != nil {
+		if errors.Is(err, errBlockedByRobots) {
+			slog.InfoContext(base, "Stopped redirect chain", "url", url, "error", err)
+			return blockedResult(url, err, redirectCount, startTime)
+		}
+		if errors.Is(err, ratelimit.ErrWaitTooLong) {
+			slog.WarnContext(base, "Stopped redirect chain", "url", url, "error", err)
+			return throttledResult(url, err, redirectCount, startTime)
+		}
+
 		// Check if error is due to redirect limit
 		errMsg := fmt.Sprintf("Failed to fetch URL: %v", err)
+		errKind = networkErrorKind(err)
 		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
 			errMsg = "Request timeout exceeded"
+			errKind = errKindTimeout
 		}
 
-		fs.updateResult(index, models.FetchResult{
+		slog.WarnContext(base, "Failed to fetch URL", "url", url, "error", err, "error_kind", errKind)
+		return models.FetchResult{
 			URL:           url,
 			Status:        "failed",
 			Error:         errMsg,
 			Duration:      time.Since(startTime).String(),
 			RedirectCount: redirectCount,
-		})
-		log.Printf("Failed to fetch %s: %v", url, err)
-		return
+		}
 	}
 	defer func() {
 		if closeErr := resp.Body.Close(); closeErr != nil {
-			log.Printf("Warning: failed to close response body for %s: %v", url, closeErr)
+			slog.WarnContext(base, "Failed to close response body", "url", url, "error", closeErr)
 		}
 	}()
 
+	// The cached copy is still valid
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		fs.cache.revalidated(req, resp, time.Now())
+		slog.InfoContext(base, "Revalidated cached response", "url", url)
+		return cachedResult(url, cached, true, startTime)
+	}
+
 	// Limit response body size to prevent memory issues
-	limitedReader := io.LimitReader(resp.Body, fs.config.MaxContentSize)
+	limitedReader := io.LimitReader(resp.Body, settings.maxContentSize)
 
 	// Read response body
 	body, err := io.ReadAll(limitedReader)
 	if err != nil {
-		fs.updateResult(index, models.FetchResult{
+		slog.WarnContext(base, "Failed to read response body", "url", url, "status_code", resp.StatusCode, "error", err)
+		errKind = errKindRead
+		return models.FetchResult{
 			URL:           url,
 			Status:        "failed",
 			StatusCode:    resp.StatusCode,
@@ -187,55 +515,113 @@ func (fs *FetchService) fetchURL(index int) {
 			Duration:      time.Since(startTime).String(),
 			FinalURL:      resp.Request.URL.String(),
 			RedirectCount: redirectCount,
-		})
-		log.Printf("Failed to read body from %s: %v", url, err)
-		return
+		}
 	}
 
 	// Check if we hit the size limit
-	if int64(len(body)) >= fs.config.MaxContentSize {
-		fs.updateResult(index, models.FetchResult{
+	if int64(len(body)) >= settings.maxContentSize {
+		slog.WarnContext(base, "Response too large", "url", url, "status_code", resp.StatusCode, "max_bytes", settings.maxContentSize)
+		errKind = errKindTooLarge
+		return models.FetchResult{
 			URL:           url,
 			Status:        "failed",
 			StatusCode:    resp.StatusCode,
-			Error:         fmt.Sprintf("Response body too large (exceeds %d bytes)", fs.config.MaxContentSize),
+			Error:         fmt.Sprintf("Response body too large (exceeds %d bytes)", settings.maxContentSize),
 			Duration:      time.Since(startTime).String(),
 			FinalURL:      resp.Request.URL.String(),
 			RedirectCount: redirectCount,
-		})
-		log.Printf("Response too large for %s", url)
-		return
+		}
 	}
 
 	// Get final URL after redirects
 	finalURL := resp.Request.URL.String()
 
-	// Update result with success
-	fs.updateResult(index, models.FetchResult{
+	if fs.cache != nil {
+		fs.cache.store(req, resp, body, redirectCount, time.Now())
+	}
+
+	slog.InfoContext(base, "Fetched URL",
+		"url", url,
+		"status_code", resp.StatusCode,
+		"bytes", len(body),
+		"redirects", redirectCount,
+		"duration", time.Since(startTime))
+
+	// Return result with success
+	return models.FetchResult{
 		URL:           url,
 		Status:        "success",
 		Content:       string(body),
 		ContentLength: len(body),
+		ContentType:   resp.Header.Get("Content-Type"),
 		StatusCode:    resp.StatusCode,
 		FetchedAt:     time.Now(),
 		Duration:      time.Since(startTime).String(),
 		FinalURL:      finalURL,
 		RedirectCount: redirectCount,
-	})
+	}
+}
+
+// endFetchSpan records the outcome of a fetch on its span and ends it
+func endFetchSpan(span *tracing.Span, result models.FetchResult, errKind string) {
+	span.SetAttributes(
+		tracing.String("fetch.status", result.Status),
+		tracing.Int("http.response.status_code", result.StatusCode),
+		tracing.Int("http.response.body.size", result.ContentLength),
+		tracing.Int("fetch.redirects", result.RedirectCount),
+		tracing.Bool("fetch.from_cache", result.FromCache),
+		tracing.String("error.type", fetchErrorKind(result, errKind)),
+	)
+	if result.Status != models.StatusSuccess {
+		span.SetError(result.Error)
+	}
+	span.End()
+}
 
-	log.Printf("Successfully fetched %s (status: %d, size: %d bytes, redirects: %d, duration: %s)",
-		url, resp.StatusCode, len(body), redirectCount, time.Since(startTime))
+// blockedResult builds a failed result for a URL disallowed by robots.txt
+func blockedResult(url string, err error, redirectCount int, startTime time.Time) models.FetchResult {
+	return models.FetchResult{
+		URL:           url,
+		Status:        "failed",
+		Error:         fmt.Sprintf("Not fetched: %v", err),
+		FailureReason: models.FailureBlockedByRobots,
+		Duration:      time.Since(startTime).String(),
+		RedirectCount: redirectCount,
+	}
+}
+
+// cachedResult builds a successful result from a cache entry
+func cachedResult(url string, entry *cacheEntry, revalidated bool, startTime time.Time) models.FetchResult {
+	return models.FetchResult{
+		URL:           url,
+		Status:        "success",
+		Content:       string(entry.body),
+		ContentLength: len(entry.body),
+		ContentType:   entry.contentType,
+		StatusCode:    entry.statusCode,
+		FetchedAt:     time.Now(),
+		Duration:      time.Since(startTime).String(),
+		FinalURL:      entry.finalURL,
+		RedirectCount: entry.redirects,
+		FromCache:     true,
+		Revalidated:   revalidated,
+	}
 }
 
-// updateResult updates a specific result at the given index
-func (fs *FetchService) updateResult(index int, result models.FetchResult) {
+// updateResult completes a result record. A record removed by cleanup or
+// a clear in the meantime is updated but no longer listed.
+func (fs *FetchService) updateResult(record *models.FetchResult, result models.FetchResult) {
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
-	if index >= 0 && index < len(fs.results) {
-		// Preserve CreatedAt from original result
-		result.CreatedAt = fs.results[index].CreatedAt
-		fs.results[index] = result
-	}
+
+	// Preserve submission metadata from original result
+	result.CreatedAt = record.CreatedAt
+	result.JobID = record.JobID
+	result.Tenant = record.Tenant
+	result.RequestID = record.RequestID
+	result.ParentURL = record.ParentURL
+	result.Depth = record.Depth
+	*record = result
 }
 
 // GetResults returns all fetch results with statistics
@@ -251,7 +637,7 @@ func (fs *FetchService) GetResults() models.FetchResponse {
 
 	// Copy results and calculate statistics
 	for i, result := range fs.results {
-		response.Results[i] = result
+		response.Results[i] = *result
 		switch result.Status {
 		case "success":
 			response.SuccessCount++
@@ -285,24 +671,35 @@ func (fs *FetchService) cleanupOldResults() {
 
 	now := time.Now()
 	cleaned := 0
-	newResults := make([]models.FetchResult, 0, len(fs.results))
-
-	// Remove results older than TTL
-	for _, result := range fs.results {
-		age := now.Sub(result.CreatedAt)
-		if age < fs.config.ResultTTL {
-			newResults = append(newResults, result)
-		} else {
+	newResults := make([]*models.FetchResult, 0, len(fs.results))
+
+	// Walk from newest to oldest, keeping each tenant's most recent results
+	// that are younger than its TTL and within its result quota
+	kept := make(map[string]int)
+	for i := len(fs.results) - 1; i >= 0; i-- {
+		result := fs.results[i]
+		quota := fs.TenantQuotaFor(result.Tenant)
+		if now.Sub(result.CreatedAt) >= quota.ResultTTL {
+			fs.metrics.removed.Inc("expired")
+			cleaned++
+			continue
+		}
+		if kept[result.Tenant] >= quota.MaxResults {
+			fs.metrics.removed.Inc("over_limit")
 			cleaned++
+			continue
 		}
+		kept[result.Tenant]++
+		newResults = append(newResults, result)
 	}
+	slices.Reverse(newResults)
 
-	// If still too many results, keep only the most recent ones
-	if len(newResults) > fs.config.MaxResultsInMemory {
-		excess := len(newResults) - fs.config.MaxResultsInMemory
-		newResults = newResults[excess:]
-		cleaned += excess
+	fs.cleanupSnapshots(now)
+	if fs.robots != nil {
+		fs.robots.cleanup(now)
 	}
+	fs.cleanupCrawls(now)
+	fs.cleanupLinkChecks(now)
 
 	if cleaned > 0 {
 		fs.results = newResults
@@ -311,24 +708,10 @@ func (fs *FetchService) cleanupOldResults() {
 		fs.cleanupStats.CleanupCount++
 		fs.cleanupStats.ResultsInMemory = len(fs.results)
 
-		log.Printf("Cleanup: Removed %d old results, %d remaining in memory", cleaned, len(fs.results))
+		slog.Info("Removed old results", "removed", cleaned, "remaining", len(fs.results))
 	}
 }
 
-// ClearAllResults manually clears all results (for testing or admin purposes)
-func (fs *FetchService) ClearAllResults() int {
-	fs.mu.Lock()
-	defer fs.mu.Unlock()
-
-	count := len(fs.results)
-	fs.results = make([]models.FetchResult, 0)
-	fs.cleanupStats.TotalCleaned += count
-	fs.cleanupStats.ResultsInMemory = 0
-
-	log.Printf("Manually cleared all %d results", count)
-	return count
-}
-
 // GetCleanupStats returns cleanup statistics
 func (fs *FetchService) GetCleanupStats() models.CleanupStats {
 	fs.mu.RLock()
@@ -339,6 +722,14 @@ func (fs *FetchService) GetCleanupStats() models.CleanupStats {
 	return stats
 }
 
+// GetCacheSize returns the number of responses in the HTTP cache
+func (fs *FetchService) GetCacheSize() int {
+	if fs.cache == nil {
+		return 0
+	}
+	return fs.cache.len()
+}
+
 // GetRateLimiter returns the rate limiter
 func (fs *FetchService) GetRateLimiter() *ratelimit.RateLimiter {
 	return fs.rateLimiter
@@ -347,5 +738,14 @@ func (fs *FetchService) GetRateLimiter() *ratelimit.RateLimiter {
 // Stop gracefully stops the fetch service
 func (fs *FetchService) Stop() {
 	close(fs.cleanupStopChan)
-	log.Println("Fetch service stopped")
+	close(fs.done)
+	fs.stopSchedules()
+	slog.Info("Fetch service stopped")
+}
+
+// newID returns a random identifier for jobs and schedules
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
 }
@@ -3,12 +3,17 @@ package service
 import (
 	"fetch/cmd/model"
 	"fetch/internal/ratelimit"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
-func createTestService() *FetchService {
-	cfg := Config{
+// testConfig returns the default configuration used by tests
+func testConfig() Config {
+	return Config{
 		FetchTimeout:       5 * time.Second,
 		MaxRedirects:       10,
 		MaxContentSize:     10 * 1024 * 1024,
@@ -16,8 +21,11 @@ func createTestService() *FetchService {
 		CleanupInterval:    10 * time.Minute,
 		MaxResultsInMemory: 10000,
 	}
+}
+
+func createTestService() *FetchService {
 	rateLimiter := ratelimit.NewRateLimiter(100, 20, 1*time.Minute)
-	return NewFetchService(cfg, rateLimiter)
+	return NewFetchService(testConfig(), rateLimiter)
 }
 
 func TestNewFetchService(t *testing.T) {
@@ -66,6 +74,56 @@ func TestSubmitURLs(t *testing.T) {
 	}
 }
 
+func TestFetchURLsWaitsForResults(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	service := createTestService()
+	defer service.Stop()
+
+	response := service.FetchURLs([]string{server.URL + "/a", server.URL + "/b", ""}, FetchOptions{})
+	if response.TotalURLs != 3 || response.SuccessCount != 2 || response.FailedCount != 1 || response.PendingCount != 0 {
+		t.Errorf("expected every fetch to be complete, got %+v", response)
+	}
+}
+
+func TestFetchConcurrency(t *testing.T) {
+	var running, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.FetchConcurrency = 3
+	service := NewFetchService(cfg, ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	urls := make([]string, 12)
+	for i := range urls {
+		urls[i] = fmt.Sprintf("%s/%d", server.URL, i)
+	}
+	response := service.FetchURLs(urls, FetchOptions{})
+	if response.SuccessCount != len(urls) {
+		t.Fatalf("expected %d successful fetches, got %+v", len(urls), response)
+	}
+	if p := peak.Load(); p > 3 {
+		t.Errorf("expected at most 3 fetches at once, got %d", p)
+	}
+}
+
 func TestGetResultsEmpty(t *testing.T) {
 	service := createTestService()
 	defer service.Stop()
@@ -98,7 +156,7 @@ func TestCleanupOldResults(t *testing.T) {
 	recentTime := time.Now().Add(-30 * time.Minute) // Within TTL
 
 	service.mu.Lock()
-	service.results = []models.FetchResult{
+	service.results = []*models.FetchResult{
 		{URL: "https://old1.com", Status: "success", CreatedAt: oldTime},
 		{URL: "https://old2.com", Status: "success", CreatedAt: oldTime},
 		{URL: "https://recent1.com", Status: "success", CreatedAt: recentTime},
@@ -126,6 +184,37 @@ func TestCleanupOldResults(t *testing.T) {
 	}
 }
 
+func TestReconfigure(t *testing.T) {
+	cfg := testConfig()
+	cfg.UserAgent = "startup-agent"
+	service := NewFetchService(cfg, ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	service.mu.Lock()
+	service.results = []*models.FetchResult{
+		{URL: "https://old.com", Status: "success", CreatedAt: time.Now().Add(-30 * time.Minute)},
+	}
+	service.mu.Unlock()
+
+	cfg.ResultTTL = 10 * time.Minute
+	cfg.CleanupInterval = 10 * time.Millisecond
+	cfg.UserAgent = "reloaded-agent"
+	service.Reconfigure(cfg)
+
+	if got := service.config.Load().UserAgent; got != "startup-agent" {
+		t.Errorf("expected the user agent to need a restart, got %q", got)
+	}
+
+	// The cleanup ticker runs at the new interval with the new TTL
+	deadline := time.Now().Add(2 * time.Second)
+	for service.GetResults().TotalURLs != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the result to be cleaned up with the new RESULT_TTL")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 func TestMaxResultsInMemory(t *testing.T) {
 	cfg := Config{
 		FetchTimeout:       5 * time.Second,
@@ -143,7 +232,7 @@ func TestMaxResultsInMemory(t *testing.T) {
 	now := time.Now()
 	service.mu.Lock()
 	for i := 0; i < 150; i++ {
-		service.results = append(service.results, models.FetchResult{
+		service.results = append(service.results, &models.FetchResult{
 			URL:       "https://example.com",
 			Status:    "success",
 			CreatedAt: now,
@@ -167,14 +256,14 @@ func TestMaxResultsInMemory(t *testing.T) {
 	}
 }
 
-func TestClearAllResults(t *testing.T) {
+func TestClearTenantResultsStats(t *testing.T) {
 	service := createTestService()
 	defer service.Stop()
 
 	// Add some results
 	service.mu.Lock()
 	for i := 0; i < 10; i++ {
-		service.results = append(service.results, models.FetchResult{
+		service.results = append(service.results, &models.FetchResult{
 			URL:       "https://example.com",
 			Status:    "success",
 			CreatedAt: time.Now(),
@@ -182,8 +271,8 @@ func TestClearAllResults(t *testing.T) {
 	}
 	service.mu.Unlock()
 
-	// Clear all results
-	count := service.ClearAllResults()
+	// Clear the results submitted without a tenant
+	count := service.ClearTenantResults("")
 
 	if count != 10 {
 		t.Errorf("expected to clear 10 results, got %d", count)
@@ -219,7 +308,7 @@ func TestCreatedAtPreserved(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 
 	// Update the result (simulating a fetch completion)
-	service.updateResult(0, models.FetchResult{
+	service.updateResult(service.results[0], models.FetchResult{
 		URL:           "https://example.com",
 		Status:        "success",
 		Content:       "test",
@@ -246,7 +335,7 @@ func TestCleanupDoesNotRemoveRecentResults(t *testing.T) {
 	now := time.Now()
 	service.mu.Lock()
 	for i := 0; i < 5; i++ {
-		service.results = append(service.results, models.FetchResult{
+		service.results = append(service.results, &models.FetchResult{
 			URL:       "https://example.com",
 			Status:    "success",
 			CreatedAt: now.Add(-time.Duration(i) * time.Minute),
@@ -277,7 +366,7 @@ func TestGetCleanupStats(t *testing.T) {
 	// Add some results
 	service.mu.Lock()
 	for i := 0; i < 3; i++ {
-		service.results = append(service.results, models.FetchResult{
+		service.results = append(service.results, &models.FetchResult{
 			URL:       "https://example.com",
 			Status:    "success",
 			CreatedAt: time.Now(),
@@ -316,7 +405,7 @@ func TestGetResultsStatistics(t *testing.T) {
 	defer service.Stop()
 
 	service.mu.Lock()
-	service.results = []models.FetchResult{
+	service.results = []*models.FetchResult{
 		{URL: "https://example.com", Status: "success", CreatedAt: time.Now()},
 		{URL: "https://google.com", Status: "success", CreatedAt: time.Now()},
 		{URL: "https://failed.com", Status: "failed", CreatedAt: time.Now()},
@@ -0,0 +1,389 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fetch/cmd/model"
+	"fetch/internal/logging"
+	"fetch/internal/tracing"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Link check errors returned to callers
+var (
+	ErrLinkCheckNotFound = errors.New("link check not found")
+	ErrInvalidLinkCheck  = errors.New("invalid link check")
+)
+
+// Defaults used when the corresponding Config fields are unset
+const (
+	defaultLinkCheckMaxLinks    = 1000
+	defaultLinkCheckConcurrency = 10
+	linkCheckMaxPages           = 50 // Pages accepted per link check
+)
+
+// linkOccurrence is a link found on one of the checked pages
+type linkOccurrence struct {
+	link   pageLink
+	source string
+}
+
+// linkOutcome is the result of checking one link target
+type linkOutcome struct {
+	category   string
+	statusCode int
+	method     string
+	finalURL   string
+	err        string
+}
+
+// ValidateLinkCheck checks a link check request and returns it with
+// MaxLinks set, so that it and the pages bound the URLs fetched
+func (fs *FetchService) ValidateLinkCheck(req models.LinkCheckRequest) (models.LinkCheckRequest, error) {
+	maxLinks := fs.config.Load().LinkCheckMaxLinks
+	if maxLinks <= 0 {
+		maxLinks = defaultLinkCheckMaxLinks
+	}
+
+	if len(req.Pages) == 0 {
+		return req, fmt.Errorf("%w: no pages provided", ErrInvalidLinkCheck)
+	}
+	if len(req.Pages) > linkCheckMaxPages {
+		return req, fmt.Errorf("%w: at most %d pages per link check", ErrInvalidLinkCheck, linkCheckMaxPages)
+	}
+	for _, page := range req.Pages {
+		u, err := url.Parse(page)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return req, fmt.Errorf("%w: invalid page URL %q", ErrInvalidLinkCheck, page)
+		}
+	}
+	if req.MaxLinks < 0 || req.MaxLinks > maxLinks {
+		return req, fmt.Errorf("%w: max_links must be between 0 and %d", ErrInvalidLinkCheck, maxLinks)
+	}
+	if req.MaxLinks == 0 {
+		req.MaxLinks = maxLinks
+	}
+	return req, nil
+}
+
+// StartLinkCheck validates a link check request and checks the links of its
+// pages in the background. The pages are stored as results under the job ID.
+func (fs *FetchService) StartLinkCheck(req models.LinkCheckRequest) (models.LinkCheckJob, error) {
+	req, err := fs.ValidateLinkCheck(req)
+	if err != nil {
+		return models.LinkCheckJob{}, err
+	}
+
+	job := &models.LinkCheckJob{
+		JobID:     newID(),
+		Status:    models.JobRunning,
+		Request:   req,
+		Summary:   make(map[string]int),
+		Report:    make(map[string][]models.LinkCheckItem),
+		StartedAt: time.Now(),
+	}
+
+	fs.linkMu.Lock()
+	fs.linkChecks[job.JobID] = job
+	snapshot := copyLinkCheck(job)
+	fs.linkMu.Unlock()
+
+	go fs.runLinkCheck(job)
+
+	slog.InfoContext(logging.WithRequestID(context.Background(), req.RequestID), "Started link check",
+		"job_id", job.JobID, "pages", len(req.Pages))
+	return snapshot, nil
+}
+
+// GetLinkCheck returns the progress, and once completed the report, of a link check
+func (fs *FetchService) GetLinkCheck(jobID string) (models.LinkCheckJob, error) {
+	fs.linkMu.RLock()
+	defer fs.linkMu.RUnlock()
+
+	job, ok := fs.linkChecks[jobID]
+	if !ok {
+		return models.LinkCheckJob{}, ErrLinkCheckNotFound
+	}
+	return copyLinkCheck(job), nil
+}
+
+// copyLinkCheck copies a job so callers never share its maps and slices
+func copyLinkCheck(job *models.LinkCheckJob) models.LinkCheckJob {
+	c := *job
+	c.Summary = make(map[string]int, len(job.Summary))
+	for k, v := range job.Summary {
+		c.Summary[k] = v
+	}
+	c.Report = make(map[string][]models.LinkCheckItem, len(job.Report))
+	for k, v := range job.Report {
+		c.Report[k] = append([]models.LinkCheckItem(nil), v...)
+	}
+	c.PageErrors = append([]models.LinkCheckItem(nil), job.PageErrors...)
+	return c
+}
+
+// runLinkCheck fetches the pages, checks every distinct link target once
+// and builds the report from all link occurrences
+func (fs *FetchService) runLinkCheck(job *models.LinkCheckJob) {
+	// The whole link check runs with the settings it started with
+	cfg := fs.config.Load()
+	ctx, span := cfg.Tracer.Start(tracing.ContextWithTraceparent(context.Background(), job.Request.Traceparent),
+		"link check", tracing.KindInternal,
+		tracing.String("job_id", job.JobID),
+		tracing.Int("pages", len(job.Request.Pages)))
+	opts := FetchOptions{Tenant: job.Request.Tenant, RequestID: job.Request.RequestID, Traceparent: span.SpanContext().Traceparent()}
+
+	maxLinks := job.Request.MaxLinks
+	concurrency := cfg.LinkCheckConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultLinkCheckConcurrency
+	}
+
+	var (
+		occurrences []linkOccurrence
+		targets     []string           // Distinct targets in discovery order
+		keys        = map[string]int{} // Normalized URL -> index in targets
+	)
+	for _, page := range job.Request.Pages {
+		links, pageErr := fs.linkCheckPage(job, page, opts)
+
+		fs.linkMu.Lock()
+		job.PagesFetched++
+		if pageErr != nil {
+			job.PageErrors = append(job.PageErrors, *pageErr)
+		}
+		fs.linkMu.Unlock()
+
+		for _, link := range links {
+			key := normalizeURL(link.URL, cfg.DedupSortQuery)
+			if _, ok := keys[key]; !ok {
+				if len(targets) >= maxLinks {
+					continue
+				}
+				keys[key] = len(targets)
+				targets = append(targets, link.URL)
+			}
+			occurrences = append(occurrences, linkOccurrence{link: link, source: page})
+		}
+	}
+
+	fs.linkMu.Lock()
+	job.LinksFound = len(targets)
+	fs.linkMu.Unlock()
+
+	outcomes := make([]linkOutcome, len(targets))
+	checked := make([]bool, len(targets))
+	status := models.JobCompleted
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+targets:
+	for i, target := range targets {
+		select {
+		case <-fs.done:
+			status = models.JobCancelled
+			break targets
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(i int, target string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			outcomes[i] = fs.checkLink(ctx, target)
+			checked[i] = true
+
+			fs.linkMu.Lock()
+			job.LinksChecked++
+			fs.linkMu.Unlock()
+		}(i, target)
+	}
+	wg.Wait()
+
+	fs.linkMu.Lock()
+	defer fs.linkMu.Unlock()
+
+	for _, occ := range occurrences {
+		i := keys[normalizeURL(occ.link.URL, cfg.DedupSortQuery)]
+		if !checked[i] {
+			continue
+		}
+		out := outcomes[i]
+		job.Summary[out.category]++
+		job.Report[out.category] = append(job.Report[out.category], models.LinkCheckItem{
+			URL:        occ.link.URL,
+			SourcePage: occ.source,
+			AnchorText: occ.link.Text,
+			Tag:        occ.link.Tag,
+			Category:   out.category,
+			StatusCode: out.statusCode,
+			Method:     out.method,
+			FinalURL:   out.finalURL,
+			Error:      out.err,
+		})
+	}
+	job.Status = status
+	job.FinishedAt = time.Now()
+
+	span.SetAttributes(tracing.String("link_check.status", status), tracing.Int("link_check.links", job.LinksChecked))
+	span.End()
+
+	slog.InfoContext(logging.WithRequestID(context.Background(), job.Request.RequestID), "Link check finished",
+		"job_id", job.JobID,
+		"status", status,
+		"links_checked", job.LinksChecked,
+		"pages", job.PagesFetched,
+		"links_ok", job.Summary[models.LinkOK])
+}
+
+// linkCheckPage fetches a page into a result with opts and returns its
+// links, or a report item when the page itself could not be fetched
+func (fs *FetchService) linkCheckPage(job *models.LinkCheckJob, page string, opts FetchOptions) ([]pageLink, *models.LinkCheckItem) {
+	record := fs.addResult(models.FetchResult{
+		URL:       page,
+		Status:    "pending",
+		CreatedAt: time.Now(),
+		JobID:     job.JobID,
+		Tenant:    job.Request.Tenant,
+		RequestID: job.Request.RequestID,
+	})
+
+	result := fs.fetchShared(page, opts)
+	fs.updateResult(record, result)
+
+	switch {
+	case result.Status != "success":
+		return nil, &models.LinkCheckItem{URL: page, SourcePage: page, Category: models.LinkError, Error: result.Error}
+	case result.StatusCode >= 400:
+		return nil, &models.LinkCheckItem{URL: page, SourcePage: page, Category: statusCategory(result.StatusCode, false), StatusCode: result.StatusCode}
+	case !isHTML(result.ContentType):
+		return nil, &models.LinkCheckItem{URL: page, SourcePage: page, Category: models.LinkError, StatusCode: result.StatusCode,
+			Error: fmt.Sprintf("not an HTML page (content type %q)", result.ContentType)}
+	}
+
+	base, err := url.Parse(result.FinalURL)
+	if err != nil || result.FinalURL == "" {
+		if base, err = url.Parse(page); err != nil {
+			return nil, nil
+		}
+	}
+	return extractLinks(result.Content, base), nil
+}
+
+// checkLink checks a link target with HEAD, falling back to GET for servers
+// that reject or mishandle HEAD requests. Requests are traced as children
+// of the span in ctx.
+func (fs *FetchService) checkLink(ctx context.Context, target string) linkOutcome {
+	if err := fs.checkRobots(ctx, target); err != nil {
+		return linkOutcome{category: models.LinkError, err: fmt.Sprintf("Not checked: %v", err)}
+	}
+
+	out := fs.probeLink(ctx, http.MethodHead, target)
+	switch out.category {
+	case models.LinkOK, models.LinkRedirect, models.LinkTimeout, models.LinkDNSFailure:
+		return out
+	}
+	return fs.probeLink(ctx, http.MethodGet, target)
+}
+
+// probeLink requests target with method, following redirects, and
+// categorizes the outcome. Like fetches, probes use the settings of the
+// target's domain and wait for its egress rate limit.
+func (fs *FetchService) probeLink(ctx context.Context, method, target string) linkOutcome {
+	settings := fs.settingsFor(hostname(target))
+
+	out := linkOutcome{method: method}
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		out.category, out.err = models.LinkError, err.Error()
+		return out
+	}
+	req.Header.Set("User-Agent", settings.userAgent)
+	for name, value := range settings.headers {
+		req.Header.Set(name, value)
+	}
+
+	// Waiting for the egress rate limit doesn't count toward the timeout
+	if _, err := fs.waitForHost(ctx, req.URL); err != nil {
+		out.category, out.err = models.LinkError, fmt.Sprintf("Not checked: %v", err)
+		return out
+	}
+	ctx, cancel := context.WithTimeout(ctx, settings.timeout)
+	defer cancel()
+	req = req.WithContext(ctx)
+
+	redirectCount := 0
+	client := &http.Client{
+		Transport: fs.httpClient.Transport,
+		Timeout:   settings.timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			redirectCount = len(via)
+			if redirectCount >= settings.maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", settings.maxRedirects)
+			}
+			_, err := fs.prepareRedirect(req, settings)
+			return err
+		},
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		out.category, out.err = errorCategory(err), err.Error()
+		return out
+	}
+	resp.Body.Close()
+
+	out.statusCode = resp.StatusCode
+	out.category = statusCategory(resp.StatusCode, redirectCount > 0)
+	if redirectCount > 0 {
+		out.finalURL = resp.Request.URL.String()
+	}
+	return out
+}
+
+// statusCategory maps a final HTTP status code to a link check category
+func statusCategory(statusCode int, redirected bool) string {
+	switch {
+	case statusCode >= 500:
+		return models.Link5xx
+	case statusCode >= 400:
+		return models.Link4xx
+	case statusCode >= 300 || redirected:
+		return models.LinkRedirect
+	default:
+		return models.LinkOK
+	}
+}
+
+// errorCategory maps a request error to a link check category
+func errorCategory(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &dnsErr):
+		return models.LinkDNSFailure
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return models.LinkTimeout
+	default:
+		return models.LinkError
+	}
+}
+
+// cleanupLinkChecks drops finished link checks older than ResultTTL
+func (fs *FetchService) cleanupLinkChecks(now time.Time) {
+	fs.linkMu.Lock()
+	defer fs.linkMu.Unlock()
+
+	for id, job := range fs.linkChecks {
+		if job.Status != models.JobRunning && now.Sub(job.FinishedAt) >= fs.config.Load().ResultTTL {
+			delete(fs.linkChecks, id)
+		}
+	}
+}
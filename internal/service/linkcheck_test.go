@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fetch/cmd/model"
+	"fetch/internal/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newLinkCheckTestSite() *httptest.Server {
+	return newTestSite(map[string]http.HandlerFunc{
+		"/": htmlPage(`<html><body>
+			<a href="/ok">Working</a>
+			<a href="/ok#section">Working again</a>
+			<a href="/moved">Moved</a>
+			<a href="/missing">Gone <em>page</em></a>
+			<a href="/broken">Broken</a>
+			<a href="/no-head">No HEAD</a>
+			<a href="/slow">Slow</a>
+			<img src="/missing.png">
+			<a href="http://nonexistent.invalid/">Nowhere</a>
+		</body></html>`),
+		"/ok": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		},
+		"/moved": func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/ok", http.StatusMovedPermanently)
+		},
+		"/broken": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		},
+		"/no-head": func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Write([]byte("ok"))
+		},
+		"/slow": func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(500 * time.Millisecond)
+		},
+	})
+}
+
+func waitForLinkCheck(t *testing.T, service *FetchService, jobID string) models.LinkCheckJob {
+	t.Helper()
+	var job models.LinkCheckJob
+	waitForJob(t, func() (status string, err error) {
+		job, err = service.GetLinkCheck(jobID)
+		return job.Status, err
+	})
+	return job
+}
+
+func TestLinkCheckReport(t *testing.T) {
+	server := newLinkCheckTestSite()
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.FetchTimeout = 200 * time.Millisecond
+	service := NewFetchService(cfg, ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	job, err := service.StartLinkCheck(models.LinkCheckRequest{Pages: []string{server.URL + "/"}})
+	if err != nil {
+		t.Fatalf("StartLinkCheck failed: %v", err)
+	}
+	job = waitForLinkCheck(t, service, job.JobID)
+
+	if job.Status != models.JobCompleted || job.PagesFetched != 1 {
+		t.Fatalf("expected completed check of 1 page, got %+v", job)
+	}
+	// /ok and /ok#section share a target
+	if job.LinksFound != 8 || job.LinksChecked != 8 {
+		t.Errorf("expected 8 distinct links found and checked, got %d and %d", job.LinksFound, job.LinksChecked)
+	}
+
+	expected := map[string]int{
+		models.LinkOK:         3, // /ok twice, /no-head
+		models.LinkRedirect:   1,
+		models.Link4xx:        2,
+		models.Link5xx:        1,
+		models.LinkTimeout:    1,
+		models.LinkDNSFailure: 1,
+	}
+	for category, count := range expected {
+		if job.Summary[category] != count || len(job.Report[category]) != count {
+			t.Errorf("%s: expected %d links, got summary %d, report %+v", category, count, job.Summary[category], job.Report[category])
+		}
+	}
+
+	for _, item := range job.Report[models.Link4xx] {
+		if item.SourcePage != server.URL+"/" || item.StatusCode != http.StatusNotFound {
+			t.Errorf("unexpected 4xx item %+v", item)
+		}
+		if item.URL == server.URL+"/missing" && item.AnchorText != "Gone page" {
+			t.Errorf("expected anchor text %q, got %q", "Gone page", item.AnchorText)
+		}
+	}
+	if redirect := job.Report[models.LinkRedirect]; len(redirect) == 1 && redirect[0].FinalURL != server.URL+"/ok" {
+		t.Errorf("expected redirect to resolve to /ok, got %+v", redirect[0])
+	}
+	for _, item := range job.Report[models.LinkOK] {
+		if item.URL == server.URL+"/no-head" && item.Method != http.MethodGet {
+			t.Errorf("expected GET fallback for /no-head, got method %q", item.Method)
+		}
+	}
+
+	// The checked page is stored as a result of the job
+	if results := service.GetJobResults(job.JobID); results.TotalURLs != 1 {
+		t.Errorf("expected 1 page result for the job, got %d", results.TotalURLs)
+	}
+}
+
+func TestProbeLinkUsesDomainSettings(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		headers []http.Header
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers = append(headers, r.Header.Clone())
+		mu.Unlock()
+		if r.URL.Path == "/slow" {
+			time.Sleep(500 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	// One request per 200ms, which probes wait for outside their 150ms timeout
+	egress, err := ratelimit.NewHostLimiter(ratelimit.HostLimit{Rate: 5, Window: time.Second, Burst: 1}, nil, time.Second)
+	if err != nil {
+		t.Fatalf("NewHostLimiter failed: %v", err)
+	}
+	cfg := testConfig()
+	cfg.Egress = egress
+	cfg.Domains = map[string]DomainSettings{
+		"127.0.0.1": {
+			FetchTimeout: 150 * time.Millisecond,
+			UserAgent:    "custom-agent",
+			Headers:      map[string]string{"X-Api-Token": "secret"},
+		},
+	}
+	service := NewFetchService(cfg, ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	for range 2 {
+		if out := service.probeLink(context.Background(), http.MethodHead, server.URL+"/ok"); out.category != models.LinkOK {
+			t.Errorf("expected ok, got %+v", out)
+		}
+	}
+	if out := service.probeLink(context.Background(), http.MethodHead, server.URL+"/slow"); out.category != models.LinkTimeout {
+		t.Errorf("expected the domain's timeout to apply, got %+v", out)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i, h := range headers {
+		if h.Get("User-Agent") != "custom-agent" || h.Get("X-Api-Token") != "secret" {
+			t.Errorf("request %d: expected the domain's headers, got %v", i+1, h)
+		}
+	}
+}
+
+func TestLinkCheckPageErrors(t *testing.T) {
+	server := newLinkCheckTestSite()
+	defer server.Close()
+
+	service := NewFetchService(testConfig(), ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	job, err := service.StartLinkCheck(models.LinkCheckRequest{Pages: []string{server.URL + "/missing", server.URL + "/ok"}})
+	if err != nil {
+		t.Fatalf("StartLinkCheck failed: %v", err)
+	}
+	job = waitForLinkCheck(t, service, job.JobID)
+
+	if len(job.PageErrors) != 2 || job.LinksFound != 0 {
+		t.Fatalf("expected 2 page errors and no links, got %+v", job)
+	}
+	if job.PageErrors[0].Category != models.Link4xx || job.PageErrors[1].Category != models.LinkError {
+		t.Errorf("expected 4xx and non-HTML page errors, got %+v", job.PageErrors)
+	}
+}
+
+func TestLinkCheckInvalid(t *testing.T) {
+	service := NewFetchService(testConfig(), ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	for _, req := range []models.LinkCheckRequest{
+		{},
+		{Pages: []string{"ftp://example.com/"}},
+	} {
+		if _, err := service.StartLinkCheck(req); !errors.Is(err, ErrInvalidLinkCheck) {
+			t.Errorf("expected ErrInvalidLinkCheck for %+v, got %v", req, err)
+		}
+	}
+
+	if _, err := service.GetLinkCheck("unknown"); !errors.Is(err, ErrLinkCheckNotFound) {
+		t.Errorf("expected ErrLinkCheckNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// pageLink is a link found in an HTML document
+type pageLink struct {
+	URL  string // Absolute URL without fragment
+	Tag  string // Lower-cased tag name, e.g. "a" or "img"
+	Text string // Anchor text for <a> tags
+}
+
+var (
+	// linkTagPattern matches opening tags that reference other resources
+	linkTagPattern = regexp.MustCompile(`(?is)<(a|area|base|link|img|script|iframe|frame|source|embed|video|audio)\b([^>]*)>`)
+	// attrPattern matches a single attribute with a quoted or bare value
+	attrPattern = regexp.MustCompile(`(?is)([a-z][a-z0-9_:-]*)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	// anchorEndPattern matches the closing tag of an anchor
+	anchorEndPattern = regexp.MustCompile(`(?i)</a\s*>`)
+	// tagPattern matches any tag, used to strip markup from anchor text
+	tagPattern = regexp.MustCompile(`(?s)<[^>]*>`)
+	// commentPattern matches HTML comments, which are skipped
+	commentPattern = regexp.MustCompile(`(?s)<!--.*?-->`)
+)
+
+// isHTML reports whether a Content-Type header denotes an HTML document
+func isHTML(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	return strings.HasPrefix(contentType, "text/html") || strings.HasPrefix(contentType, "application/xhtml+xml")
+}
+
+// extractLinks returns the http(s) links referenced by href and src
+// attributes in body, resolved against base (or a <base href> in the page)
+func extractLinks(body string, base *url.URL) []pageLink {
+	body = commentPattern.ReplaceAllString(body, "")
+
+	var links []pageLink
+	for _, match := range linkTagPattern.FindAllStringSubmatchIndex(body, -1) {
+		tag := strings.ToLower(body[match[2]:match[3]])
+		attrs := parseAttributes(body[match[4]:match[5]])
+
+		ref, ok := attrs["href"]
+		if !ok {
+			ref, ok = attrs["src"]
+		}
+		if !ok {
+			continue
+		}
+
+		if tag == "base" {
+			if u, err := base.Parse(ref); err == nil {
+				base = u
+			}
+			continue
+		}
+
+		abs := resolveLink(base, ref)
+		if abs == "" {
+			continue
+		}
+
+		link := pageLink{URL: abs, Tag: tag}
+		if tag == "a" {
+			rest := body[match[1]:]
+			if end := anchorEndPattern.FindStringIndex(rest); end != nil {
+				text := tagPattern.ReplaceAllString(rest[:end[0]], " ")
+				link.Text = strings.Join(strings.Fields(html.UnescapeString(text)), " ")
+			}
+		}
+		links = append(links, link)
+	}
+
+	return links
+}
+
+// parseAttributes parses tag attributes into a lower-cased name -> value map
+func parseAttributes(s string) map[string]string {
+	attrs := make(map[string]string)
+	for _, m := range attrPattern.FindAllStringSubmatch(s, -1) {
+		name := strings.ToLower(m[1])
+		if _, seen := attrs[name]; seen {
+			continue
+		}
+		value := m[2] + m[3] + m[4]
+		attrs[name] = strings.TrimSpace(html.UnescapeString(value))
+	}
+	return attrs
+}
+
+// resolveLink turns ref into an absolute http(s) URL without fragment,
+// returning "" for empty, fragment-only and non-http references
+func resolveLink(base *url.URL, ref string) string {
+	if ref == "" || strings.HasPrefix(ref, "#") {
+		return ""
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String()
+}
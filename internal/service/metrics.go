@@ -0,0 +1,123 @@
+package service
+
+import (
+	"fetch/cmd/model"
+	"fetch/internal/metrics"
+	"strconv"
+	"time"
+)
+
+// Error kinds of failed fetches, as reported in metrics. Failures with a
+// FailureReason are reported by that reason.
+const (
+	errKindNone       = "none"
+	errKindInvalidURL = "invalid_url"
+	errKindCacheMiss  = "cache_miss"
+	errKindTimeout    = "timeout"
+	errKindDNS        = "dns_failure"
+	errKindConnection = "connection"
+	errKindRead       = "read_error"
+	errKindTooLarge   = "too_large"
+)
+
+// serviceMetrics are the metrics recorded by the fetch service
+type serviceMetrics struct {
+	fetches  *metrics.Counter   // By status, status code class and error kind
+	duration *metrics.Histogram // Seconds per fetch
+	size     *metrics.Histogram // Body bytes per successful fetch
+	removed  *metrics.Counter   // Results removed, by reason
+}
+
+// registerMetrics creates the service's metrics and the gauges read from
+// its state
+func (fs *FetchService) registerMetrics() {
+	r := fs.registry
+	fs.metrics = serviceMetrics{
+		fetches: r.NewCounter("fetch_fetches_total",
+			"Completed fetches by status, status code class and error kind.",
+			"status", "code_class", "error"),
+		duration: r.NewHistogram("fetch_duration_seconds",
+			"Time taken by fetches, including rate limit waits.",
+			[]float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}),
+		size: r.NewHistogram("fetch_response_size_bytes",
+			"Body size of successfully fetched responses.",
+			metrics.ExponentialBuckets(256, 4, 9)),
+		removed: r.NewCounter("fetch_cleanup_removed_total",
+			"Results removed from memory, by reason.",
+			"reason"),
+	}
+
+	r.NewGaugeFunc("fetch_queue_depth", "Submitted URLs whose fetch hasn't completed.", nil,
+		func() float64 { return float64(fs.pendingCount()) })
+	r.NewGaugeFunc("fetch_in_flight", "Fetches currently running.", nil,
+		func() float64 { return float64(fs.activeFetches.Load()) })
+	r.NewGaugeFunc("fetch_results_in_memory", "Results held in memory.", nil,
+		func() float64 { return float64(fs.GetCleanupStats().ResultsInMemory) })
+	if fs.rateLimiter != nil {
+		r.NewGaugeFunc("fetch_rate_limit_active_keys", "Callers tracked by a rate limiter.",
+			metrics.Labels{"limiter": "requests"},
+			func() float64 { return float64(fs.rateLimiter.Len()) })
+	}
+}
+
+// Metrics returns the registry holding the service's metrics, to which
+// other components add their own
+func (fs *FetchService) Metrics() *metrics.Registry {
+	return fs.registry
+}
+
+// recordFetch records a completed fetch
+func (fs *FetchService) recordFetch(result models.FetchResult, errKind string, elapsed time.Duration) {
+	if result.Status == models.StatusSuccess {
+		fs.metrics.size.Observe(float64(result.ContentLength))
+	}
+	fs.metrics.fetches.Inc(result.Status, statusCodeClass(result.StatusCode), fetchErrorKind(result, errKind))
+	fs.metrics.duration.Observe(elapsed.Seconds())
+}
+
+// fetchErrorKind returns the error kind reported for a completed fetch:
+// errKindNone on success, otherwise the failure reason if any or errKind
+func fetchErrorKind(result models.FetchResult, errKind string) string {
+	switch {
+	case result.Status == models.StatusSuccess:
+		return errKindNone
+	case result.FailureReason != "":
+		return result.FailureReason
+	}
+	return errKind
+}
+
+// pendingCount returns the number of results still being fetched
+func (fs *FetchService) pendingCount() int {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	count := 0
+	for _, result := range fs.results {
+		if result.Status == models.StatusPending {
+			count++
+		}
+	}
+	return count
+}
+
+// networkErrorKind classifies an error of the HTTP request itself
+func networkErrorKind(err error) string {
+	switch errorCategory(err) {
+	case models.LinkTimeout:
+		return errKindTimeout
+	case models.LinkDNSFailure:
+		return errKindDNS
+	default:
+		return errKindConnection
+	}
+}
+
+// statusCodeClass returns a status code's class, e.g. "2xx", or "none"
+// when no response was received
+func statusCodeClass(code int) string {
+	if code < 100 || code > 599 {
+		return "none"
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"fetch/cmd/model"
+	"fetch/internal/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("page"))
+	}))
+	defer server.Close()
+
+	service := NewFetchService(testConfig(), ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	service.fetch(server.URL+"/", FetchOptions{})
+	service.fetch(server.URL+"/missing", FetchOptions{})
+	service.fetch("", FetchOptions{})
+	service.fetch("http://127.0.0.1:1/", FetchOptions{})
+
+	m := service.metrics
+	for _, labels := range [][]string{
+		{"success", "2xx", "none"},
+		{"success", "4xx", "none"},
+		{"failed", "none", errKindInvalidURL},
+		{"failed", "none", errKindConnection},
+	} {
+		if v := m.fetches.Value(labels...); v != 1 {
+			t.Errorf("expected 1 fetch with labels %v, got %v", labels, v)
+		}
+	}
+	if count := m.duration.Count(); count != 4 {
+		t.Errorf("expected 4 observed durations, got %d", count)
+	}
+	if count := m.size.Count(); count != 2 {
+		t.Errorf("expected 2 observed body sizes, got %d", count)
+	}
+
+	service.addResult(models.FetchResult{URL: server.URL + "/queued", Status: models.StatusPending, CreatedAt: time.Now()})
+	var out strings.Builder
+	if err := service.Metrics().WriteText(&out); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	for _, line := range []string{
+		"fetch_in_flight 0\n",
+		"fetch_queue_depth 1\n",
+		"fetch_results_in_memory 1\n",
+		`fetch_rate_limit_active_keys{limiter="requests"} 0` + "\n",
+		`fetch_fetches_total{status="success",code_class="2xx",error="none"} 1` + "\n",
+		"fetch_duration_seconds_count 4\n",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("expected %q in metrics:\n%s", line, out.String())
+		}
+	}
+
+	service.ClearTenantResults("")
+	if v := m.removed.Value("cleared"); v != 1 {
+		t.Errorf("expected 1 cleared result, got %v", v)
+	}
+}
+
+func TestCleanupMetrics(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxResultsInMemory = 1
+	service := NewFetchService(cfg, ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	now := time.Now()
+	service.mu.Lock()
+	service.results = []*models.FetchResult{
+		{URL: "https://old.com", Status: "success", CreatedAt: now.Add(-2 * time.Hour)},
+		{URL: "https://recent1.com", Status: "success", CreatedAt: now.Add(-time.Minute)},
+		{URL: "https://recent2.com", Status: "success", CreatedAt: now},
+	}
+	service.mu.Unlock()
+
+	service.cleanupOldResults()
+	if v := service.metrics.removed.Value("expired"); v != 1 {
+		t.Errorf("expected 1 expired result, got %v", v)
+	}
+	if v := service.metrics.removed.Value("over_limit"); v != 1 {
+		t.Errorf("expected 1 result over the limit, got %v", v)
+	}
+}
@@ -0,0 +1,367 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// robots.txt limits
+const (
+	robotsMaxSize       = 512 * 1024 // Bytes of robots.txt parsed, per RFC 9309
+	robotsMaxCrawlDelay = time.Minute
+)
+
+// errBlockedByRobots is returned when robots.txt disallows a URL
+var errBlockedByRobots = errors.New("disallowed by robots.txt")
+
+// robotsRule is a single Allow or Disallow line
+type robotsRule struct {
+	allow   bool
+	length  int            // Length of the original pattern, for longest-match precedence
+	pattern *regexp.Regexp // nil for an empty pattern
+}
+
+// newRobotsRule compiles a robots.txt path pattern supporting the "*"
+// wildcard and the "$" end anchor
+func newRobotsRule(allow bool, pattern string) robotsRule {
+	rule := robotsRule{allow: allow, length: len(pattern)}
+	if pattern == "" {
+		return rule
+	}
+
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+	rule.pattern = regexp.MustCompile(expr)
+	return rule
+}
+
+// robotsRules are the rules of the group that applies to our user agent
+type robotsRules struct {
+	rules       []robotsRule
+	crawlDelay  time.Duration
+	disallowAll bool // robots.txt could not be retrieved
+}
+
+// allowed reports whether path (including any query) may be fetched.
+// The longest matching rule wins; Allow wins ties.
+func (r *robotsRules) allowed(path string) bool {
+	if r.disallowAll {
+		return false
+	}
+
+	bestLen, allow := -1, true
+	for _, rule := range r.rules {
+		// An empty Disallow allows everything and never wins over another rule
+		if rule.pattern == nil || !rule.pattern.MatchString(path) {
+			continue
+		}
+		if rule.length > bestLen || (rule.length == bestLen && rule.allow) {
+			bestLen, allow = rule.length, rule.allow
+		}
+	}
+	return allow
+}
+
+// robotsProductToken returns the lowercased product token of a User-agent
+// value or header: its leading letters, digits, "-" and "_", so
+// "URL-Fetch-Service/1.0" becomes "url-fetch-service"
+func robotsProductToken(value string) string {
+	end := strings.IndexFunc(value, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_')
+	})
+	if end >= 0 {
+		value = value[:end]
+	}
+	return strings.ToLower(value)
+}
+
+// robotsAgentMatch returns how specifically a User-agent product token ua
+// names agent: its length when it is agent or a "-"-separated prefix of it,
+// so that "googlebot" also covers "googlebot-news", and -1 otherwise
+func robotsAgentMatch(agent, ua string) int {
+	if ua == "" || (ua != agent && !strings.HasPrefix(agent, ua+"-")) {
+		return -1
+	}
+	return len(ua)
+}
+
+// parseRobots extracts the rules applying to agent (a product token such as
+// "URL-Fetch-Service"). Product tokens match case-insensitively; the groups
+// naming the agent most specifically apply, combined, and "*" otherwise.
+func parseRobots(r io.Reader, agent string) *robotsRules {
+	agent = robotsProductToken(agent)
+
+	var (
+		specific, wildcard robotsRules
+		specificLen        = -1 // Length of the token naming specific's groups
+		groupAgents        []string
+		inRules            bool
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		if key == "user-agent" {
+			// A user-agent line after rules starts a new group
+			if inRules {
+				groupAgents = nil
+				inRules = false
+			}
+			if value != "*" {
+				value = robotsProductToken(value)
+			}
+			groupAgents = append(groupAgents, value)
+			continue
+		}
+
+		var targets []*robotsRules
+		matchLen := -1
+		for _, ua := range groupAgents {
+			if ua == "*" {
+				targets = append(targets, &wildcard)
+				continue
+			}
+			matchLen = max(matchLen, robotsAgentMatch(agent, ua))
+		}
+		if matchLen >= 0 && matchLen >= specificLen {
+			// A more specific group replaces the rules found so far
+			if matchLen > specificLen {
+				specific, specificLen = robotsRules{}, matchLen
+			}
+			targets = append(targets, &specific)
+		}
+
+		switch key {
+		case "allow", "disallow":
+			inRules = true
+			for _, t := range targets {
+				t.rules = append(t.rules, newRobotsRule(key == "allow", value))
+			}
+		case "crawl-delay":
+			inRules = true
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil || seconds < 0 {
+				continue
+			}
+			for _, t := range targets {
+				t.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+
+	rules := wildcard
+	if specificLen >= 0 {
+		rules = specific
+	}
+	if rules.crawlDelay > robotsMaxCrawlDelay {
+		rules.crawlDelay = robotsMaxCrawlDelay
+	}
+	return &rules
+}
+
+// robotsEntry is the cached robots.txt state of one origin
+type robotsEntry struct {
+	ready     chan struct{} // Closed once rules are loaded
+	rules     *robotsRules
+	expiresAt time.Time
+	nextFetch time.Time // Earliest time the next fetch may start, for Crawl-delay
+}
+
+// robotsCache fetches and caches robots.txt per origin
+type robotsCache struct {
+	mu      sync.Mutex
+	entries map[string]*robotsEntry // scheme://host -> entry
+	client  *http.Client
+	agent   string // Full User-Agent header
+	token   string // Product token matched against User-agent lines
+	ttl     time.Duration
+}
+
+// newRobotsCache creates a robots.txt cache for the given User-Agent
+func newRobotsCache(client *http.Client, userAgent string, ttl time.Duration) *robotsCache {
+	return &robotsCache{
+		entries: make(map[string]*robotsEntry),
+		client:  client,
+		agent:   userAgent,
+		token:   robotsProductToken(userAgent),
+		ttl:     ttl,
+	}
+}
+
+// entry returns the loaded robots.txt state for the origin of u
+func (c *robotsCache) entry(u *url.URL) *robotsEntry {
+	origin := u.Scheme + "://" + u.Host
+
+	c.mu.Lock()
+	e, ok := c.entries[origin]
+	if ok && (e.expiresAt.IsZero() || time.Now().Before(e.expiresAt)) {
+		c.mu.Unlock()
+		<-e.ready
+		return e
+	}
+
+	// Load (or reload) robots.txt; concurrent callers wait for this load
+	fresh := &robotsEntry{ready: make(chan struct{})}
+	if ok {
+		fresh.nextFetch = e.nextFetch
+	}
+	c.entries[origin] = fresh
+	c.mu.Unlock()
+
+	rules := c.load(origin)
+
+	c.mu.Lock()
+	fresh.rules = rules
+	fresh.expiresAt = time.Now().Add(c.ttl)
+	c.mu.Unlock()
+	close(fresh.ready)
+
+	return fresh
+}
+
+// load retrieves and parses robots.txt for an origin. Following RFC 9309,
+// a 4xx response allows everything and an unreachable file disallows everything.
+func (c *robotsCache) load(origin string) *robotsRules {
+	ctx, cancel := context.WithTimeout(context.Background(), c.client.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", origin+"/robots.txt", nil)
+	if err != nil {
+		return &robotsRules{disallowAll: true}
+	}
+	req.Header.Set("User-Agent", c.agent)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		slog.Warn("Failed to fetch robots.txt, disallowing all", "origin", origin, "error", err)
+		return &robotsRules{disallowAll: true}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return parseRobots(io.LimitReader(resp.Body, robotsMaxSize), c.token)
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return &robotsRules{}
+	default:
+		slog.Warn("robots.txt unavailable, disallowing all", "origin", origin, "status_code", resp.StatusCode)
+		return &robotsRules{disallowAll: true}
+	}
+}
+
+// check returns errBlockedByRobots if u is disallowed. Otherwise it waits
+// until the origin's Crawl-delay allows another request, or ctx ends.
+func (c *robotsCache) check(ctx context.Context, u *url.URL) error {
+	// robots.txt itself is always allowed
+	if u.Path == "/robots.txt" {
+		return nil
+	}
+
+	e := c.entry(u)
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	if !e.rules.allowed(path) {
+		return errBlockedByRobots
+	}
+
+	if e.rules.crawlDelay <= 0 {
+		return nil
+	}
+
+	// Reserve the next slot for this origin
+	c.mu.Lock()
+	now := time.Now()
+	previous := e.nextFetch
+	start := previous
+	if start.Before(now) {
+		start = now
+	}
+	reserved := start.Add(e.rules.crawlDelay)
+	e.nextFetch = reserved
+	c.mu.Unlock()
+
+	if wait := start.Sub(now); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			// Give the slot back unless a later request has reserved the
+			// one after it
+			c.mu.Lock()
+			if e.nextFetch.Equal(reserved) {
+				e.nextFetch = previous
+			}
+			c.mu.Unlock()
+			return fmt.Errorf("waiting for crawl delay: %w", ctx.Err())
+		}
+	}
+	return nil
+}
+
+// cleanup removes entries that have expired and whose Crawl-delay no longer
+// holds back a fetch, so origins fetched once don't stay cached forever
+func (c *robotsCache) cleanup(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for origin, e := range c.entries {
+		if !e.expiresAt.IsZero() && now.After(e.expiresAt) && now.After(e.nextFetch) {
+			delete(c.entries, origin)
+		}
+	}
+}
+
+// len returns the number of cached origins
+func (c *robotsCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// checkRobots applies robots.txt to rawURL when robots compliance is enabled
+func (fs *FetchService) checkRobots(ctx context.Context, rawURL string) error {
+	if fs.robots == nil {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		// Invalid URLs fail later with a regular fetch error
+		return nil
+	}
+	return fs.robots.check(ctx, u)
+}
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fetch/cmd/model"
+	"fetch/internal/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testRobotsTxt = `
+# Rules for everyone
+User-agent: *
+Disallow: /private/
+Allow: /private/public-*.html$
+Disallow: /*.pdf$
+
+User-agent: OtherBot
+User-agent: URL-Fetch-Service
+Disallow: /no-fetch-service
+Crawl-delay: 0.5
+
+User-agent: BadBot
+Disallow: /
+`
+
+func TestParseRobotsWildcardGroup(t *testing.T) {
+	rules := parseRobots(strings.NewReader(testRobotsTxt), "SomeCrawler")
+
+	tests := []struct {
+		path    string
+		allowed bool
+	}{
+		{"/", true},
+		{"/private/secret", false},
+		{"/private/public-page.html", true},
+		{"/private/public-page.html?x=1", false},
+		{"/docs/manual.pdf", false},
+		{"/docs/manual.pdf?download=1", true},
+		{"/no-fetch-service", true},
+	}
+
+	for _, tt := range tests {
+		if got := rules.allowed(tt.path); got != tt.allowed {
+			t.Errorf("allowed(%q) = %t, expected %t", tt.path, got, tt.allowed)
+		}
+	}
+	if rules.crawlDelay != 0 {
+		t.Errorf("expected no crawl delay, got %v", rules.crawlDelay)
+	}
+}
+
+func TestParseRobotsSpecificGroup(t *testing.T) {
+	rules := parseRobots(strings.NewReader(testRobotsTxt), "URL-Fetch-Service")
+
+	// The specific group replaces the wildcard group entirely
+	if rules.allowed("/no-fetch-service/page") {
+		t.Error("expected /no-fetch-service to be disallowed")
+	}
+	if !rules.allowed("/private/secret") {
+		t.Error("expected wildcard rules not to apply when a specific group matches")
+	}
+	if rules.crawlDelay != 500*time.Millisecond {
+		t.Errorf("expected 500ms crawl delay, got %v", rules.crawlDelay)
+	}
+}
+
+func TestParseRobotsGroupMatching(t *testing.T) {
+	robotsTxt := `User-agent: fetch
+Disallow: /substring
+
+User-agent: url-fetch
+Disallow: /prefix
+
+User-agent: URL-FETCH-SERVICE/2.0
+Disallow: /exact
+
+User-agent: url-fetch-service
+Disallow: /exact-again
+
+User-agent: *
+Disallow: /wildcard
+`
+	tests := []struct {
+		agent      string
+		disallowed []string
+	}{
+		// Both groups naming the full token apply, combined
+		{"URL-Fetch-Service/1.0", []string{"/exact", "/exact-again"}},
+		// "url-fetch" is a "-"-separated prefix of the agent's token
+		{"URL-Fetch-Preview", []string{"/prefix"}},
+		// Substrings of the token don't match, so "*" applies
+		{"My-URL-Fetcher", []string{"/wildcard"}},
+	}
+	paths := []string{"/substring", "/prefix", "/exact", "/exact-again", "/wildcard"}
+
+	for _, tt := range tests {
+		rules := parseRobots(strings.NewReader(robotsTxt), robotsProductToken(tt.agent))
+		for _, path := range paths {
+			want := !slices.Contains(tt.disallowed, path)
+			if got := rules.allowed(path); got != want {
+				t.Errorf("%s: allowed(%q) = %t, expected %t", tt.agent, path, got, want)
+			}
+		}
+	}
+}
+
+func TestRobotsBlocksDisallowedURLs(t *testing.T) {
+	var robotsRequests, pageRequests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			robotsRequests.Add(1)
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+			return
+		}
+		pageRequests.Add(1)
+		w.Write([]byte("page"))
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.RobotsEnabled = true
+	cfg.RobotsCacheTTL = time.Hour
+	service := NewFetchService(cfg, ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	blocked := service.fetch(server.URL+"/private/data", FetchOptions{})
+	if blocked.Status != models.StatusFailed || blocked.FailureReason != models.FailureBlockedByRobots {
+		t.Errorf("expected blocked_by_robots failure, got status=%s reason=%q", blocked.Status, blocked.FailureReason)
+	}
+
+	allowed := service.fetch(server.URL+"/public", FetchOptions{})
+	if allowed.Status != models.StatusSuccess {
+		t.Errorf("expected success for allowed URL, got %s: %s", allowed.Status, allowed.Error)
+	}
+
+	if robotsRequests.Load() != 1 {
+		t.Errorf("expected robots.txt to be fetched once, got %d", robotsRequests.Load())
+	}
+	if pageRequests.Load() != 1 {
+		t.Errorf("expected only the allowed page to be fetched, got %d requests", pageRequests.Load())
+	}
+}
+
+func TestRobotsBlocksRedirectTarget(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+		case "/go":
+			http.Redirect(w, r, "/private/target", http.StatusFound)
+		default:
+			w.Write([]byte("page"))
+		}
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.RobotsEnabled = true
+	cfg.RobotsCacheTTL = time.Hour
+	service := NewFetchService(cfg, ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	result := service.fetch(server.URL+"/go", FetchOptions{})
+	if result.FailureReason != models.FailureBlockedByRobots {
+		t.Errorf("expected redirect into disallowed path to be blocked, got %+v", result)
+	}
+}
+
+func TestRobotsCrawlDelay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nCrawl-delay: 0.2\n"))
+			return
+		}
+		w.Write([]byte("page"))
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.RobotsEnabled = true
+	cfg.RobotsCacheTTL = time.Hour
+	service := NewFetchService(cfg, ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		service.fetch(server.URL+"/page", FetchOptions{})
+	}
+
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("expected three fetches to take at least 400ms with a 200ms crawl delay, took %v", elapsed)
+	}
+}
+
+func TestRobotsCrawlDelaySlotReturnedOnCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("User-agent: *\nCrawl-delay: 10\n"))
+	}))
+	defer server.Close()
+
+	cache := newRobotsCache(&http.Client{Timeout: time.Second}, "URL-Fetch-Service/1.0", time.Hour)
+	u, _ := url.Parse(server.URL + "/page")
+	if err := cache.check(context.Background(), u); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	reserved := cache.entry(u).nextFetch
+
+	// A request giving up on its wait doesn't push back the ones after it
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := cache.check(ctx, u); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the wait to end with the context, got %v", err)
+	}
+	if next := cache.entry(u).nextFetch; !next.Equal(reserved) {
+		t.Errorf("expected the slot to be given back (next fetch %v), got %v", reserved, next)
+	}
+}
+
+func TestRobotsCacheCleanup(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("User-agent: *\nDisallow: /private/\n"))
+	}))
+	defer server.Close()
+
+	cache := newRobotsCache(&http.Client{Timeout: time.Second}, "URL-Fetch-Service/1.0", time.Minute)
+	u, _ := url.Parse(server.URL + "/page")
+	if err := cache.check(context.Background(), u); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cache.cleanup(time.Now())
+	if n := cache.len(); n != 1 {
+		t.Errorf("expected the fresh entry to be kept, got %d entries", n)
+	}
+	cache.cleanup(time.Now().Add(2 * time.Minute))
+	if n := cache.len(); n != 0 {
+		t.Errorf("expected the expired entry to be evicted, got %d entries", n)
+	}
+}
@@ -0,0 +1,306 @@
+package service
+
+import (
+	"errors"
+	"fetch/cmd/model"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Schedule errors returned to callers
+var (
+	ErrScheduleNotFound = errors.New("schedule not found")
+	ErrInvalidSchedule  = errors.New("invalid schedule")
+)
+
+// defaultScheduleHistorySize is used when Config.ScheduleHistorySize is unset
+const defaultScheduleHistorySize = 20
+
+// nextRunner computes the next activation time of a schedule
+type nextRunner interface {
+	Next(t time.Time) time.Time
+}
+
+// everySchedule fires at a fixed interval
+type everySchedule struct {
+	interval time.Duration
+}
+
+// Next returns t plus the interval
+func (e everySchedule) Next(t time.Time) time.Time {
+	return t.Add(e.interval)
+}
+
+// schedule is the internal state of a registered schedule
+type schedule struct {
+	info   models.Schedule
+	runner nextRunner
+	budget func(urls int) error // Charges each run; nil for none
+	stop   chan struct{}
+}
+
+// ValidateSchedule checks a schedule request without creating it
+func (fs *FetchService) ValidateSchedule(req models.ScheduleRequest) error {
+	_, err := fs.scheduleRunner(req)
+	return err
+}
+
+// scheduleRunner validates a schedule request and returns its activation times
+func (fs *FetchService) scheduleRunner(req models.ScheduleRequest) (nextRunner, error) {
+	if len(req.URLs) == 0 {
+		return nil, fmt.Errorf("%w: no URLs provided", ErrInvalidSchedule)
+	}
+
+	switch {
+	case req.Interval != "" && req.Cron != "":
+		return nil, fmt.Errorf("%w: specify either interval or cron, not both", ErrInvalidSchedule)
+	case req.Interval != "":
+		interval, err := time.ParseDuration(req.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid interval: %v", ErrInvalidSchedule, err)
+		}
+		if minInterval := fs.config.Load().MinScheduleInterval; interval <= 0 || interval < minInterval {
+			return nil, fmt.Errorf("%w: interval must be at least %v", ErrInvalidSchedule, minInterval)
+		}
+		return everySchedule{interval: interval}, nil
+	case req.Cron != "":
+		cs, err := parseCron(req.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid cron expression: %v", ErrInvalidSchedule, err)
+		}
+		return cs, nil
+	default:
+		return nil, fmt.Errorf("%w: interval or cron is required", ErrInvalidSchedule)
+	}
+}
+
+// CreateSchedule registers a recurring fetch of the given URLs.
+// Exactly one of interval (a Go duration) or cron must be set.
+func (fs *FetchService) CreateSchedule(req models.ScheduleRequest) (models.Schedule, error) {
+	runner, err := fs.scheduleRunner(req)
+	if err != nil {
+		return models.Schedule{}, err
+	}
+
+	now := time.Now()
+	s := &schedule{
+		info: models.Schedule{
+			ID:        newID(),
+			URLs:      append([]string(nil), req.URLs...),
+			Interval:  req.Interval,
+			Cron:      req.Cron,
+			Tenant:    req.Tenant,
+			CreatedAt: now,
+			NextRun:   runner.Next(now),
+			History:   make([]models.ScheduleRun, 0),
+		},
+		runner: runner,
+		budget: req.Budget,
+		stop:   make(chan struct{}),
+	}
+
+	fs.schedMu.Lock()
+	defer fs.schedMu.Unlock()
+	fs.schedules[s.info.ID] = s
+	go fs.runSchedule(s, s.stop)
+
+	slog.Info("Created schedule", "schedule_id", s.info.ID, "urls", len(s.info.URLs), "next_run", s.info.NextRun)
+	return fs.scheduleSnapshot(s), nil
+}
+
+// ListSchedules returns all registered schedules
+func (fs *FetchService) ListSchedules() []models.Schedule {
+	fs.schedMu.RLock()
+	defer fs.schedMu.RUnlock()
+
+	schedules := make([]models.Schedule, 0, len(fs.schedules))
+	for _, s := range fs.schedules {
+		schedules = append(schedules, fs.scheduleSnapshot(s))
+	}
+	return schedules
+}
+
+// GetSchedule returns a single schedule with its run history
+func (fs *FetchService) GetSchedule(id string) (models.Schedule, error) {
+	fs.schedMu.RLock()
+	defer fs.schedMu.RUnlock()
+
+	s, ok := fs.schedules[id]
+	if !ok {
+		return models.Schedule{}, ErrScheduleNotFound
+	}
+	return fs.scheduleSnapshot(s), nil
+}
+
+// PauseSchedule stops future runs of a schedule until it is resumed
+func (fs *FetchService) PauseSchedule(id string) (models.Schedule, error) {
+	fs.schedMu.Lock()
+	defer fs.schedMu.Unlock()
+
+	s, ok := fs.schedules[id]
+	if !ok {
+		return models.Schedule{}, ErrScheduleNotFound
+	}
+	if !s.info.Paused {
+		close(s.stop)
+		s.info.Paused = true
+		s.info.NextRun = time.Time{}
+		slog.Info("Paused schedule", "schedule_id", id)
+	}
+	return fs.scheduleSnapshot(s), nil
+}
+
+// ResumeSchedule restarts a paused schedule from the current time
+func (fs *FetchService) ResumeSchedule(id string) (models.Schedule, error) {
+	fs.schedMu.Lock()
+	defer fs.schedMu.Unlock()
+
+	s, ok := fs.schedules[id]
+	if !ok {
+		return models.Schedule{}, ErrScheduleNotFound
+	}
+	if s.info.Paused {
+		s.info.Paused = false
+		s.info.NextRun = s.runner.Next(time.Now())
+		s.stop = make(chan struct{})
+		go fs.runSchedule(s, s.stop)
+		slog.Info("Resumed schedule", "schedule_id", id, "next_run", s.info.NextRun)
+	}
+	return fs.scheduleSnapshot(s), nil
+}
+
+// DeleteSchedule stops and removes a schedule. Results of past runs are kept.
+func (fs *FetchService) DeleteSchedule(id string) error {
+	fs.schedMu.Lock()
+	defer fs.schedMu.Unlock()
+
+	s, ok := fs.schedules[id]
+	if !ok {
+		return ErrScheduleNotFound
+	}
+	if !s.info.Paused {
+		close(s.stop)
+	}
+	delete(fs.schedules, id)
+
+	slog.Info("Deleted schedule", "schedule_id", id)
+	return nil
+}
+
+// runSchedule waits for each activation time and submits the schedule's URLs
+func (fs *FetchService) runSchedule(s *schedule, stop chan struct{}) {
+	for {
+		fs.schedMu.RLock()
+		next := s.info.NextRun
+		fs.schedMu.RUnlock()
+
+		// A schedule without a next activation never fires again
+		if next.IsZero() {
+			slog.Warn("Schedule has no next run, stopping it", "schedule_id", s.info.ID)
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+			fs.executeSchedule(s, stop)
+		case <-stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// executeSchedule performs one run and records it in the bounded history
+func (fs *FetchService) executeSchedule(s *schedule, stop chan struct{}) {
+	fs.schedMu.RLock()
+	urls := s.info.URLs
+	tenant := s.info.Tenant
+	fs.schedMu.RUnlock()
+
+	// The schedule may have been paused or deleted while the timer fired
+	select {
+	case <-stop:
+		return
+	default:
+	}
+
+	// A run the creator's budget doesn't allow is skipped, not fetched
+	now := time.Now()
+	run := models.ScheduleRun{StartedAt: now, TotalURLs: len(urls)}
+	if s.budget != nil {
+		if err := s.budget(len(urls)); err != nil {
+			run.Skipped = err.Error()
+			slog.Warn("Skipped schedule run", "schedule_id", s.info.ID, "error", err)
+		}
+	}
+	if run.Skipped == "" {
+		var done <-chan struct{}
+		run.JobID, done = fs.submit(urls, FetchOptions{Tenant: tenant})
+		run.PendingCount = len(urls)
+		go fs.recordScheduleRun(s, run.JobID, done)
+	}
+
+	fs.schedMu.Lock()
+	defer fs.schedMu.Unlock()
+
+	s.info.NextRun = s.runner.Next(now)
+	s.info.History = append(s.info.History, run)
+	if run.Skipped == "" {
+		s.info.RunCount++
+		s.info.LastRun = now
+	}
+	historySize := fs.config.Load().ScheduleHistorySize
+	if historySize <= 0 {
+		historySize = defaultScheduleHistorySize
+	}
+	if excess := len(s.info.History) - historySize; excess > 0 {
+		s.info.History = s.info.History[excess:]
+	}
+
+	if run.Skipped == "" {
+		slog.Info("Submitted schedule run", "schedule_id", s.info.ID, "run", s.info.RunCount, "job_id", run.JobID)
+	}
+}
+
+// recordScheduleRun stores the result counts of a run in the schedule's
+// history once all of its fetches completed
+func (fs *FetchService) recordScheduleRun(s *schedule, jobID string, done <-chan struct{}) {
+	<-done
+	results := fs.GetJobResults(jobID)
+
+	fs.schedMu.Lock()
+	defer fs.schedMu.Unlock()
+
+	for i := range s.info.History {
+		if run := &s.info.History[i]; run.JobID == jobID {
+			run.SuccessCount = results.SuccessCount
+			run.FailedCount = results.FailedCount
+			run.PendingCount = 0
+			break
+		}
+	}
+}
+
+// scheduleSnapshot copies a schedule. Callers must hold schedMu.
+func (fs *FetchService) scheduleSnapshot(s *schedule) models.Schedule {
+	info := s.info
+	info.URLs = append([]string(nil), s.info.URLs...)
+	info.History = make([]models.ScheduleRun, len(s.info.History))
+	copy(info.History, s.info.History)
+	return info
+}
+
+// stopSchedules stops all running schedules
+func (fs *FetchService) stopSchedules() {
+	fs.schedMu.Lock()
+	defer fs.schedMu.Unlock()
+
+	for _, s := range fs.schedules {
+		if !s.info.Paused {
+			close(s.stop)
+			s.info.Paused = true
+		}
+	}
+}
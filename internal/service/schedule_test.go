@@ -0,0 +1,213 @@
+package service
+
+import (
+	"errors"
+	"fetch/cmd/model"
+	"fetch/internal/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	base := time.Date(2025, time.January, 1, 10, 7, 30, 0, time.UTC) // Wednesday
+
+	tests := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2025, 1, 1, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, 1, 1, 10, 15, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2025, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"30 9 * * *", time.Date(2025, 1, 2, 9, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * 1-5", time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2025, 1, 5, 12, 0, 0, 0, time.UTC)},
+		{"0 8,20 * * *", time.Date(2025, 1, 1, 20, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			cs, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if next := cs.Next(base); !next.Equal(tt.expected) {
+				t.Errorf("expected next run %v, got %v", tt.expected, next)
+			}
+		})
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "a * * * *", "5-1 * * * *", "0 0 30 2 *", "0 0 31 4,6 *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("expected error for %q", expr)
+		}
+	}
+}
+
+func TestCreateScheduleValidation(t *testing.T) {
+	service := createTestService()
+	defer service.Stop()
+
+	tests := []models.ScheduleRequest{
+		{Interval: "1m"},
+		{URLs: []string{"https://example.com"}},
+		{URLs: []string{"https://example.com"}, Interval: "1m", Cron: "* * * * *"},
+		{URLs: []string{"https://example.com"}, Interval: "bogus"},
+		{URLs: []string{"https://example.com"}, Cron: "bogus"},
+		{URLs: []string{"https://example.com"}, Cron: "0 0 30 2 *"},
+	}
+
+	for _, req := range tests {
+		if _, err := service.CreateSchedule(req); !errors.Is(err, ErrInvalidSchedule) {
+			t.Errorf("expected ErrInvalidSchedule for %+v, got %v", req, err)
+		}
+	}
+}
+
+func TestScheduleRunsAndKeepsBoundedHistory(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.ScheduleHistorySize = 2
+	cfg.MinScheduleInterval = 10 * time.Millisecond
+	service := NewFetchService(cfg, ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	created, err := service.CreateSchedule(models.ScheduleRequest{
+		URLs:     []string{server.URL},
+		Interval: "20ms",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	paused, err := service.PauseSchedule(created.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !paused.Paused {
+		t.Error("expected schedule to be paused")
+	}
+	if paused.RunCount < 3 {
+		t.Fatalf("expected at least 3 runs, got %d", paused.RunCount)
+	}
+	if len(paused.History) != 2 {
+		t.Errorf("expected history bounded to 2 runs, got %d", len(paused.History))
+	}
+
+	// Runs are linked to their fetch results by job ID and record their counts
+	time.Sleep(100 * time.Millisecond)
+	for _, run := range paused.History {
+		results := service.GetJobResults(run.JobID)
+		if results.TotalURLs != 1 || results.SuccessCount != 1 {
+			t.Errorf("expected 1 successful result for job %s, got %+v", run.JobID, results)
+		}
+	}
+	recorded, _ := service.GetSchedule(created.ID)
+	for _, run := range recorded.History {
+		if run.SuccessCount != 1 || run.PendingCount != 0 {
+			t.Errorf("expected run %s to record 1 success, got %+v", run.JobID, run)
+		}
+	}
+
+	// No further runs while paused
+	time.Sleep(60 * time.Millisecond)
+	stillPaused, _ := service.GetSchedule(created.ID)
+	if stillPaused.RunCount != paused.RunCount {
+		t.Errorf("expected no runs while paused, got %d more", stillPaused.RunCount-paused.RunCount)
+	}
+
+	if _, err := service.ResumeSchedule(created.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := service.DeleteSchedule(created.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := service.GetSchedule(created.ID); !errors.Is(err, ErrScheduleNotFound) {
+		t.Errorf("expected ErrScheduleNotFound after delete, got %v", err)
+	}
+}
+
+// neverRunner is a schedule runner without further activations
+type neverRunner struct{}
+
+func (neverRunner) Next(time.Time) time.Time { return time.Time{} }
+
+func TestRunScheduleStopsWithoutNextRun(t *testing.T) {
+	service := createTestService()
+	defer service.Stop()
+
+	s := &schedule{
+		info:   models.Schedule{ID: "never", URLs: []string{"http://127.0.0.1:1/"}},
+		runner: neverRunner{},
+		stop:   make(chan struct{}),
+	}
+	returned := make(chan struct{})
+	go func() {
+		service.runSchedule(s, s.stop)
+		close(returned)
+	}()
+
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("expected runSchedule to return for a zero NextRun")
+	}
+	if got := service.GetResults().TotalURLs; got != 0 {
+		t.Errorf("expected no runs, got %d results", got)
+	}
+}
+
+func TestScheduleRunSkippedOverBudget(t *testing.T) {
+	cfg := testConfig()
+	cfg.MinScheduleInterval = 10 * time.Millisecond
+	service := NewFetchService(cfg, ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	charged := 0
+	created, err := service.CreateSchedule(models.ScheduleRequest{
+		URLs:     []string{"http://127.0.0.1:1/a", "http://127.0.0.1:1/b"},
+		Interval: "20ms",
+		Budget: func(urls int) error {
+			charged = urls
+			return errors.New("daily URL quota exceeded")
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	paused, err := service.PauseSchedule(created.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if charged != 2 {
+		t.Errorf("expected each run to be charged 2 URLs, got %d", charged)
+	}
+	if paused.RunCount != 0 || !paused.LastRun.IsZero() {
+		t.Errorf("expected skipped runs not to count, got %d runs (last %v)", paused.RunCount, paused.LastRun)
+	}
+	if len(paused.History) == 0 {
+		t.Fatal("expected skipped runs in the history")
+	}
+	for _, run := range paused.History {
+		if run.Skipped == "" || run.JobID != "" {
+			t.Errorf("expected a skipped run without a job, got %+v", run)
+		}
+	}
+	if got := service.GetResults().TotalURLs; got != 0 {
+		t.Errorf("expected no URLs fetched, got %d", got)
+	}
+}
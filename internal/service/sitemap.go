@@ -0,0 +1,286 @@
+package service
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fetch/cmd/model"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Sitemap errors returned to callers
+var (
+	ErrInvalidSitemap = errors.New("invalid sitemap request")
+	ErrSitemapFetch   = errors.New("failed to load sitemap")
+)
+
+// Sitemap expansion limits
+const (
+	defaultSitemapMaxURLs = 50000 // Used when Config.SitemapMaxURLs is unset
+	sitemapMaxDepth       = 3     // Nesting levels of sitemap indexes followed
+	sitemapMaxFiles       = 500   // Sitemap documents fetched per expansion
+)
+
+// sitemapTimeout bounds a whole expansion, including nested sitemaps and
+// robots.txt crawl delays. A var so tests can shorten it.
+var sitemapTimeout = time.Minute
+
+// sitemapDocument covers both <urlset> and <sitemapindex> documents
+type sitemapDocument struct {
+	XMLName  xml.Name
+	URLs     []sitemapLocation `xml:"url"`
+	Sitemaps []sitemapLocation `xml:"sitemap"`
+}
+
+// sitemapLocation is a <url> or <sitemap> entry
+type sitemapLocation struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// SitemapExpansion is the outcome of expanding a sitemap
+type SitemapExpansion struct {
+	URLs            []string
+	SitemapsFetched int
+	Truncated       bool // max_urls or the time limit was reached
+}
+
+// sitemapExpander holds the state of a single expansion
+type sitemapExpander struct {
+	fs        *FetchService
+	since     time.Time
+	include   []*regexp.Regexp
+	exclude   []*regexp.Regexp
+	maxURLs   int
+	sortQuery bool // DEDUP_SORT_QUERY when the expansion started
+	seen      map[string]bool
+	result    SitemapExpansion
+}
+
+// SitemapURLLimit returns the most URLs an expansion of src can return
+func (fs *FetchService) SitemapURLLimit(src models.SitemapSource) int {
+	maxURLs := fs.config.Load().SitemapMaxURLs
+	if maxURLs <= 0 {
+		maxURLs = defaultSitemapMaxURLs
+	}
+	if src.MaxURLs > 0 && src.MaxURLs < maxURLs {
+		return src.MaxURLs
+	}
+	return maxURLs
+}
+
+// ExpandSitemap fetches a sitemap or sitemap index (optionally gzipped),
+// follows nested sitemaps and returns the page URLs passing the filters.
+// Nested sitemaps not loaded within sitemapTimeout are skipped.
+func (fs *FetchService) ExpandSitemap(ctx context.Context, src models.SitemapSource) (SitemapExpansion, error) {
+	cfg := fs.config.Load()
+	maxURLs := cfg.SitemapMaxURLs
+	if maxURLs <= 0 {
+		maxURLs = defaultSitemapMaxURLs
+	}
+
+	if src.URL == "" {
+		return SitemapExpansion{}, fmt.Errorf("%w: sitemap url is required", ErrInvalidSitemap)
+	}
+	if src.MaxURLs < 0 || src.MaxURLs > maxURLs {
+		return SitemapExpansion{}, fmt.Errorf("%w: max_urls must not exceed %d", ErrInvalidSitemap, maxURLs)
+	}
+	if src.MaxURLs > 0 {
+		maxURLs = src.MaxURLs
+	}
+
+	e := &sitemapExpander{
+		fs:        fs,
+		maxURLs:   maxURLs,
+		sortQuery: cfg.DedupSortQuery,
+		seen:      make(map[string]bool),
+	}
+	if src.LastModSince != "" {
+		since, ok := parseLastMod(src.LastModSince)
+		if !ok {
+			return SitemapExpansion{}, fmt.Errorf("%w: invalid lastmod_since %q", ErrInvalidSitemap, src.LastModSince)
+		}
+		e.since = since
+	}
+
+	var err error
+	if e.include, err = compileFilters(ErrInvalidSitemap, "include", src.Include); err != nil {
+		return SitemapExpansion{}, err
+	}
+	if e.exclude, err = compileFilters(ErrInvalidSitemap, "exclude", src.Exclude); err != nil {
+		return SitemapExpansion{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sitemapTimeout)
+	defer cancel()
+	if err := e.expand(ctx, src.URL, 0); err != nil {
+		return SitemapExpansion{}, err
+	}
+
+	slog.InfoContext(ctx, "Expanded sitemap",
+		"url", src.URL,
+		"urls", len(e.result.URLs),
+		"sitemaps", e.result.SitemapsFetched,
+		"truncated", e.result.Truncated)
+	return e.result, nil
+}
+
+// expand processes one sitemap document. Only the root document failing to
+// load is an error; broken nested sitemaps are logged and skipped.
+func (e *sitemapExpander) expand(ctx context.Context, sitemapURL string, depth int) error {
+	if e.result.Truncated || e.result.SitemapsFetched >= sitemapMaxFiles {
+		return nil
+	}
+	if depth > 0 && ctx.Err() != nil {
+		// Out of time; keep the URLs found so far
+		e.result.Truncated = true
+		return nil
+	}
+
+	doc, err := e.fs.loadSitemap(ctx, sitemapURL)
+	e.result.SitemapsFetched++
+	if err != nil {
+		if depth == 0 {
+			return err
+		}
+		slog.WarnContext(ctx, "Skipping nested sitemap", "url", sitemapURL, "error", err)
+		return nil
+	}
+
+	for _, child := range doc.Sitemaps {
+		if depth+1 > sitemapMaxDepth {
+			slog.WarnContext(ctx, "Not following nested sitemap", "url", child.Loc, "max_depth", sitemapMaxDepth)
+			break
+		}
+		if !e.modifiedSince(child.LastMod) {
+			continue
+		}
+		if err := e.expand(ctx, strings.TrimSpace(child.Loc), depth+1); err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range doc.URLs {
+		loc := strings.TrimSpace(entry.Loc)
+		if loc == "" || !e.modifiedSince(entry.LastMod) || !passesFilters(loc, e.include, e.exclude) {
+			continue
+		}
+		key := normalizeURL(loc, e.sortQuery)
+		if e.seen[key] {
+			continue
+		}
+		if len(e.result.URLs) >= e.maxURLs {
+			e.result.Truncated = true
+			return nil
+		}
+		e.seen[key] = true
+		e.result.URLs = append(e.result.URLs, loc)
+	}
+	return nil
+}
+
+// modifiedSince applies the lastmod filter. Entries without a parseable
+// lastmod are kept, since they may have changed.
+func (e *sitemapExpander) modifiedSince(lastMod string) bool {
+	if e.since.IsZero() {
+		return true
+	}
+	t, ok := parseLastMod(lastMod)
+	return !ok || !t.Before(e.since)
+}
+
+// loadSitemap fetches and parses a single sitemap document with the
+// settings of its domain, like any other fetch
+func (fs *FetchService) loadSitemap(ctx context.Context, sitemapURL string) (*sitemapDocument, error) {
+	if err := fs.checkRobots(ctx, sitemapURL); err != nil {
+		return nil, fmt.Errorf("%w %s: %v", ErrSitemapFetch, sitemapURL, err)
+	}
+
+	settings := fs.settingsFor(hostname(sitemapURL))
+	req, err := http.NewRequestWithContext(ctx, "GET", sitemapURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %v", ErrSitemapFetch, sitemapURL, err)
+	}
+	req.Header.Set("User-Agent", settings.userAgent)
+	for name, value := range settings.headers {
+		req.Header.Set(name, value)
+	}
+
+	// Waiting for the egress rate limit doesn't count toward the timeout
+	if _, err := fs.waitForHost(ctx, req.URL); err != nil {
+		return nil, fmt.Errorf("%w %s: %v", ErrSitemapFetch, sitemapURL, err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, settings.timeout)
+	defer cancel()
+	req = req.WithContext(ctx)
+
+	client := &http.Client{
+		Transport: fs.httpClient.Transport,
+		Timeout:   settings.timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= settings.maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", settings.maxRedirects)
+			}
+			_, err := fs.prepareRedirect(req, settings)
+			return err
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %v", ErrSitemapFetch, sitemapURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w %s: unexpected status %d", ErrSitemapFetch, sitemapURL, resp.StatusCode)
+	}
+
+	// Detect gzip by magic bytes; Content-Type and extension are unreliable
+	body := bufio.NewReader(io.LimitReader(resp.Body, settings.maxContentSize))
+	var reader io.Reader = body
+	if magic, err := body.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("%w %s: invalid gzip data: %v", ErrSitemapFetch, sitemapURL, err)
+		}
+		defer gz.Close()
+		reader = io.LimitReader(gz, settings.maxContentSize)
+	}
+
+	var doc sitemapDocument
+	if err := xml.NewDecoder(reader).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w %s: invalid XML: %v", ErrSitemapFetch, sitemapURL, err)
+	}
+	if doc.XMLName.Local != "urlset" && doc.XMLName.Local != "sitemapindex" {
+		return nil, fmt.Errorf("%w %s: unexpected root element <%s>", ErrSitemapFetch, sitemapURL, doc.XMLName.Local)
+	}
+	return &doc, nil
+}
+
+// lastModLayouts are the W3C datetime forms allowed in <lastmod>
+var lastModLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// parseLastMod parses a W3C datetime as used by <lastmod>
+func parseLastMod(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range lastModLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
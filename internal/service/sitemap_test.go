@@ -0,0 +1,273 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fetch/cmd/model"
+	"fetch/internal/ratelimit"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newSitemapTestSite serves a sitemap index pointing at a plain and a
+// gzipped sitemap, plus a broken nested sitemap
+func newSitemapTestSite() *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		base := server.URL
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>%[1]s/pages.xml</loc><lastmod>2024-05-01</lastmod></sitemap>
+  <sitemap><loc>%[1]s/blog.xml.gz</loc></sitemap>
+  <sitemap><loc>%[1]s/missing.xml</loc></sitemap>
+</sitemapindex>`, base)
+		case "/pages.xml":
+			fmt.Fprintf(w, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>%[1]s/</loc><lastmod>2024-05-01T10:00:00+00:00</lastmod></url>
+  <url><loc>%[1]s/about</loc><lastmod>2023-01-15</lastmod></url>
+  <url><loc>%[1]s/admin/login</loc></url>
+</urlset>`, base)
+		case "/blog.xml.gz":
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			fmt.Fprintf(gz, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>%[1]s/blog/first</loc><lastmod>2024-06</lastmod></url>
+  <url><loc>%[1]s/blog/second</loc><lastmod>2022</lastmod></url>
+  <url><loc>%[1]s/</loc></url>
+</urlset>`, base)
+			gz.Close()
+			w.Header().Set("Content-Type", "application/x-gzip")
+			w.Write(buf.Bytes())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return server
+}
+
+func TestExpandSitemapIndex(t *testing.T) {
+	server := newSitemapTestSite()
+	defer server.Close()
+
+	service := NewFetchService(testConfig(), ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	expansion, err := service.ExpandSitemap(context.Background(), models.SitemapSource{URL: server.URL + "/sitemap.xml"})
+	if err != nil {
+		t.Fatalf("ExpandSitemap failed: %v", err)
+	}
+
+	expected := []string{
+		server.URL + "/",
+		server.URL + "/about",
+		server.URL + "/admin/login",
+		server.URL + "/blog/first",
+		server.URL + "/blog/second",
+	}
+	got := append([]string(nil), expansion.URLs...)
+	sort.Strings(got)
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("expected URLs %v, got %v", expected, got)
+	}
+	// The index, both child sitemaps and the missing one
+	if expansion.SitemapsFetched != 4 {
+		t.Errorf("expected 4 sitemaps fetched, got %d", expansion.SitemapsFetched)
+	}
+	if expansion.Truncated {
+		t.Error("expected expansion not to be truncated")
+	}
+}
+
+func TestExpandSitemapFilters(t *testing.T) {
+	server := newSitemapTestSite()
+	defer server.Close()
+
+	service := NewFetchService(testConfig(), ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	expansion, err := service.ExpandSitemap(context.Background(), models.SitemapSource{
+		URL:          server.URL + "/sitemap.xml",
+		LastModSince: "2024-01-01",
+		Exclude:      []string{"/admin/"},
+	})
+	if err != nil {
+		t.Fatalf("ExpandSitemap failed: %v", err)
+	}
+
+	// Entries without lastmod are kept; /about and /blog/second are too old
+	expected := []string{server.URL + "/", server.URL + "/blog/first"}
+	got := append([]string(nil), expansion.URLs...)
+	sort.Strings(got)
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("expected URLs %v, got %v", expected, got)
+	}
+}
+
+func TestExpandSitemapMaxURLs(t *testing.T) {
+	server := newSitemapTestSite()
+	defer server.Close()
+
+	service := NewFetchService(testConfig(), ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	expansion, err := service.ExpandSitemap(context.Background(), models.SitemapSource{
+		URL:     server.URL + "/sitemap.xml",
+		MaxURLs: 2,
+	})
+	if err != nil {
+		t.Fatalf("ExpandSitemap failed: %v", err)
+	}
+	if len(expansion.URLs) != 2 || !expansion.Truncated {
+		t.Errorf("expected 2 URLs and truncation, got %d URLs (truncated: %t)", len(expansion.URLs), expansion.Truncated)
+	}
+}
+
+func TestExpandSitemapTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { sitemapTimeout = timeout }(sitemapTimeout)
+	sitemapTimeout = 100 * time.Millisecond
+
+	slow := newSitemapTestSite()
+	defer slow.Close()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sitemap.xml" {
+			fmt.Fprintf(w, `<sitemapindex>
+  <sitemap><loc>%[1]s/slow.xml</loc></sitemap>
+  <sitemap><loc>%[2]s/pages.xml</loc></sitemap>
+</sitemapindex>`, server.URL, slow.URL)
+			return
+		}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	service := NewFetchService(testConfig(), ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	start := time.Now()
+	expansion, err := service.ExpandSitemap(context.Background(), models.SitemapSource{URL: server.URL + "/sitemap.xml"})
+	if err != nil {
+		t.Fatalf("ExpandSitemap failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected the expansion to stop at its deadline, took %v", elapsed)
+	}
+	// The sitemap after the slow one is skipped
+	if len(expansion.URLs) != 0 || !expansion.Truncated {
+		t.Errorf("expected no URLs and truncation, got %d URLs (truncated: %t)", len(expansion.URLs), expansion.Truncated)
+	}
+}
+
+func TestExpandSitemapUsesDomainSettings(t *testing.T) {
+	site := newSitemapTestSite()
+	defer site.Close()
+	var (
+		mu      sync.Mutex
+		headers []http.Header
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers = append(headers, r.Header.Clone())
+		mu.Unlock()
+		http.Redirect(w, r, site.URL+r.URL.Path, http.StatusFound)
+	}))
+	defer server.Close()
+
+	// One request per 50ms to the host serving the sitemaps
+	egress, err := ratelimit.NewHostLimiter(ratelimit.HostLimit{Rate: 20, Window: time.Second, Burst: 1}, nil, time.Second)
+	if err != nil {
+		t.Fatalf("NewHostLimiter failed: %v", err)
+	}
+	cfg := testConfig()
+	cfg.Egress = egress
+	cfg.Domains = map[string]DomainSettings{
+		"127.0.0.1": {
+			UserAgent: "custom-agent",
+			Headers:   map[string]string{"X-Api-Token": "secret"},
+		},
+	}
+	service := NewFetchService(cfg, ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	start := time.Now()
+	if _, err := service.ExpandSitemap(context.Background(), models.SitemapSource{URL: server.URL + "/sitemap.xml"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The root sitemap, its redirect and three nested sitemaps: four waits
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("expected the egress rate limit to space out the sitemap requests, took %v", elapsed)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(headers) == 0 {
+		t.Fatal("expected the sitemap to be requested")
+	}
+	for i, h := range headers {
+		if h.Get("User-Agent") != "custom-agent" || h.Get("X-Api-Token") != "secret" {
+			t.Errorf("request %d: expected the domain's headers, got %v", i+1, h)
+		}
+	}
+}
+
+func TestSitemapURLLimit(t *testing.T) {
+	cfg := testConfig()
+	cfg.SitemapMaxURLs = 100
+	service := NewFetchService(cfg, ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	tests := []struct {
+		maxURLs  int
+		expected int
+	}{
+		{0, 100},
+		{10, 10},
+		{500, 100},
+	}
+	for _, tt := range tests {
+		if got := service.SitemapURLLimit(models.SitemapSource{MaxURLs: tt.maxURLs}); got != tt.expected {
+			t.Errorf("max_urls %d: expected limit %d, got %d", tt.maxURLs, tt.expected, got)
+		}
+	}
+}
+
+func TestExpandSitemapErrors(t *testing.T) {
+	server := newSitemapTestSite()
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.SitemapMaxURLs = 100
+	service := NewFetchService(cfg, ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	tests := []struct {
+		name     string
+		src      models.SitemapSource
+		expected error
+	}{
+		{"missing url", models.SitemapSource{}, ErrInvalidSitemap},
+		{"max_urls above limit", models.SitemapSource{URL: server.URL + "/sitemap.xml", MaxURLs: 101}, ErrInvalidSitemap},
+		{"bad lastmod_since", models.SitemapSource{URL: server.URL + "/sitemap.xml", LastModSince: "yesterday"}, ErrInvalidSitemap},
+		{"bad pattern", models.SitemapSource{URL: server.URL + "/sitemap.xml", Include: []string{"("}}, ErrInvalidSitemap},
+		{"root not found", models.SitemapSource{URL: server.URL + "/missing.xml"}, ErrSitemapFetch},
+	}
+
+	for _, tt := range tests {
+		_, err := service.ExpandSitemap(context.Background(), tt.src)
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"fetch/cmd/model"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TenantQuota limits the results a tenant keeps in memory
+type TenantQuota struct {
+	MaxResults int           // Results kept in memory, oldest dropped first
+	ResultTTL  time.Duration // How long results are kept
+}
+
+// ParseTenantQuotas parses "tenant:max_results:ttl" entries, as used by the
+// TENANT_QUOTAS environment variable. Empty fields keep the global default.
+func ParseTenantQuotas(entries []string) (map[string]TenantQuota, error) {
+	quotas := make(map[string]TenantQuota, len(entries))
+	for _, entry := range entries {
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid tenant quota %q (expected tenant:max_results:ttl)", entry)
+		}
+
+		var quota TenantQuota
+		if v := strings.TrimSpace(parts[1]); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid max_results in tenant quota %q", entry)
+			}
+			quota.MaxResults = n
+		}
+		if v := strings.TrimSpace(parts[2]); v != "" {
+			ttl, err := time.ParseDuration(v)
+			if err != nil || ttl <= 0 {
+				return nil, fmt.Errorf("invalid ttl in tenant quota %q", entry)
+			}
+			quota.ResultTTL = ttl
+		}
+		quotas[strings.TrimSpace(parts[0])] = quota
+	}
+	return quotas, nil
+}
+
+// TenantQuotaFor returns the effective quota of a tenant, falling back to
+// MaxResultsInMemory and ResultTTL
+func (fs *FetchService) TenantQuotaFor(tenant string) TenantQuota {
+	cfg := fs.config.Load()
+	quota := cfg.TenantQuotas[tenant]
+	if quota.MaxResults <= 0 {
+		quota.MaxResults = cfg.MaxResultsInMemory
+	}
+	if quota.ResultTTL <= 0 {
+		quota.ResultTTL = cfg.ResultTTL
+	}
+	return quota
+}
+
+// GetTenantResults returns the results submitted by a tenant with statistics
+func (fs *FetchService) GetTenantResults(tenant string) models.FetchResponse {
+	return fs.collectResults(func(r models.FetchResult) bool {
+		return r.Tenant == tenant
+	})
+}
+
+// GetTenantJobResults returns the results of one of a tenant's jobs
+func (fs *FetchService) GetTenantJobResults(tenant, jobID string) models.FetchResponse {
+	return fs.collectResults(func(r models.FetchResult) bool {
+		return r.Tenant == tenant && r.JobID == jobID
+	})
+}
+
+// ClearTenantResults removes all results of a tenant and returns how many
+// were removed. Other tenants' results, snapshots and the shared response
+// cache are left alone.
+func (fs *FetchService) ClearTenantResults(tenant string) int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	kept := make([]*models.FetchResult, 0, len(fs.results))
+	for _, result := range fs.results {
+		if result.Tenant != tenant {
+			kept = append(kept, result)
+		}
+	}
+	count := len(fs.results) - len(kept)
+	fs.results = kept
+	fs.cleanupStats.TotalCleaned += count
+	fs.metrics.removed.Add(float64(count), "cleared")
+	fs.cleanupStats.ResultsInMemory = len(fs.results)
+
+	fs.changeMu.Lock()
+	for key := range fs.snapshots {
+		if key.tenant == tenant {
+			delete(fs.snapshots, key)
+		}
+	}
+	fs.changeMu.Unlock()
+
+	slog.Info("Cleared tenant results", "tenant", tenant, "removed", count)
+	return count
+}
+
+// tenantURL scopes per-URL state, such as a change-detection snapshot, to
+// a tenant. Unlike a joined string it can't confuse tenants whose names
+// contain the separator.
+type tenantURL struct {
+	tenant string
+	url    string // Normalized when deduplication is enabled
+}
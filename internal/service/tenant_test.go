@@ -0,0 +1,182 @@
+package service
+
+import (
+	"fetch/cmd/model"
+	"fetch/internal/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTenantResultsAreIsolated(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("page"))
+	}))
+	defer server.Close()
+
+	service := NewFetchService(testConfig(), ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	jobA := service.SubmitURLsWithOptions([]string{server.URL + "/a1", server.URL + "/a2"}, FetchOptions{Tenant: "team-a"})
+	jobB := service.SubmitURLsWithOptions([]string{server.URL + "/b1"}, FetchOptions{Tenant: "team-b"})
+	time.Sleep(200 * time.Millisecond)
+
+	if got := service.GetTenantResults("team-a"); got.TotalURLs != 2 || got.SuccessCount != 2 {
+		t.Errorf("expected 2 successful results for team-a, got %d (%d successful)", got.TotalURLs, got.SuccessCount)
+	}
+	if got := service.GetTenantResults("team-b"); got.TotalURLs != 1 {
+		t.Errorf("expected 1 result for team-b, got %d", got.TotalURLs)
+	}
+	if got := service.GetTenantJobResults("team-b", jobA); got.TotalURLs != 0 {
+		t.Errorf("expected team-b not to see team-a's job, got %d results", got.TotalURLs)
+	}
+	if got := service.GetTenantJobResults("team-b", jobB); got.TotalURLs != 1 {
+		t.Errorf("expected team-b to see its own job, got %d results", got.TotalURLs)
+	}
+
+	if cleared := service.ClearTenantResults("team-a"); cleared != 2 {
+		t.Errorf("expected 2 results cleared, got %d", cleared)
+	}
+	if got := service.GetResults(); got.TotalURLs != 1 || got.Results[0].Tenant != "team-b" {
+		t.Errorf("expected only team-b's result to remain, got %+v", got.Results)
+	}
+}
+
+func TestClearTenantDuringFetches(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+		w.Write([]byte("body of " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	service := NewFetchService(testConfig(), ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	service.FetchURLs([]string{server.URL + "/a"}, FetchOptions{Tenant: "team-a"})
+	jobB, done := service.submit([]string{server.URL + "/slow"}, FetchOptions{Tenant: "team-b"})
+	service.FetchURLs([]string{server.URL + "/c"}, FetchOptions{Tenant: "team-c"})
+
+	// Compacting the results must not move team-b's in-flight fetch to
+	// another tenant's record
+	service.ClearTenantResults("team-a")
+	close(release)
+	<-done
+
+	got := service.GetTenantJobResults("team-b", jobB)
+	if got.TotalURLs != 1 || got.Results[0].Status != "success" || got.Results[0].Content != "body of /slow" {
+		t.Errorf("expected team-b's result to be completed, got %+v", got.Results)
+	}
+	for _, result := range service.GetTenantResults("team-c").Results {
+		if result.Content != "body of /c" {
+			t.Errorf("expected team-c's result to keep its content, got %q", result.Content)
+		}
+	}
+}
+
+func TestTenantChangeHistoryIsIsolated(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("page"))
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.ChangeDetection = true
+	cfg.DedupEnabled = true
+	service := NewFetchService(cfg, ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	first := service.fetchShared(server.URL, FetchOptions{Tenant: "team-a"})
+	other := service.fetchShared(server.URL, FetchOptions{Tenant: "team-b"})
+	again := service.fetchShared(server.URL, FetchOptions{Tenant: "team-a"})
+
+	if first.Changed != nil || other.Changed != nil {
+		t.Error("expected each tenant's first fetch to have no change history")
+	}
+	if again.Changed == nil || *again.Changed {
+		t.Errorf("expected team-a's second fetch to be compared with its first, got %v", again.Changed)
+	}
+
+	// Clearing a tenant keeps the history of tenants whose names it prefixes
+	service.fetchShared(server.URL, FetchOptions{Tenant: "team-a b"})
+	service.ClearTenantResults("team-a")
+	if got := service.fetchShared(server.URL, FetchOptions{Tenant: "team-a b"}); got.Changed == nil {
+		t.Error(`expected "team-a b" to keep its change history when "team-a" is cleared`)
+	}
+	if got := service.fetchShared(server.URL, FetchOptions{Tenant: "team-a"}); got.Changed != nil {
+		t.Error("expected the cleared tenant's change history to be gone")
+	}
+}
+
+func TestTenantQuotasApplyPerTenant(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxResultsInMemory = 3
+	cfg.TenantQuotas = map[string]TenantQuota{
+		"small": {MaxResults: 1},
+		"short": {ResultTTL: time.Minute},
+	}
+	service := NewFetchService(cfg, ratelimit.NewRateLimiter(100, 20, 1*time.Minute))
+	defer service.Stop()
+
+	now := time.Now()
+	add := func(tenant, url string, age time.Duration) {
+		service.addResult(models.FetchResult{URL: url, Status: "success", Tenant: tenant, CreatedAt: now.Add(-age)})
+	}
+	add("", "http://example.com/1", 0)
+	add("", "http://example.com/2", 0)
+	add("small", "http://example.com/old", 0)
+	add("small", "http://example.com/new", 0)
+	add("short", "http://example.com/expired", 2*time.Minute)
+	add("short", "http://example.com/fresh", 0)
+	add("", "http://example.com/3", 0)
+
+	service.cleanupOldResults()
+
+	expected := map[string][]string{
+		"":      {"http://example.com/1", "http://example.com/2", "http://example.com/3"},
+		"small": {"http://example.com/new"},
+		"short": {"http://example.com/fresh"},
+	}
+	for tenant, urls := range expected {
+		got := service.GetTenantResults(tenant)
+		if got.TotalURLs != len(urls) {
+			t.Errorf("tenant %q: expected %d results, got %d", tenant, len(urls), got.TotalURLs)
+			continue
+		}
+		for i, url := range urls {
+			if got.Results[i].URL != url {
+				t.Errorf("tenant %q: expected result %d to be %s, got %s", tenant, i, url, got.Results[i].URL)
+			}
+		}
+	}
+
+	if quota := service.TenantQuotaFor("short"); quota.MaxResults != 3 || quota.ResultTTL != time.Minute {
+		t.Errorf("expected short's quota to fall back to the global max results, got %+v", quota)
+	}
+}
+
+func TestParseTenantQuotas(t *testing.T) {
+	quotas, err := ParseTenantQuotas([]string{"team-a:500:2h", "team-b::30m", "team-c:100:"})
+	if err != nil {
+		t.Fatalf("ParseTenantQuotas failed: %v", err)
+	}
+	expected := map[string]TenantQuota{
+		"team-a": {MaxResults: 500, ResultTTL: 2 * time.Hour},
+		"team-b": {ResultTTL: 30 * time.Minute},
+		"team-c": {MaxResults: 100},
+	}
+	for tenant, quota := range expected {
+		if quotas[tenant] != quota {
+			t.Errorf("tenant %s: expected %+v, got %+v", tenant, quota, quotas[tenant])
+		}
+	}
+
+	for _, entry := range []string{"team-a:500", ":1:1h", "team-a:-1:1h", "team-a:1:forever"} {
+		if _, err := ParseTenantQuotas([]string{entry}); err == nil {
+			t.Errorf("expected error for %q", entry)
+		}
+	}
+}
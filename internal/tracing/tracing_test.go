@@ -0,0 +1,232 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// recorder is an Exporter keeping ended spans in memory
+type recorder struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (r *recorder) Export(span *Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, span)
+}
+
+func (r *recorder) ended() []*Span {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*Span(nil), r.spans...)
+}
+
+func attr(s *Span, key string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range s.attrs {
+		if a.Key == key {
+			return a.Value
+		}
+	}
+	return nil
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		header  string
+		valid   bool
+		sampled bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false, false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", false, false},
+		{"", false, false},
+	}
+
+	for _, tt := range tests {
+		sc, ok := ParseTraceparent(tt.header)
+		if ok != tt.valid {
+			t.Errorf("ParseTraceparent(%q) valid = %v, want %v", tt.header, ok, tt.valid)
+			continue
+		}
+		if ok && sc.Sampled != tt.sampled {
+			t.Errorf("ParseTraceparent(%q) sampled = %v, want %v", tt.header, sc.Sampled, tt.sampled)
+		}
+	}
+
+	header := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, _ := ParseTraceparent(header)
+	if got := sc.Traceparent(); got != header {
+		t.Errorf("Traceparent() = %q, want %q", got, header)
+	}
+}
+
+func TestStartContinuesTrace(t *testing.T) {
+	rec := &recorder{}
+	tracer := NewTracer(rec, false)
+
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, parent := tracer.Start(ContextWithSpanContext(context.Background(), remote), "parent", KindServer)
+	_, child := tracer.Start(ctx, "child", KindInternal)
+	child.End()
+	parent.End()
+
+	if parent.sc.TraceID != remote.TraceID || parent.parent != remote.SpanID {
+		t.Errorf("parent span not a child of the remote span")
+	}
+	if child.sc.TraceID != remote.TraceID || child.parent != parent.sc.SpanID {
+		t.Errorf("child span not a child of the parent span")
+	}
+	if got := len(rec.ended()); got != 2 {
+		t.Errorf("exported %d spans, want 2", got)
+	}
+
+	// Unsampled traces stay unsampled and aren't exported
+	unsampled, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	_, span := tracer.Start(ContextWithSpanContext(context.Background(), unsampled), "unsampled", KindServer)
+	span.End()
+	if got := len(rec.ended()); got != 2 {
+		t.Errorf("exported %d spans after an unsampled one, want 2", got)
+	}
+
+	// A nil tracer records nothing
+	var off *Tracer
+	ctx, span = off.Start(context.Background(), "off", KindInternal)
+	span.SetAttributes(String("k", "v"))
+	span.End()
+	if SpanContextFromContext(ctx).IsValid() {
+		t.Errorf("nil tracer put a span context into the context")
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var traceparents []string
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		traceparents = append(traceparents, r.Header.Get(TraceparentHeader))
+		mu.Unlock()
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/target", http.StatusFound)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	for _, propagate := range []bool{false, true} {
+		rec := &recorder{}
+		tracer := NewTracer(rec, propagate)
+		traceparents = nil
+
+		ctx, parent := tracer.Start(context.Background(), "fetch", KindInternal)
+		client := &http.Client{Transport: Transport(nil, tracer)}
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/redirect", nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+		parent.End()
+
+		spans := rec.ended()
+		if len(spans) != 3 {
+			t.Fatalf("propagate=%v: exported %d spans, want 2 hops and the parent", propagate, len(spans))
+		}
+		hop, final := spans[0], spans[1]
+		if hop.parent != parent.sc.SpanID || final.parent != parent.sc.SpanID {
+			t.Errorf("propagate=%v: hop spans aren't children of the parent span", propagate)
+		}
+		if attr(hop, "http.response.status_code") != int64(http.StatusFound) || attr(hop, "http.redirect") != false {
+			t.Errorf("propagate=%v: unexpected redirect hop attributes %+v", propagate, hop.attrs)
+		}
+		if attr(final, "http.response.status_code") != int64(http.StatusOK) || attr(final, "http.redirect") != true ||
+			attr(final, "http.response.body.size") != int64(5) {
+			t.Errorf("propagate=%v: unexpected final hop attributes %+v", propagate, final.attrs)
+		}
+
+		for i, got := range traceparents {
+			want := ""
+			if propagate {
+				want = spans[i].sc.Traceparent()
+			}
+			if got != want {
+				t.Errorf("propagate=%v: request %d traceparent = %q, want %q", propagate, i, got, want)
+			}
+		}
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	received := make(chan otlpRequest, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected export request %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		var body otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("invalid export body: %v", err)
+		}
+		received <- body
+	}))
+	defer collector.Close()
+
+	if _, err := NewOTLPExporter(OTLPConfig{Endpoint: "localhost:4318"}); err == nil {
+		t.Errorf("expected an error for an endpoint without scheme")
+	}
+
+	exporter, err := NewOTLPExporter(OTLPConfig{Endpoint: collector.URL + "/", ServiceName: "fetch-test"})
+	if err != nil {
+		t.Fatalf("NewOTLPExporter failed: %v", err)
+	}
+	tracer := NewTracer(exporter, false)
+
+	ctx, parent := tracer.Start(context.Background(), "POST /fetch", KindServer)
+	_, child := tracer.Start(ctx, "fetch", KindInternal, String("server.address", "example.com"), Int("http.response.status_code", 200))
+	child.SetError("boom")
+	child.End()
+	parent.End()
+	exporter.Shutdown()
+
+	body := <-received
+	if len(body.ResourceSpans) != 1 || len(body.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("unexpected export body %+v", body)
+	}
+	resource := body.ResourceSpans[0].Resource.Attributes
+	if len(resource) != 1 || resource[0].Key != "service.name" || *resource[0].Value.StringValue != "fetch-test" {
+		t.Errorf("unexpected resource attributes %+v", resource)
+	}
+
+	spans := body.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+	got := spans[0]
+	if got.Name != "fetch" || got.Kind != KindInternal || got.ParentSpanID != spans[1].SpanID || got.TraceID != spans[1].TraceID {
+		t.Errorf("unexpected child span %+v", got)
+	}
+	if got.Status.Code != 2 || got.Status.Message != "boom" {
+		t.Errorf("unexpected child status %+v", got.Status)
+	}
+	if len(got.Attributes) != 2 || *got.Attributes[1].Value.IntValue != "200" {
+		t.Errorf("unexpected child attributes %+v", got.Attributes)
+	}
+	if spans[1].ParentSpanID != "" || spans[1].Kind != KindServer {
+		t.Errorf("unexpected root span %+v", spans[1])
+	}
+}
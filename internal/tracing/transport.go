@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// Transport wraps base so every round trip is recorded as a client span,
+// a child of the span in the request's context. Each redirect hop and
+// retry is its own round trip and so its own span. When the tracer
+// propagates outbound, requests carry a traceparent header.
+func Transport(base http.RoundTripper, t *Tracer) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if t == nil {
+		return base
+	}
+	return &transport{base: base, tracer: t}
+}
+
+type transport struct {
+	base   http.RoundTripper
+	tracer *Tracer
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := t.tracer.Start(req.Context(), "HTTP "+req.Method, KindClient,
+		String("http.request.method", req.Method),
+		String("server.address", req.URL.Hostname()),
+		String("url.scheme", req.URL.Scheme),
+		Bool("http.redirect", req.Response != nil),
+	)
+
+	if t.tracer.PropagateOutbound() {
+		// RoundTrippers must not modify the caller's request
+		req = req.Clone(ctx)
+		req.Header.Set(TraceparentHeader, span.SpanContext().Traceparent())
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.SetError(err.Error())
+		span.End()
+		return nil, err
+	}
+
+	span.SetAttributes(Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= 500 {
+		span.SetError(http.StatusText(resp.StatusCode))
+	}
+	resp.Body = &spanBody{ReadCloser: resp.Body, span: span}
+	return resp, nil
+}
+
+// spanBody ends its span once the response body is closed, recording the
+// bytes read
+type spanBody struct {
+	io.ReadCloser
+	span  *Span
+	bytes atomic.Int64
+}
+
+func (b *spanBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes.Add(int64(n))
+	return n, err
+}
+
+func (b *spanBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.span.SetAttributes(Int64("http.response.body.size", b.bytes.Load()))
+	b.span.End()
+	return err
+}
@@ -1,38 +1,113 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fetch/internal/config"
 	"fetch/internal/handler"
+	"fetch/internal/logging"
 	"fetch/internal/ratelimit"
 	"fetch/internal/service"
-	"log"
+	"fetch/internal/tracing"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"os"
+	"strings"
 )
 
 func main() {
-	// Load configuration from environment variables
-	cfg := config.Load()
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command named by args[0] and returns the exit status. Without
+// a command, or when args start with a flag, the service is served.
+func run(args []string, stdout, stderr io.Writer) int {
+	command := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "serve":
+		return serve(args, stderr)
+	case "fetch":
+		return fetchCommand(args, stdout, stderr)
+	case "check-config":
+		return checkConfigCommand(args, stdout, stderr)
+	case "version":
+		return versionCommand(stdout)
+	case "help":
+		usage(stdout)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "Unknown command %q\n\n", command)
+		usage(stderr)
+		return 2
+	}
+}
+
+// serve runs the HTTP service until it fails to start
+func serve(args []string, stderr io.Writer) int {
+	flags := newFlagSet("serve", "[flags]", "Run the HTTP service.", stderr)
+	configFile, overrides := settingsFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return flagStatus(err)
+	}
 
-	log.Println("Starting URL Fetch Service")
+	// Load configuration from flags, environment variables and the config file
+	cfg, err := config.LoadWithOverrides(*configFile, overrides)
+	var invalid *config.ValidationError
+	if errors.As(err, &invalid) {
+		logInvalidConfig(context.Background(), err)
+		fatal("Invalid configuration", fmt.Errorf("%d invalid settings", len(invalid.Problems)))
+	}
+	if err != nil {
+		fatal("Failed to load configuration", err)
+	}
+	if err := logging.Setup(cfg.LogLevel, cfg.LogFormat); err != nil {
+		fatal("Invalid logging configuration", err)
+	}
+
+	slog.Info("Starting URL Fetch Service")
 	cfg.LogConfig()
 
 	// Create rate limiter
-	rateLimiter := ratelimit.NewRateLimiter(
-		cfg.RateLimitRequests,
-		cfg.RateLimitBurst,
-		cfg.RateLimitWindow,
-	)
+	rateLimiter, err := newRateLimiter(cfg, "requests", cfg.RateLimitRequests, cfg.RateLimitBurst)
+	if err != nil {
+		fatal("Invalid rate limit configuration", err)
+	}
 
-	// Create service config
-	serviceConfig := service.Config{
-		FetchTimeout:       cfg.FetchTimeout,
-		MaxRedirects:       cfg.MaxRedirects,
-		MaxContentSize:     cfg.MaxContentSize,
-		ResultTTL:          cfg.ResultTTL,
-		CleanupInterval:    cfg.CleanupInterval,
-		MaxResultsInMemory: cfg.MaxResultsInMemory,
+	tenantQuotas, err := service.ParseTenantQuotas(cfg.TenantQuotas)
+	if err != nil {
+		fatal("Invalid TENANT_QUOTAS", err)
+	}
+
+	// Outbound rate limits per target host
+	egress, err := newEgressLimiter(cfg)
+	if err != nil {
+		fatal("Invalid egress rate limit configuration", err)
 	}
 
+	// Export spans to an OTLP/HTTP collector
+	var tracer *tracing.Tracer
+	if cfg.TracingEnabled {
+		exporter, err := tracing.NewOTLPExporter(tracing.OTLPConfig{
+			Endpoint:    cfg.TracingEndpoint,
+			ServiceName: cfg.TracingServiceName,
+		})
+		if err != nil {
+			fatal("Invalid tracing configuration", err)
+		}
+		tracer = tracing.NewTracer(exporter, cfg.TracingPropagateOutbound)
+	}
+
+	// Create service config
+	serviceConfig := newServiceConfig(cfg, tenantQuotas)
+	serviceConfig.Egress = egress
+	serviceConfig.Tracer = tracer
+
 	// Create fetch service
 	fetchService := service.NewFetchService(serviceConfig, rateLimiter)
 
@@ -43,30 +118,222 @@ func main() {
 		cfg.RateLimitWindow.String(),
 	)
 
+	// Per-caller URL and daily budgets for fetch submissions
+	budgets := handlers.Budgets{
+		DailyRequests: ratelimit.NewDailyQuota(cfg.DailyRequestQuota),
+		DailyURLs:     ratelimit.NewDailyQuota(cfg.DailyURLQuota),
+	}
+	if cfg.URLRateLimit > 0 {
+		urlLimiter, err := newRateLimiter(cfg, "urls", cfg.URLRateLimit, cfg.URLRateLimit)
+		if err != nil {
+			fatal("Invalid URL_RATE_LIMIT", err)
+		}
+		budgets.URLLimiter = urlLimiter
+		budgets.URLLimit = cfg.URLRateLimit
+	}
+	handler.SetBudgets(budgets)
+	handler.SetUploadLimits(cfg.UploadMaxBytes, cfg.UploadMaxURLs)
+
+	// Re-read the configuration on SIGHUP or POST /admin/config/reload
+	reloader := &reloader{
+		path:        *configFile,
+		overrides:   overrides,
+		cfg:         cfg,
+		service:     fetchService,
+		rateLimiter: rateLimiter,
+		urlLimiter:  budgets.URLLimiter,
+		handler:     handler,
+	}
+	handler.SetConfigReloader(reloader.reload)
+	handler.SetConfigSource(reloader.current)
+	go reloader.watch()
+
+	// Only proxies in TRUSTED_PROXIES may tell us who the client is
+	proxies, err := handlers.ParseTrustedProxies(cfg.TrustedProxies, cfg.IPv6Prefix, cfg.TrustedProxyHeader)
+	if err != nil {
+		fatal("Invalid TRUSTED_PROXIES", err)
+	}
+	handler.SetTrustedProxies(proxies)
+
+	// Load API keys; without any, every endpoint stays open
+	auth, err := newAuthenticator(cfg)
+	if err != nil {
+		fatal("Invalid API key configuration", err)
+	}
+	if !auth.Enabled() {
+		slog.Warn("No API keys configured, authentication is disabled")
+	}
+
 	// Register routes
 	http.HandleFunc("/fetch", handler.HandleFetch)
 	http.HandleFunc("/health", handler.HandleHealth)
-	http.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
-		handler.HandleStats(
-			w, r,
-			cfg.ResultTTL.String(),
-			cfg.CleanupInterval.String(),
-			cfg.MaxResultsInMemory,
-		)
-	})
+	http.HandleFunc("/stats", handler.HandleStats)
+	http.HandleFunc("/metrics", handler.HandleMetrics)
 	http.HandleFunc("/admin/clear", handler.HandleAdminClear)
+	http.HandleFunc("/admin/stats", handler.HandleAdminStats)
+	http.HandleFunc("/admin/config", handler.HandleAdminConfig)
+	http.HandleFunc("/admin/config/reload", handler.HandleAdminConfigReload)
+	http.HandleFunc("/schedules", handler.HandleSchedules)
+	http.HandleFunc("/schedules/", handler.HandleScheduleByID)
+	http.HandleFunc("/crawl", handler.HandleCrawl)
+	http.HandleFunc("/crawl/", handler.HandleCrawlByID)
+	http.HandleFunc("/jobs/", handler.HandleJobByID)
+	http.HandleFunc("/linkcheck", handler.HandleLinkCheck)
+	http.HandleFunc("/linkcheck/", handler.HandleLinkCheckByID)
 
 	// Log endpoints
-	log.Println("\nAvailable Endpoints:")
-	log.Println("  POST /fetch        - Submit URLs for fetching")
-	log.Println("  GET  /fetch        - Retrieve fetch results")
-	log.Println("  GET  /health       - Health check")
-	log.Println("  GET  /stats        - Service statistics")
-	log.Println("  POST /admin/clear  - Clear all results (admin)")
+	slog.Info("Available endpoints", "endpoints", []string{
+		"POST /fetch - Submit URLs for fetching",
+		"GET /fetch - Retrieve fetch results",
+		"GET /health - Health check",
+		"GET /stats - Service statistics",
+		"GET /metrics - Prometheus metrics",
+		"POST /admin/clear - Clear all results (admin)",
+		"GET /admin/stats - Service-wide statistics (admin)",
+		"GET /admin/config - Effective configuration (admin)",
+		"POST /admin/config/reload - Reload the configuration (admin)",
+		"POST /schedules - Create a recurring fetch schedule",
+		"GET /schedules - List schedules",
+		"GET /schedules/{id} - Schedule details and run history",
+		"POST /schedules/{id}/pause - Pause a schedule",
+		"POST /schedules/{id}/resume - Resume a schedule",
+		"DELETE /schedules/{id} - Delete a schedule",
+		"POST /crawl - Start a crawl from seed URLs",
+		"GET /crawl/{id} - Crawl progress",
+		"GET /jobs/{id} - Results of a single job",
+		"POST /linkcheck - Check the links of pages",
+		"GET /linkcheck/{id} - Link check progress and report",
+	})
 
 	// Start server
-	log.Printf("\n Server listening on %s\n", cfg.ServerAddress)
-	if err := http.ListenAndServe(cfg.ServerAddress, nil); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	slog.Info("Server listening", "address", cfg.ServerAddress)
+	server := handlers.RequestID(handlers.Tracing(tracer, http.DefaultServeMux,
+		auth.Middleware(handler.RateLimitHeaders(http.DefaultServeMux))))
+	if err := http.ListenAndServe(cfg.ServerAddress, server); err != nil {
+		fatal("Server failed to start", err)
+	}
+	return 0
+}
+
+// fatal logs a startup error and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// newRateLimiter creates a rate limiter on the configured backend. Limiters
+// sharing a Redis store are kept apart by name.
+func newRateLimiter(cfg *config.Config, name string, rate, burst int) (*ratelimit.RateLimiter, error) {
+	switch cfg.RateLimitBackend {
+	case "memory", "":
+		return ratelimit.NewRateLimiterWithAlgorithm(cfg.RateLimitAlgorithm, rate, burst, cfg.RateLimitWindow)
+	case "redis":
+		return ratelimit.NewRedisRateLimiter(cfg.RateLimitAlgorithm, rate, burst, cfg.RateLimitWindow, ratelimit.RedisConfig{
+			URL:     cfg.RateLimitRedisURL,
+			Prefix:  "fetch:ratelimit:" + name + ":",
+			Timeout: cfg.RateLimitRedisTimeout,
+		})
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q (expected memory or redis)", cfg.RateLimitBackend)
+	}
+}
+
+// newEgressLimiter creates the outbound rate limiter of EGRESS_RATE_LIMIT,
+// EGRESS_HOST_LIMITS and per-domain rate limits, nil when none are set
+func newEgressLimiter(cfg *config.Config) (*ratelimit.HostLimiter, error) {
+	egressDefaults := ratelimit.HostLimit{Rate: cfg.EgressRateLimit, Window: cfg.EgressRateWindow, Burst: cfg.EgressBurst}
+	hostLimits, err := ratelimit.ParseHostLimits(cfg.EgressHostLimits, egressDefaults)
+	if err != nil {
+		return nil, fmt.Errorf("EGRESS_HOST_LIMITS: %w", err)
+	}
+	for domain, d := range cfg.Domains {
+		// EGRESS_HOST_LIMITS entries take precedence like other variables
+		if _, ok := hostLimits[domain]; ok || d.RateLimit == nil {
+			continue
+		}
+		limit := egressDefaults
+		limit.Rate = *d.RateLimit
+		if d.RateWindow > 0 {
+			limit.Window = d.RateWindow
+		}
+		if d.Burst > 0 {
+			limit.Burst = d.Burst
+		}
+		hostLimits[domain] = limit
+	}
+	if cfg.EgressRateLimit <= 0 && len(hostLimits) == 0 {
+		return nil, nil
+	}
+	return ratelimit.NewHostLimiter(egressDefaults, hostLimits, cfg.EgressMaxWait)
+}
+
+// newAuthenticator loads the keys of API_KEYS and API_KEYS_FILE
+func newAuthenticator(cfg *config.Config) (*handlers.Authenticator, error) {
+	apiKeys, err := handlers.ParseAPIKeys(cfg.APIKeys)
+	if err != nil {
+		return nil, fmt.Errorf("API_KEYS: %w", err)
+	}
+	if cfg.APIKeysFile != "" {
+		fileKeys, err := handlers.LoadAPIKeyFile(cfg.APIKeysFile)
+		if err != nil {
+			return nil, fmt.Errorf("API_KEYS_FILE: %w", err)
+		}
+		apiKeys = append(apiKeys, fileKeys...)
+	}
+	return handlers.NewAuthenticator(apiKeys)
+}
+
+// newServiceConfig returns the fetch service settings of cfg, without the
+// egress limiter and tracer
+func newServiceConfig(cfg *config.Config, tenantQuotas map[string]service.TenantQuota) service.Config {
+	domains := make(map[string]service.DomainSettings, len(cfg.Domains))
+	for domain, d := range cfg.Domains {
+		domains[domain] = service.DomainSettings{
+			FetchTimeout:   d.FetchTimeout,
+			MaxRedirects:   d.MaxRedirects,
+			MaxContentSize: d.MaxContentSize,
+			UserAgent:      d.UserAgent,
+			Headers:        d.Headers,
+		}
+	}
+
+	return service.Config{
+		FetchTimeout:       cfg.FetchTimeout,
+		MaxRedirects:       cfg.MaxRedirects,
+		MaxContentSize:     cfg.MaxContentSize,
+		FetchConcurrency:   cfg.FetchConcurrency,
+		ResultTTL:          cfg.ResultTTL,
+		CleanupInterval:    cfg.CleanupInterval,
+		MaxResultsInMemory: cfg.MaxResultsInMemory,
+
+		ScheduleHistorySize: cfg.ScheduleHistorySize,
+		MinScheduleInterval: cfg.MinScheduleInterval,
+
+		ChangeDetection:           cfg.ChangeDetection,
+		ChangeIgnorePatterns:      cfg.ChangeIgnorePatterns,
+		ChangeNormalizeWhitespace: cfg.ChangeNormalizeWhitespace,
+
+		CacheEnabled:    cfg.CacheEnabled,
+		CacheMaxEntries: cfg.CacheMaxEntries,
+
+		DedupEnabled:   cfg.DedupEnabled,
+		DedupSortQuery: cfg.DedupSortQuery,
+
+		CrawlMaxDepth:    cfg.CrawlMaxDepth,
+		CrawlMaxPages:    cfg.CrawlMaxPages,
+		CrawlConcurrency: cfg.CrawlConcurrency,
+
+		UserAgent:      cfg.UserAgent,
+		RobotsEnabled:  cfg.RobotsEnabled,
+		RobotsCacheTTL: cfg.RobotsCacheTTL,
+
+		SitemapMaxURLs: cfg.SitemapMaxURLs,
+
+		LinkCheckMaxLinks:    cfg.LinkCheckMaxLinks,
+		LinkCheckConcurrency: cfg.LinkCheckConcurrency,
+
+		TenantQuotas: tenantQuotas,
+
+		Domains: domains,
 	}
 }
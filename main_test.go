@@ -3,291 +3,169 @@ package main
 import (
 	"encoding/json"
 	"fetch/cmd/model"
+	"fetch/internal/config"
 	"fetch/internal/handler"
 	"fetch/internal/ratelimit"
 	"fetch/internal/service"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 )
 
-// Helper function to create a test service
-func createTestService() *service.FetchService {
-	cfg := service.Config{
-		FetchTimeout:       5 * time.Second,
-		MaxRedirects:       10,
-		MaxContentSize:     10 * 1024 * 1024,
-		ResultTTL:          1 * time.Hour,
-		CleanupInterval:    10 * time.Minute,
-		MaxResultsInMemory: 10000,
+func TestConfigReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfig := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("writing config file: %v", err)
+		}
 	}
-	rateLimiter := ratelimit.NewRateLimiter(100, 20, 1*time.Minute)
-	return service.NewFetchService(cfg, rateLimiter)
-}
-
-// Helper function to create test handler
-func createTestHandler() *handlers.Handler {
-	svc := createTestService()
-	return handlers.NewHandler(svc, 100, "1m")
-}
-
-func TestHandlePostFetchSuccess(t *testing.T) {
-	handler := createTestHandler()
+	writeConfig(`{"rate_limit_requests": 2, "rate_limit_burst": 2}`)
 
-	reqBody := `{"urls": ["https://example.com", "https://google.com"]}`
-	req := httptest.NewRequest("POST", "/fetch", strings.NewReader(reqBody))
-	req.Header.Set("Content-Type", "application/json")
-	w := httptest.NewRecorder()
-
-	handler.HandlePostFetch(w, req)
-
-	if w.Code != http.StatusAccepted {
-		t.Errorf("expected status %d, got %d", http.StatusAccepted, w.Code)
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
 	}
+	rateLimiter := ratelimit.NewRateLimiter(cfg.RateLimitRequests, cfg.RateLimitBurst, cfg.RateLimitWindow)
+	svc := service.NewFetchService(newServiceConfig(cfg, nil), rateLimiter)
+	defer svc.Stop()
+	handler := handlers.NewHandler(svc, cfg.RateLimitRequests, cfg.RateLimitWindow.String())
+	rl := &reloader{path: path, cfg: cfg, service: svc, rateLimiter: rateLimiter, handler: handler}
+	handler.SetConfigReloader(rl.reload)
 
-	var response map[string]interface{}
-	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
-		t.Fatalf("failed to decode response: %v", err)
+	post := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.HandleAdminConfigReload(w, httptest.NewRequest("POST", "/admin/config/reload", nil))
+		return w
 	}
 
-	if response["total_urls"].(float64) != 2 {
-		t.Errorf("expected 2 URLs, got %v", response["total_urls"])
+	writeConfig(`{"rate_limit_requests": 50, "rate_limit_burst": 2, "result_ttl": "5m", "fetch_timeout": "3s", "server_address": ":9090"}`)
+	w := post()
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
 	}
-
-	if response["status"] != "processing" {
-		t.Errorf("expected status 'processing', got '%v'", response["status"])
+	var reload models.ConfigReload
+	if err := json.NewDecoder(w.Body).Decode(&reload); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
 	}
-}
-
-func TestHandlePostFetchInvalidJSON(t *testing.T) {
-	handler := createTestHandler()
-
-	req := httptest.NewRequest("POST", "/fetch", strings.NewReader("invalid json"))
-	req.Header.Set("Content-Type", "application/json")
-	w := httptest.NewRecorder()
-
-	handler.HandlePostFetch(w, req)
-
-	if w.Code != http.StatusBadRequest {
-		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	if !slices.Equal(reload.Applied, []string{"FETCH_TIMEOUT", "RATE_LIMIT_REQUESTS", "RESULT_TTL"}) ||
+		!slices.Equal(reload.RestartRequired, []string{"SERVER_ADDRESS"}) || reload.ReloadedAt.IsZero() {
+		t.Errorf("unexpected reload %+v", reload)
 	}
-}
-
-func TestHandlePostFetchEmptyURLs(t *testing.T) {
-	handler := createTestHandler()
-
-	reqBody := `{"urls": []}`
-	req := httptest.NewRequest("POST", "/fetch", strings.NewReader(reqBody))
-	req.Header.Set("Content-Type", "application/json")
-	w := httptest.NewRecorder()
-
-	handler.HandlePostFetch(w, req)
-
-	if w.Code != http.StatusBadRequest {
-		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	if current, _ := rl.current(); rateLimiter.Limit() != 50 || current.ResultTTL != 5*time.Minute || current.ServerAddress != ":8080" {
+		t.Errorf("expected the live settings only to be applied, got limit %d and %+v", rateLimiter.Limit(), current)
 	}
-}
-
-func TestHandleGetFetchSuccess(t *testing.T) {
-	svc := createTestService()
-	defer svc.Stop()
 
-	handler := handlers.NewHandler(svc, 100, "1m")
-
-	// Add some mock results
-	svc.SubmitURLs([]string{"https://example.com"})
-	time.Sleep(100 * time.Millisecond)
-
-	req := httptest.NewRequest("GET", "/fetch", nil)
-	w := httptest.NewRecorder()
-
-	handler.HandleGetFetch(w, req)
-
-	if w.Code != http.StatusOK {
-		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	// An invalid configuration is rejected as a whole
+	writeConfig(`{"rate_limit_requests": 10, "rate_limit_burst": 2, "result_ttl": "forever"}`)
+	w = post()
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `result_ttl in config file: invalid duration`) {
+		t.Errorf("expected the problems to be reported, got %d: %s", w.Code, w.Body)
+	}
+	if rateLimiter.Limit() != 50 {
+		t.Errorf("expected the current configuration to be kept, got limit %d", rateLimiter.Limit())
 	}
 
-	var response models.FetchResponse
-	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+	// GET /admin/config reports the configuration in effect
+	handler.SetConfigSource(rl.current)
+	w = httptest.NewRecorder()
+	handler.HandleAdminConfig(w, httptest.NewRequest("GET", "/admin/config", nil))
+	var effective models.EffectiveConfig
+	if err := json.NewDecoder(w.Body).Decode(&effective); err != nil {
 		t.Fatalf("failed to decode response: %v", err)
 	}
-
-	if response.TotalURLs != 1 {
-		t.Errorf("expected 1 total URL, got %d", response.TotalURLs)
+	for key, want := range map[string]models.ConfigSetting{
+		"RATE_LIMIT_REQUESTS": {Value: float64(50), Source: "file", Reloadable: true},
+		"RESULT_TTL":          {Value: "5m0s", Source: "file", Reloadable: true},
+		"SERVER_ADDRESS":      {Value: ":8080", Source: "default"},
+	} {
+		if got := effective.Settings[key]; got != want {
+			t.Errorf("%s: expected %+v, got %+v", key, want, got)
+		}
+	}
+	if !effective.ReloadedAt.Equal(reload.ReloadedAt) {
+		t.Errorf("expected the last reload time %v, got %v", reload.ReloadedAt, effective.ReloadedAt)
 	}
 }
 
-func TestHandleFetchRouting(t *testing.T) {
-	handler := createTestHandler()
+func TestFetchCommand(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "hello")
+	}))
+	defer server.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	t.Setenv("CONFIG_FILE", "")
 
-	tests := []struct {
-		name           string
-		method         string
-		body           string
-		expectedStatus int
-	}{
-		{
-			name:           "POST with valid body",
-			method:         "POST",
-			body:           `{"urls": ["https://example.com"]}`,
-			expectedStatus: http.StatusAccepted,
-		},
-		{
-			name:           "GET request",
-			method:         "GET",
-			body:           "",
-			expectedStatus: http.StatusOK,
-		},
-		{
-			name:           "PUT request (not allowed)",
-			method:         "PUT",
-			body:           "",
-			expectedStatus: http.StatusMethodNotAllowed,
-		},
-		{
-			name:           "DELETE request (not allowed)",
-			method:         "DELETE",
-			body:           "",
-			expectedStatus: http.StatusMethodNotAllowed,
-		},
+	var stdout, stderr strings.Builder
+	if code := run([]string{"fetch", "-robots-enabled=false", server.URL + "/page"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit status 0, got %d: %s", code, stderr.String())
 	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			req := httptest.NewRequest(tt.method, "/fetch", strings.NewReader(tt.body))
-			if tt.body != "" {
-				req.Header.Set("Content-Type", "application/json")
-			}
-			w := httptest.NewRecorder()
-
-			handler.HandleFetch(w, req)
-
-			if w.Code != tt.expectedStatus {
-				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
-			}
-		})
+	var response models.FetchResponse
+	if err := json.Unmarshal([]byte(stdout.String()), &response); err != nil {
+		t.Fatalf("Output is not a fetch response: %v\n%s", err, stdout.String())
 	}
-}
-
-func TestHandleHealth(t *testing.T) {
-	handler := createTestHandler()
-
-	req := httptest.NewRequest("GET", "/health", nil)
-	w := httptest.NewRecorder()
-
-	handler.HandleHealth(w, req)
-
-	if w.Code != http.StatusOK {
-		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	if response.TotalURLs != 1 || response.SuccessCount != 1 || response.Results[0].Content != "hello" {
+		t.Errorf("Unexpected response: %+v", response)
 	}
 
-	if w.Body.String() != "OK" {
-		t.Errorf("expected body 'OK', got '%s'", w.Body.String())
+	stdout.Reset()
+	if code := run([]string{"fetch", "-robots-enabled=false", closed.URL}, &stdout, &stderr); code != 1 {
+		t.Errorf("Expected exit status 1 for a failed fetch, got %d", code)
+	}
+	if code := run([]string{"fetch"}, &stdout, &stderr); code != 2 {
+		t.Errorf("Expected exit status 2 without URLs, got %d", code)
 	}
 }
 
-func TestIntegrationFullWorkflow(t *testing.T) {
-	// Create mock server for successful requests
-	successServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("Success response"))
-	}))
-	defer successServer.Close()
-
-	svc := createTestService()
-	defer svc.Stop()
-
-	handler := handlers.NewHandler(svc, 100, "1m")
-
-	// Step 1: Submit URLs via POST
-	reqBody := `{"urls": ["` + successServer.URL + `"]}`
-	postReq := httptest.NewRequest("POST", "/fetch", strings.NewReader(reqBody))
-	postReq.Header.Set("Content-Type", "application/json")
-	postWriter := httptest.NewRecorder()
-
-	handler.HandleFetch(postWriter, postReq)
-
-	if postWriter.Code != http.StatusAccepted {
-		t.Fatalf("POST request failed with status %d", postWriter.Code)
+func TestCheckConfigCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"fetch_timeout": "5s"}`), 0o600); err != nil {
+		t.Fatal(err)
 	}
 
-	// Wait for fetches to complete
-	time.Sleep(500 * time.Millisecond)
-
-	// Step 2: Retrieve results via GET
-	getReq := httptest.NewRequest("GET", "/fetch", nil)
-	getWriter := httptest.NewRecorder()
-
-	handler.HandleFetch(getWriter, getReq)
-
-	if getWriter.Code != http.StatusOK {
-		t.Fatalf("GET request failed with status %d", getWriter.Code)
+	var stdout, stderr strings.Builder
+	if code := run([]string{"check-config", "-config", path}, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit status 0, got %d: %s", code, stderr.String())
 	}
-
-	// Step 3: Validate results
-	var response models.FetchResponse
-	if err := json.NewDecoder(getWriter.Body).Decode(&response); err != nil {
-		t.Fatalf("failed to decode response: %v", err)
+	if !strings.Contains(stdout.String(), path) {
+		t.Errorf("Expected the config file in the output, got %q", stdout.String())
 	}
 
-	if response.TotalURLs != 1 {
-		t.Errorf("expected 1 total URL, got %d", response.TotalURLs)
+	stderr.Reset()
+	code := run([]string{"check-config", "-config", path, "-max-redirects", "-1"}, &stdout, &stderr)
+	if code != 1 {
+		t.Fatalf("Expected exit status 1, got %d", code)
 	}
-
-	if response.SuccessCount != 1 {
-		t.Errorf("expected 1 success, got %d", response.SuccessCount)
+	if !strings.Contains(stderr.String(), "MAX_REDIRECTS") {
+		t.Errorf("Expected the invalid setting to be reported, got %q", stderr.String())
 	}
 
-	// Verify individual results
-	for _, result := range response.Results {
-		if result.Status != models.StatusSuccess {
-			t.Errorf("expected success for %s, got %s", result.URL, result.Status)
-		}
-
-		if result.StatusCode == 0 {
-			t.Errorf("status code not set for %s", result.URL)
-		}
-
-		if result.ContentLength == 0 {
-			t.Errorf("content length not set for %s", result.URL)
-		}
+	stderr.Reset()
+	if code := run([]string{"check-config", "-config", path, "-trusted-proxies", "not-an-ip"}, &stdout, &stderr); code != 1 {
+		t.Fatalf("Expected exit status 1, got %d", code)
 	}
-}
-
-func TestHandleAdminClear(t *testing.T) {
-	svc := createTestService()
-	defer svc.Stop()
-
-	handler := handlers.NewHandler(svc, 100, "1m")
-
-	// Add some results
-	svc.SubmitURLs([]string{"https://example.com", "https://google.com"})
-	time.Sleep(100 * time.Millisecond)
-
-	// Clear results
-	req := httptest.NewRequest("POST", "/admin/clear", nil)
-	w := httptest.NewRecorder()
-
-	handler.HandleAdminClear(w, req)
-
-	if w.Code != http.StatusOK {
-		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	if !strings.Contains(stderr.String(), "TRUSTED_PROXIES") {
+		t.Errorf("Expected TRUSTED_PROXIES to be reported, got %q", stderr.String())
 	}
+}
 
-	var response map[string]interface{}
-	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
-		t.Fatalf("failed to decode response: %v", err)
+func TestVersionCommand(t *testing.T) {
+	var stdout, stderr strings.Builder
+	if code := run([]string{"version"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit status 0, got %d", code)
 	}
-
-	if response["results_cleared"].(float64) != 2 {
-		t.Errorf("expected 2 results cleared, got %v", response["results_cleared"])
+	if !strings.HasPrefix(stdout.String(), "fetch-service "+version) {
+		t.Errorf("Unexpected version output %q", stdout.String())
 	}
 
-	// Verify results are cleared
-	results := svc.GetResults()
-	if results.TotalURLs != 0 {
-		t.Errorf("expected 0 results after clear, got %d", results.TotalURLs)
+	if code := run([]string{"bogus"}, &stdout, &stderr); code != 2 {
+		t.Errorf("Expected exit status 2 for an unknown command, got %d", code)
 	}
 }
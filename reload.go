@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fetch/cmd/model"
+	"fetch/internal/config"
+	"fetch/internal/handler"
+	"fetch/internal/logging"
+	"fetch/internal/ratelimit"
+	"fetch/internal/service"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// reloader re-reads the configuration on request and applies the settings
+// that can change while the service runs
+type reloader struct {
+	mu         sync.Mutex
+	path       string           // -config flag, "" for $CONFIG_FILE
+	overrides  config.Overrides // Settings given as flags
+	cfg        *config.Config   // Configuration in effect
+	reloadedAt time.Time        // Zero until the first reload
+
+	service     *service.FetchService
+	rateLimiter *ratelimit.RateLimiter
+	urlLimiter  *ratelimit.RateLimiter // nil when URL_RATE_LIMIT is disabled
+	handler     *handlers.Handler
+}
+
+// current returns the configuration in effect and when it was last
+// reloaded
+func (rl *reloader) current() (*config.Config, time.Time) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.cfg, rl.reloadedAt
+}
+
+// watch reloads the configuration on every SIGHUP
+func (rl *reloader) watch() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		slog.Info("Received SIGHUP, reloading configuration")
+		rl.reload(context.Background())
+	}
+}
+
+// reload re-reads the configuration and applies its live settings. An
+// invalid configuration is rejected as a whole, keeping the current one.
+func (rl *reloader) reload(ctx context.Context) (models.ConfigReload, error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	next, err := config.LoadWithOverrides(rl.path, rl.overrides)
+	if err == nil {
+		_, err = service.ParseTenantQuotas(next.TenantQuotas)
+		if err != nil {
+			err = &config.ValidationError{Problems: []string{fmt.Sprintf("TENANT_QUOTAS: %v", err)}}
+		}
+	}
+	if err != nil {
+		logInvalidConfig(ctx, err)
+		slog.ErrorContext(ctx, "Not reloading configuration, keeping the current one", "error", err)
+		return models.ConfigReload{}, err
+	}
+
+	cfg, applied, restart := rl.cfg.Reload(next)
+	if err := rl.apply(cfg); err != nil {
+		slog.ErrorContext(ctx, "Failed to apply reloaded configuration", "error", err)
+		return models.ConfigReload{}, err
+	}
+	rl.cfg = cfg
+	rl.reloadedAt = time.Now()
+
+	slog.InfoContext(ctx, "Reloaded configuration", "applied", applied)
+	if len(restart) > 0 {
+		slog.WarnContext(ctx, "Changed settings take effect after a restart", "settings", restart)
+	}
+	return models.ConfigReload{
+		Applied:         append([]string{}, applied...),
+		RestartRequired: append([]string{}, restart...),
+		ReloadedAt:      rl.reloadedAt,
+	}, nil
+}
+
+// apply hands the live settings of cfg to the running components. Rate
+// limiters are only rebuilt when their limits change, since rebuilding
+// resets the budgets tracked in memory.
+func (rl *reloader) apply(cfg *config.Config) error {
+	old := rl.cfg
+	limitsChanged := cfg.RateLimitAlgorithm != old.RateLimitAlgorithm || cfg.RateLimitWindow != old.RateLimitWindow
+	if limitsChanged || cfg.RateLimitRequests != old.RateLimitRequests || cfg.RateLimitBurst != old.RateLimitBurst {
+		if err := rl.rateLimiter.Reconfigure(cfg.RateLimitAlgorithm, cfg.RateLimitRequests, cfg.RateLimitBurst, cfg.RateLimitWindow); err != nil {
+			return fmt.Errorf("reconfiguring rate limiter: %w", err)
+		}
+	}
+	if rl.urlLimiter != nil && (limitsChanged || cfg.URLRateLimit != old.URLRateLimit) {
+		if err := rl.urlLimiter.Reconfigure(cfg.RateLimitAlgorithm, cfg.URLRateLimit, cfg.URLRateLimit, cfg.RateLimitWindow); err != nil {
+			return fmt.Errorf("reconfiguring URL rate limiter: %w", err)
+		}
+	}
+	rl.handler.SetRateLimits(cfg.RateLimitRequests, cfg.URLRateLimit, cfg.RateLimitWindow.String())
+
+	// Validated by config.Load, like the tenant quotas
+	tenantQuotas, _ := service.ParseTenantQuotas(cfg.TenantQuotas)
+	rl.service.Reconfigure(newServiceConfig(cfg, tenantQuotas))
+	return logging.SetLevel(cfg.LogLevel)
+}
+
+// logInvalidConfig logs each problem of an invalid configuration
+func logInvalidConfig(ctx context.Context, err error) {
+	var invalid *config.ValidationError
+	if errors.As(err, &invalid) {
+		for _, problem := range invalid.Problems {
+			slog.ErrorContext(ctx, "Invalid setting", "problem", problem)
+		}
+	}
+}
@@ -15,7 +15,7 @@ echo -e "${BLUE}1. Checking if server is running...${NC}"
 if curl -s http://localhost:8080/health > /dev/null; then
     echo -e "${GREEN}✓ Server is running${NC}\n"
 else
-    echo -e "${RED}✗ Server is not running. Please start it with: go run main.go${NC}"
+    echo -e "${RED}✗ Server is not running. Please start it with: go run .${NC}"
     exit 1
 fi
 